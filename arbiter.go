@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
@@ -9,6 +10,7 @@ import (
 	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/cs"
 	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/mainchain"
 	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/sidechain"
+	"github.com/elastos/Elastos.ELA.Arbiter/backup"
 	"github.com/elastos/Elastos.ELA.Arbiter/config"
 	"github.com/elastos/Elastos.ELA.Arbiter/log"
 	"github.com/elastos/Elastos.ELA.Arbiter/net/servers/httpjsonrpc"
@@ -113,13 +115,54 @@ func initP2P(dataDir string, arbitrator arbitrator.Arbitrator) error {
 	return nil
 }
 
+// runBackupCommand runs "backup [file]" or "restore <file>" and returns the
+// exit code. Both lock the data directory and fail while the arbiter is
+// running, use the createbackup JSON-RPC to back up the running arbiter.
+func runBackupCommand(command string, args []string) int {
+	switch command {
+	case "backup":
+		path := backup.DefaultPath()
+		if len(args) > 0 {
+			path = args[0]
+		}
+		manifest, err := backup.Create(path)
+		if err != nil {
+			fmt.Println("Backup failed:", err)
+			return 1
+		}
+		fmt.Println("Backup", len(manifest.Files), "files to", path)
+	case "restore":
+		if len(args) == 0 {
+			fmt.Println("Usage: arbiter restore <file>")
+			return 1
+		}
+		manifest, err := backup.Restore(args[0])
+		if err != nil {
+			fmt.Println("Restore failed:", err)
+			return 1
+		}
+		fmt.Println("Restored", len(manifest.Files), "files of backup created at", manifest.CreatedTime)
+	}
+	return 0
+}
+
 func main() {
+	if len(os.Args) > 1 && (os.Args[1] == "backup" || os.Args[1] == "restore") {
+		os.Exit(runBackupCommand(os.Args[1], os.Args[2:]))
+	}
+
 	log.Info("Arbiter version: ", config.Version)
 	log.Info("1. Init configurations.")
 	if err := arbitrator.ArbitratorGroupSingleton.InitArbitrators(); err != nil {
 		log.Fatal(err)
 		os.Exit(1)
 	}
+	unlockDataDir, err := store.LockDataDir()
+	if err != nil {
+		log.Fatal(err)
+		os.Exit(1)
+	}
+	defer unlockDataDir()
 
 	log.Info("2. Init chain utxo cache.")
 	dataStore, err := store.OpenDataStore()
@@ -136,6 +179,15 @@ func main() {
 		os.Exit(1)
 	}
 	store.FinishedTxsDbCache = finishedDataStore
+	store.FinishedTxsPruner = store.NewPruner(finishedDataStore, store.RetentionPolicyFromConfig(),
+		config.Parameters.FinishedTxsArchivePath)
+
+	txsFinisher, err := store.OpenTxsFinisher()
+	if err != nil {
+		log.Fatalf("Transactions finisher open failed error: %s", err.Error())
+		os.Exit(1)
+	}
+	store.TxsFinisherSingleton = txsFinisher
 
 	currentArbitrator := arbitrator.ArbitratorGroupSingleton.GetCurrentArbitrator()
 
@@ -167,6 +219,7 @@ func main() {
 
 	setSideChainAccountMonitor(currentArbitrator)
 	currentArbitrator.GetMainChain().SyncChainData()
+	currentArbitrator.VerifyOnStartup()
 	currentArbitrator.GetArbitratorGroup().CheckOnDutyStatus()
 
 	log.Info("7. Start arbitrator spv module.")
@@ -174,6 +227,7 @@ func main() {
 		log.Fatal(err)
 		os.Exit(1)
 	}
+	backup.PauseSPV = currentArbitrator.PauseSpvModule
 
 	log.Info("8. Start arbitrator group monitor.")
 	go arbitrator.ArbitratorGroupSingleton.SyncLoop()
@@ -187,5 +241,11 @@ func main() {
 	log.Info("11. Start side chain account divide.")
 	go sideauxpow.SidechainAccountDivide(wallet)
 
+	log.Info("12. Start genesis address utxos consolidation.")
+	go currentArbitrator.ConsolidateUTXOsLoop()
+
+	log.Info("13. Start finished transactions pruning.")
+	go store.FinishedTxsPruner.PruneLoop()
+
 	select {}
 }
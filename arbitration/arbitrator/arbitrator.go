@@ -2,6 +2,8 @@ package arbitrator
 
 import (
 	"bytes"
+	"errors"
+	"os"
 	"path/filepath"
 	"sync"
 	"time"
@@ -24,7 +26,17 @@ const (
 	ErrInvalidMainchainTx     int64 = 45022
 )
 
-var SpvService SPVService
+const (
+	spvResumeRetries       = 3
+	spvResumeRetryInterval = 5 * time.Second
+)
+
+// spvMux is held for reading while the SPV service is used, and for writing
+// while it is paused, so a stopped service is never used.
+var (
+	spvMux     sync.RWMutex
+	spvService SPVService
+)
 
 type Arbitrator interface {
 	GetPublicKey() *crypto.PublicKey
@@ -37,20 +49,26 @@ type Arbitrator interface {
 	GetArbitratorGroup() ArbitratorGroup
 	GetSideChainManager() SideChainManager
 	GetMainChain() MainChain
+	GetMainChainClient() MainChainClient
 
 	InitAccount(passwd []byte) error
 	StartSpvModule(passwd []byte) error
+	PauseSpvModule() (resume func() error, err error)
 
 	//deposit
 	SendDepositTransactions(spvTxs []*SpvTransaction, genesisAddress string)
 
 	//withdraw
 	CreateWithdrawTransactions(
-		withdrawInfo *WithdrawInfo, sideChain SideChain, sideTransactionHash []string, mcFunc MainChainFunc) []*Transaction
+		withdrawTxs []*WithdrawTx, sideChain SideChain, mcFunc MainChainFunc) []*Transaction
 	BroadcastWithdrawProposal(txns []*Transaction)
 	SendWithdrawTransaction(txn *Transaction) (rpc.Response, error)
 
 	CheckAndRemoveCrossChainTransactionsFromDBLoop()
+	ConsolidateUTXOsLoop()
+
+	Verify(repair bool) (*VerifyReport, error)
+	VerifyOnStartup()
 }
 
 type ArbitratorImpl struct {
@@ -61,6 +79,14 @@ type ArbitratorImpl struct {
 	mainChainClientImpl  MainChainClient
 	sideChainManagerImpl SideChainManager
 	Keystore             Keystore
+
+	spvConfig         *Config
+	spvListeners      []TransactionListener
+	rollbackListeners []rollbackListener
+}
+
+type rollbackListener interface {
+	Rollback(height uint32)
 }
 
 func (ar *ArbitratorImpl) GetSideChainManager() SideChainManager {
@@ -132,12 +158,40 @@ func (ar *ArbitratorImpl) GetArbitratorGroup() ArbitratorGroup {
 	return ArbitratorGroupSingleton
 }
 
-func (ar *ArbitratorImpl) CreateWithdrawTransactions(withdrawInfo *WithdrawInfo, sideChain SideChain,
-	sideTransactionHash []string, mcFunc MainChainFunc) []*Transaction {
-	//todo divide into different transactions by the number of side chain transactions
+func (ar *ArbitratorImpl) CreateWithdrawTransactions(withdrawTxs []*WithdrawTx, sideChain SideChain,
+	mcFunc MainChainFunc) []*Transaction {
+	exchangeRate, err := sideChain.GetExchangeRate()
+	if err != nil {
+		log.Warn(err.Error())
+		return nil
+	}
+
 	var result []*Transaction
+	for _, batch := range splitWithdrawTxs(filterUnderpaidWithdrawTxs(withdrawTxs, exchangeRate)) {
+		result = append(result, ar.createWithdrawTransactions(batch, sideChain, mcFunc)...)
+	}
+	return result
+}
 
-	withdrawTransaction, err := ar.mainChainImpl.CreateWithdrawTransaction(sideChain, withdrawInfo, sideTransactionHash, mcFunc)
+func (ar *ArbitratorImpl) createWithdrawTransactions(withdrawTxs []*WithdrawTx, sideChain SideChain,
+	mcFunc MainChainFunc) []*Transaction {
+	withdrawInfo := new(WithdrawInfo)
+	var sideTransactionHashes []string
+	for _, tx := range withdrawTxs {
+		withdrawInfo.WithdrawAssets = append(withdrawInfo.WithdrawAssets, tx.WithdrawInfo.WithdrawAssets...)
+		sideTransactionHashes = append(sideTransactionHashes, tx.Txid.String())
+	}
+
+	withdrawTransaction, err := ar.mainChainImpl.CreateWithdrawTransaction(sideChain, withdrawInfo, sideTransactionHashes, mcFunc)
+	if feeErr, ok := err.(*InsufficientFeeError); ok {
+		// The fee of a transaction may not cover the inputs selected for it,
+		// so split the batch until the underpaid transaction is alone
+		if len(withdrawTxs) > 1 {
+			return ar.splitAndCreateWithdrawTransactions(withdrawTxs, sideChain, mcFunc)
+		}
+		finishUnderpaidWithdrawTx(withdrawTxs[0], feeErr)
+		return nil
+	}
 	if err != nil {
 		log.Warn(err.Error())
 		return nil
@@ -146,9 +200,28 @@ func (ar *ArbitratorImpl) CreateWithdrawTransactions(withdrawInfo *WithdrawInfo,
 		log.Warn("Created an empty withdraw transaction.")
 		return nil
 	}
-	result = append(result, withdrawTransaction)
 
-	return result
+	// Inputs are unknown while splitting batches, so split the batch again
+	// if the transaction turns out to be too large
+	if len(withdrawTxs) > 1 && GetWithdrawTransactionSize(withdrawTransaction) > config.Parameters.WithdrawBatchMaxSize {
+		return ar.splitAndCreateWithdrawTransactions(withdrawTxs, sideChain, mcFunc)
+	}
+
+	// Mark the inputs as used, so the following batches will not spend them
+	var outPoints []OutPoint
+	for _, input := range withdrawTransaction.Inputs {
+		outPoints = append(outPoints, input.Previous)
+	}
+	sideChain.AddLastUsedOutPoints(outPoints)
+
+	return []*Transaction{withdrawTransaction}
+}
+
+func (ar *ArbitratorImpl) splitAndCreateWithdrawTransactions(withdrawTxs []*WithdrawTx, sideChain SideChain,
+	mcFunc MainChainFunc) []*Transaction {
+	half := len(withdrawTxs) / 2
+	return append(ar.createWithdrawTransactions(withdrawTxs[:half], sideChain, mcFunc),
+		ar.createWithdrawTransactions(withdrawTxs[half:], sideChain, mcFunc)...)
 }
 
 type DepositTxInfo struct {
@@ -159,8 +232,11 @@ type DepositTxInfo struct {
 func (ar *ArbitratorImpl) SendDepositTransactions(spvTxs []*SpvTransaction, genesisAddress string) {
 	var failedMainChainTxHashes []string
 	var failedGenesisAddresses []string
+	var failedBlockHeights []uint32
 	var succeedMainChainTxHashes []string
 	var succeedGenesisAddresses []string
+	var succeedBlockHeights []uint32
+	var succeedSideChainTxHashes []string
 	sideChain, ok := ArbitratorGroupSingleton.GetCurrentArbitrator().GetSideChainManager().GetChain(genesisAddress)
 	if !ok {
 		log.Error("[SyncMainChainCachedTxs] Get side chain from genesis address failed, genesis address:", genesisAddress)
@@ -173,42 +249,40 @@ func (ar *ArbitratorImpl) SendDepositTransactions(spvTxs []*SpvTransaction, gene
 			log.Warn("Send deposit transaction failed, move to finished db, main chain tx hash:", hash.String())
 			failedMainChainTxHashes = append(failedMainChainTxHashes, hash.String())
 			failedGenesisAddresses = append(failedGenesisAddresses, genesisAddress)
+			failedBlockHeights = append(failedBlockHeights, tx.Proof.Height)
 		} else if resp.Error == nil && resp.Result != nil || resp.Error != nil && resp.Code == SCErrMainchainTxDuplicate {
+			var sideChainTxHash string
 			if resp.Error != nil {
 				log.Info("Send deposit found transaction has been processed, move to finished db, main chain tx hash:", hash.String())
 			} else {
 				log.Info("Send deposit transaction succeed, move to finished db, main chain tx hash:", hash.String())
 				if txHash, ok := resp.Result.(string); ok {
 					log.Info("Send deposit transaction succeed, move to finished db, side chain tx hash:", txHash)
+					sideChainTxHash = txHash
 				} else {
 					log.Info("Send deposit transaction, received invalid response")
 				}
 			}
 			succeedMainChainTxHashes = append(succeedMainChainTxHashes, hash.String())
 			succeedGenesisAddresses = append(succeedGenesisAddresses, genesisAddress)
+			succeedBlockHeights = append(succeedBlockHeights, tx.Proof.Height)
+			succeedSideChainTxHashes = append(succeedSideChainTxHashes, sideChainTxHash)
 		} else {
 			log.Warn("Send deposit transaction failed, need to resend, main chain tx hash:", hash.String())
 		}
 	}
 
-	for i := 0; i < len(failedMainChainTxHashes); i++ {
-		err := store.DbCache.MainChainStore.RemoveMainChainTxs(failedMainChainTxHashes, failedGenesisAddresses)
-		if err != nil {
-			log.Warn("Remove faild transaction from db failed")
-		}
-		err = store.FinishedTxsDbCache.AddFailedDepositTxs(failedMainChainTxHashes, failedGenesisAddresses)
+	if len(failedMainChainTxHashes) != 0 {
+		err := store.TxsFinisherSingleton.FinishDepositTxs(false, failedMainChainTxHashes, failedGenesisAddresses, failedBlockHeights, nil)
 		if err != nil {
-			log.Warn("Add faild transaction to finished db failed")
+			log.Warn("Move faild deposit transaction to finished db failed, err:", err)
 		}
 	}
-	for i := 0; i < len(succeedMainChainTxHashes); i++ {
-		err := store.DbCache.MainChainStore.RemoveMainChainTxs(succeedMainChainTxHashes, succeedGenesisAddresses)
-		if err != nil {
-			log.Warn("Remove succeed deposit transaction from db failed")
-		}
-		err = store.FinishedTxsDbCache.AddSucceedDepositTxs(succeedMainChainTxHashes, succeedGenesisAddresses)
+	if len(succeedMainChainTxHashes) != 0 {
+		err := store.TxsFinisherSingleton.FinishDepositTxs(true, succeedMainChainTxHashes, succeedGenesisAddresses, succeedBlockHeights,
+			succeedSideChainTxHashes)
 		if err != nil {
-			log.Warn("Add succeed deposit transaction to finished db failed")
+			log.Warn("Move succeed deposit transaction to finished db failed, err:", err)
 		}
 	}
 }
@@ -229,8 +303,8 @@ func (ar *ArbitratorImpl) SendWithdrawTransaction(txn *Transaction) (rpc.Respons
 	}
 
 	log.Info("[Rpc-sendrawtransaction] Withdraw transaction to main chain：", config.Parameters.MainNode.Rpc.IpAddress, ":", config.Parameters.MainNode.Rpc.HttpJsonPort)
-	resp, err := rpc.CallAndUnmarshalResponse("sendrawtransaction",
-		rpc.Param("data", content), config.Parameters.MainNode.Rpc)
+	resp, err := rpc.GetClient(config.Parameters.MainNode.Rpc).SendResponse("sendrawtransaction",
+		rpc.Param("data", content))
 	if err != nil {
 		return rpc.Response{}, err
 	}
@@ -262,6 +336,10 @@ func (ar *ArbitratorImpl) GetMainChain() MainChain {
 	return ar.mainChainImpl
 }
 
+func (ar *ArbitratorImpl) GetMainChainClient() MainChainClient {
+	return ar.mainChainClientImpl
+}
+
 func (ar *ArbitratorImpl) SetMainChainClient(client MainChainClient) {
 	ar.mainChainClientImpl = client
 }
@@ -293,17 +371,11 @@ func (ar *ArbitratorImpl) StartSpvModule(passwd []byte) error {
 		DefaultPort:    config.Parameters.MainNode.DefaultPort,
 		MinOutbound:    config.Parameters.MainNode.MinOutbound,
 		MaxConnections: config.Parameters.MainNode.MaxConnections,
-		OnRollback:     nil, // Not implemented yet
+		OnRollback:     ar.onMainChainRollback,
 	}
 
 	log.Info("[StartSpvModule] new spv service:", spvCfg)
 
-	var err error
-	SpvService, err = NewSPVService(spvCfg)
-	if err != nil {
-		return err
-	}
-
 	for _, sideNode := range config.Parameters.SideNodeList {
 		keystore, err := wallet.OpenKeystore(sideNode.KeystoreFile, passwd)
 		if err != nil {
@@ -312,28 +384,102 @@ func (ar *ArbitratorImpl) StartSpvModule(passwd []byte) error {
 
 		if sideNode.PowChain {
 			log.Info("[StartSpvModule] register auxpow listener:", keystore.Address())
-			auxpowListener := &AuxpowListener{ListenAddress: keystore.Address()}
-			auxpowListener.start()
-			err = SpvService.RegisterTransactionListener(auxpowListener)
-			if err != nil {
-				return err
+			auxpowListener := &AuxpowListener{
+				ListenAddress:       keystore.Address(),
+				GenesisBlockAddress: sideNode.GenesisBlockAddress,
 			}
+			auxpowListener.start()
+			ar.spvListeners = append(ar.spvListeners, auxpowListener)
+			ar.rollbackListeners = append(ar.rollbackListeners, auxpowListener)
 		}
 
 		log.Info("[StartSpvModule] register dposit listener:", sideNode.GenesisBlockAddress)
 		dpListener := &DepositListener{ListenAddress: sideNode.GenesisBlockAddress}
 		dpListener.start()
-		err = SpvService.RegisterTransactionListener(dpListener)
-		if err != nil {
-			return err
-		}
+		ar.spvListeners = append(ar.spvListeners, dpListener)
+		ar.rollbackListeners = append(ar.rollbackListeners, dpListener)
+	}
+	ar.spvConfig = spvCfg
+
+	service, err := ar.newSpvService()
+	if err != nil {
+		return err
 	}
+	spvMux.Lock()
+	spvService = service
+	spvMux.Unlock()
 
-	go SpvService.Start()
+	go service.Start()
 
 	return nil
 }
 
+// newSpvService creates the SPV service with the listeners registered.
+func (ar *ArbitratorImpl) newSpvService() (SPVService, error) {
+	service, err := NewSPVService(ar.spvConfig)
+	if err != nil {
+		return nil, err
+	}
+	for _, listener := range ar.spvListeners {
+		if err := service.RegisterTransactionListener(listener); err != nil {
+			return nil, err
+		}
+	}
+	return service, nil
+}
+
+// PauseSpvModule stops the SPV service, so its data is not written while being
+// copied, and returns the function starting a new SPV service on the same data
+// with the listeners registered. The users of the SPV service wait until the
+// service is resumed, and the arbiter exits if it can not be resumed.
+func (ar *ArbitratorImpl) PauseSpvModule() (func() error, error) {
+	spvMux.Lock()
+	if spvService == nil || ar.spvConfig == nil {
+		spvMux.Unlock()
+		return nil, errors.New("spv module is not started")
+	}
+	log.Info("[PauseSpvModule] stop spv service")
+	spvService.Stop()
+
+	return func() error {
+		defer spvMux.Unlock()
+
+		var err error
+		for retries := 0; retries < spvResumeRetries; retries++ {
+			var service SPVService
+			if service, err = ar.newSpvService(); err == nil {
+				spvService = service
+				log.Info("[PauseSpvModule] restart spv service")
+				go service.Start()
+				return nil
+			}
+			log.Warn("[PauseSpvModule] restart spv service failed, err:", err)
+			time.Sleep(spvResumeRetryInterval)
+		}
+		log.Fatal("[PauseSpvModule] can not restart spv service, err:", err)
+		os.Exit(1)
+		return err
+	}, nil
+}
+
+// UseSpvService calls fn with the SPV service, waiting while the service is
+// paused. fn must not call UseSpvService again.
+func UseSpvService(fn func(service SPVService) error) error {
+	spvMux.RLock()
+	defer spvMux.RUnlock()
+	if spvService == nil {
+		return errors.New("spv module is not started")
+	}
+	return fn(spvService)
+}
+
+func (ar *ArbitratorImpl) onMainChainRollback(height uint32) {
+	log.Warn("[OnRollback] main chain rollback to height:", height)
+	for _, listener := range ar.rollbackListeners {
+		listener.Rollback(height)
+	}
+}
+
 func (ar *ArbitratorImpl) convertToTransactionContent(txn *Transaction) (string, error) {
 	buf := new(bytes.Buffer)
 	err := txn.Serialize(buf)
@@ -17,7 +17,8 @@ import (
 )
 
 type AuxpowListener struct {
-	ListenAddress string
+	ListenAddress       string
+	GenesisBlockAddress string
 
 	notifyQueue chan *notifyTask
 }
@@ -34,41 +35,66 @@ func (l *AuxpowListener) Flags() uint64 {
 	return spv.FlagNotifyInSyncing
 }
 
-func (l *AuxpowListener) Rollback(height uint32) {}
+// Rollback restarts side chain mining of the listened side chain, because the
+// side aux pow already submitted may refer to an orphaned main chain block.
+func (l *AuxpowListener) Rollback(height uint32) {
+	log.Warn("[Rollback-Auxpow][", l.ListenAddress, "] main chain rollback to height:", height)
+
+	currentArbitrator := ArbitratorGroupSingleton.GetCurrentArbitrator()
+	if !currentArbitrator.IsOnDutyOfMain() {
+		return
+	}
+
+	sideChain, ok := currentArbitrator.GetSideChainManager().GetChain(l.GenesisBlockAddress)
+	if !ok {
+		log.Error("[Rollback-Auxpow] can not find side chain from genesis address:", l.GenesisBlockAddress)
+		return
+	}
+	log.Info("[Rollback-Auxpow] restart side chain mining, genesis address:", l.GenesisBlockAddress)
+	go sideChain.StartSideChainMining()
+}
 
 func (l *AuxpowListener) Notify(id common.Uint256, proof bloom.MerkleProof, tx ela.Transaction) {
 	l.notifyQueue <- &notifyTask{id, &proof, &tx}
 	log.Info("[Notify-Auxpow][", l.ListenAddress, "] find side aux pow transaction, hash:", tx.Hash().String())
-	err := SpvService.SubmitTransactionReceipt(id, tx.Hash())
-	if err != nil {
-		return
-	}
 }
 
 func (l *AuxpowListener) ProcessNotifyData(tasks []*notifyTask) {
 	task := tasks[len(tasks)-1]
 	log.Info("[Notify-ProcessNotifyData][", l.ListenAddress, "] process hash:", task.tx.Hash().String(), "len tasks:", len(tasks))
-	err := SpvService.VerifyTransaction(*task.proof, *task.tx)
-	if err != nil {
-		log.Error("Verify transaction error: ", err)
-		return
-	}
+	var merkleBlock msg.MerkleBlock
+	err := UseSpvService(func(service spv.SPVService) error {
+		for _, t := range tasks {
+			if err := service.SubmitTransactionReceipt(t.id, t.tx.Hash()); err != nil {
+				log.Warn("Submit transaction receipt error: ", err)
+			}
+		}
+
+		if err := service.VerifyTransaction(*task.proof, *task.tx); err != nil {
+			log.Error("Verify transaction error: ", err)
+			return err
+		}
 
-	// Get Header from main chain
-	header, err := SpvService.HeaderStore().Get(&task.proof.BlockHash)
+		// Get Header from main chain
+		header, err := service.HeaderStore().Get(&task.proof.BlockHash)
+		if err != nil {
+			log.Error("can not get block from main chain")
+			return err
+		}
+
+		// Check if merkleroot is match
+		merkleBlock = msg.MerkleBlock{
+			Header:       header.BlockHeader,
+			Transactions: task.proof.Transactions,
+			Hashes:       task.proof.Hashes,
+			Flags:        task.proof.Flags,
+		}
+		return nil
+	})
 	if err != nil {
-		log.Error("can not get block from main chain")
 		return
 	}
 
-	// Check if merkleroot is match
-	merkleBlock := msg.MerkleBlock{
-		Header:       header.BlockHeader,
-		Transactions: task.proof.Transactions,
-		Hashes:       task.proof.Hashes,
-		Flags:        task.proof.Flags,
-	}
-
 	txId := task.tx.Hash()
 	merkleBranch, err := bloom.GetTxMerkleBranch(merkleBlock, &txId)
 	if err != nil {
@@ -76,7 +102,7 @@ func (l *AuxpowListener) ProcessNotifyData(tasks []*notifyTask) {
 		return
 	}
 
-	elaHeader, ok := header.BlockHeader.(*iutil.Header)
+	elaHeader, ok := merkleBlock.Header.(*iutil.Header)
 	if !ok {
 		log.Error("invalid block header")
 		return
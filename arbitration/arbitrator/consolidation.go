@@ -0,0 +1,49 @@
+package arbitrator
+
+import (
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+
+	. "github.com/elastos/Elastos.ELA/core/types"
+)
+
+// ConsolidateUTXOsLoop periodically merges the dust utxos of genesis block
+// addresses while current arbiter is on duty of main chain.
+func (ar *ArbitratorImpl) ConsolidateUTXOsLoop() {
+	if config.Parameters.ConsolidateInterval == 0 {
+		log.Info("UTXO consolidation is disabled")
+		return
+	}
+	for {
+		time.Sleep(time.Millisecond * config.Parameters.ConsolidateInterval)
+		if !ar.IsOnDutyOfMain() {
+			continue
+		}
+		ar.consolidateUTXOs()
+	}
+}
+
+func (ar *ArbitratorImpl) consolidateUTXOs() {
+	for _, sc := range ar.GetSideChainManager().GetAllChains() {
+		txn, err := ar.mainChainImpl.CreateConsolidateTransaction(sc, &DbMainChainFunc{})
+		if err != nil {
+			log.Warn("[consolidateUTXOs] Create consolidate transaction failed, genesis address:", sc.GetKey(), "err:", err)
+			continue
+		}
+		if txn == nil {
+			continue
+		}
+
+		// Mark the inputs as used, so withdraw transactions will not spend them
+		var outPoints []OutPoint
+		for _, input := range txn.Inputs {
+			outPoints = append(outPoints, input.Previous)
+		}
+		sc.AddLastUsedOutPoints(outPoints)
+
+		log.Info("[consolidateUTXOs] Consolidate", len(txn.Inputs), "utxos of genesis address:", sc.GetKey())
+		ar.BroadcastWithdrawProposal([]*Transaction{txn})
+	}
+}
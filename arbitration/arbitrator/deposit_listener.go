@@ -1,6 +1,8 @@
 package arbitrator
 
 import (
+	"sync"
+
 	. "github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
 	"github.com/elastos/Elastos.ELA.Arbiter/log"
 	"github.com/elastos/Elastos.ELA.Arbiter/store"
@@ -15,6 +17,10 @@ import (
 type DepositListener struct {
 	ListenAddress string
 	notifyQueue   chan *notifyTask
+
+	// processMux makes sure a rollback never interleaves with a batch of
+	// notified deposits being written into the main chain cache
+	processMux sync.Mutex
 }
 
 func (l *DepositListener) Address() string {
@@ -37,6 +43,9 @@ func (l *DepositListener) Notify(id common.Uint256, proof bloom.MerkleProof, tx
 func (l *DepositListener) ProcessNotifyData(tasks []*notifyTask) {
 	log.Info("[Notify-Process] deal with", len(tasks), "transactions")
 
+	l.processMux.Lock()
+	defer l.processMux.Unlock()
+
 	var ids []common.Uint256
 	var txs []*MainChainTransaction
 	for _, data := range tasks {
@@ -55,8 +64,14 @@ func (l *DepositListener) ProcessNotifyData(tasks []*notifyTask) {
 		return
 	}
 
-	for i := 0; i < len(ids); i++ {
-		SpvService.SubmitTransactionReceipt(ids[i], txs[i].Transaction.Hash())
+	err = UseSpvService(func(service SPVService) error {
+		for i := 0; i < len(ids); i++ {
+			service.SubmitTransactionReceipt(ids[i], txs[i].Transaction.Hash())
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error("[Notify-Process] SubmitTransactionReceipt error:", err)
 	}
 
 	if !ArbitratorGroupSingleton.GetCurrentArbitrator().IsOnDutyOfMain() {
@@ -77,7 +92,38 @@ func (l *DepositListener) ProcessNotifyData(tasks []*notifyTask) {
 	ArbitratorGroupSingleton.GetCurrentArbitrator().SendDepositTransactions(spvTxs, l.ListenAddress)
 }
 
+// Rollback drops every cached deposit of this genesis address that was found
+// in a block above height, and revokes the finished records based on those
+// blocks, so transactions re-included by the new best chain will be notified
+// and processed again.
 func (l *DepositListener) Rollback(height uint32) {
+	l.processMux.Lock()
+	defer l.processMux.Unlock()
+
+	log.Warn("[Rollback-Deposit][", l.ListenAddress, "] main chain rollback to height:", height)
+
+	removedTxs, err := store.DbCache.MainChainStore.RemoveMainChainTxsAboveHeight(l.ListenAddress, height)
+	if err != nil {
+		log.Error("[Rollback-Deposit] remove main chain txs above height", height, "failed:", err)
+	}
+	for _, txHash := range removedTxs {
+		log.Info("[Rollback-Deposit] removed pending deposit transaction:", txHash)
+	}
+
+	revokedTxs, succeed, err := store.FinishedTxsDbCache.RemoveDepositTxsAboveHeight(l.ListenAddress, height)
+	if err != nil {
+		log.Error("[Rollback-Deposit] remove finished deposit txs above height", height, "failed:", err)
+		return
+	}
+	for i, txHash := range revokedTxs {
+		if succeed[i] {
+			log.Warn("[Rollback-Deposit] deposit transaction based on orphaned block has been sent to side chain, hash:", txHash)
+		} else {
+			log.Info("[Rollback-Deposit] revoked failed deposit transaction:", txHash)
+		}
+	}
+
+	log.Info("[Rollback-Deposit] rollback finished, removed", len(removedTxs), "pending and", len(revokedTxs), "finished deposit transactions")
 }
 
 type notifyTask struct {
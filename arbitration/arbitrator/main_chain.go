@@ -4,12 +4,14 @@ import (
 	. "github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
 	. "github.com/elastos/Elastos.ELA.Arbiter/store"
 
+	"github.com/elastos/Elastos.ELA/common"
 	"github.com/elastos/Elastos.ELA/core/types"
 )
 
 type MainChain interface {
 	CreateWithdrawTransaction(sideChain SideChain, withdrawInfo *WithdrawInfo,
 		sideChainTransactionHashes []string, mcFunc MainChainFunc) (*types.Transaction, error)
+	CreateConsolidateTransaction(sideChain SideChain, mcFunc MainChainFunc) (*types.Transaction, error)
 
 	BroadcastWithdrawProposal(txn *types.Transaction) error
 	ReceiveProposalFeedback(content []byte) error
@@ -17,10 +19,15 @@ type MainChain interface {
 	SyncMainChainCachedTxs() error
 	CheckAndRemoveDepositTransactionsFromDB() error
 	SyncChainData()
+
+	GetProposals() []*ProposalInfo
+	GetProposalMetrics() ProposalMetrics
+	GetProposalStatus(hash common.Uint256) (*ProposalStatus, bool)
 }
 
 type MainChainClient interface {
 	OnReceivedProposal(content []byte) error
+	GetProposalRejection(hash common.Uint256) (*ProposalSigner, bool)
 }
 
 type MainChainFunc interface {
@@ -0,0 +1,371 @@
+package arbitrator
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+	"github.com/elastos/Elastos.ELA.Arbiter/rpc"
+	"github.com/elastos/Elastos.ELA.Arbiter/store"
+
+	. "github.com/elastos/Elastos.ELA/common"
+	. "github.com/elastos/Elastos.ELA/core/types"
+)
+
+// Kinds of the discrepancies found by Verify.
+const (
+	// UTXOMissing is an utxo of the main node not in the cache
+	UTXOMissing = "missing"
+	// UTXOSpent is an utxo in the cache already spent on the main node
+	UTXOSpent = "spent"
+	// UTXOMismatched is an utxo whose amount or lock differs from the main node
+	UTXOMismatched = "mismatched"
+
+	// TxFinished is a pending transaction already in the finished database
+	TxFinished = "finished"
+	// TxExisted is a pending transaction already packed by the target chain
+	TxExisted = "existed"
+)
+
+var verifyMux sync.Mutex
+
+// UTXODiscrepancy is an utxo of a genesis block address differs between the
+// cache and the main node.
+type UTXODiscrepancy struct {
+	GenesisBlockAddress string
+	TransactionHash     string
+	Index               uint16
+	Kind                string
+	CachedAmount        string
+	NodeAmount          string
+}
+
+// TxDiscrepancy is a pending cross chain transaction which should have been
+// finished.
+type TxDiscrepancy struct {
+	TransactionHash     string
+	GenesisBlockAddress string
+	Kind                string
+}
+
+// VerifyReport is the result of one run of Verify.
+type VerifyReport struct {
+	StartTime   time.Time
+	Duration    time.Duration
+	Repair      bool
+	UTXOs       []*UTXODiscrepancy
+	DepositTxs  []*TxDiscrepancy
+	WithdrawTxs []*TxDiscrepancy
+	// Skipped are the checks not finished, because the nodes are unreachable
+	// or the cache is still syncing
+	Skipped []string
+	// Repaired is false if any discrepancy failed to be repaired
+	Repaired bool
+}
+
+// Consistent returns whether the cache matches the nodes.
+func (r *VerifyReport) Consistent() bool {
+	return len(r.UTXOs) == 0 && len(r.DepositTxs) == 0 && len(r.WithdrawTxs) == 0 && len(r.Skipped) == 0
+}
+
+// VerifyOnStartup verifies the cached cross chain state as configured and logs
+// the report.
+func (ar *ArbitratorImpl) VerifyOnStartup() {
+	if !config.Parameters.VerifyOnStartup {
+		log.Info("Startup verification is disabled")
+		return
+	}
+	report, err := ar.Verify(config.Parameters.VerifyRepair)
+	if err != nil {
+		log.Error("[Verify] Verify cached cross chain state failed:", err)
+		return
+	}
+	if report.Consistent() {
+		log.Info("[Verify] Cached cross chain state is consistent with the nodes")
+		return
+	}
+	log.Warn("[Verify] Found", len(report.UTXOs), "utxo,", len(report.DepositTxs), "deposit and",
+		len(report.WithdrawTxs), "withdraw discrepancies, skipped:", report.Skipped, "repair:", report.Repair,
+		"repaired:", report.Repaired)
+}
+
+// Verify cross checks the utxo cache of the genesis block addresses against
+// the main node, the pending deposit transactions against the side nodes and
+// the pending withdraw transactions against the main node. The discrepancies
+// are repaired if repair is true, otherwise they are only reported.
+func (ar *ArbitratorImpl) Verify(repair bool) (*VerifyReport, error) {
+	verifyMux.Lock()
+	defer verifyMux.Unlock()
+
+	report := &VerifyReport{StartTime: time.Now(), Repair: repair, Repaired: repair}
+	if err := ar.verifyUTXOs(report); err != nil {
+		return nil, err
+	}
+	if err := ar.verifyDepositTxs(report); err != nil {
+		return nil, err
+	}
+	if err := ar.verifyWithdrawTxs(report); err != nil {
+		return nil, err
+	}
+	report.Duration = time.Since(report.StartTime)
+	return report, nil
+}
+
+func (ar *ArbitratorImpl) verifyUTXOs(report *VerifyReport) error {
+	// The cache is behind the main node while syncing, which is not a
+	// discrepancy, so utxos are compared only if the heights are the same
+	cacheHeight := store.DbCache.UTXOStore.CurrentHeight(store.QueryHeightCode)
+	nodeHeight, err := rpc.GetCurrentHeight(config.Parameters.MainNode.Rpc)
+	if err != nil {
+		report.Skipped = append(report.Skipped, "utxos: get main node height failed: "+err.Error())
+		return nil
+	}
+	if cacheHeight != nodeHeight {
+		report.Skipped = append(report.Skipped, "utxos: cache is syncing")
+		return nil
+	}
+
+	for _, sc := range ar.GetSideChainManager().GetAllChains() {
+		genesisAddress := sc.GetKey()
+		cachedUTXOs, err := store.DbCache.UTXOStore.GetAddressUTXOsFromGenesisBlockAddress(genesisAddress)
+		if err != nil {
+			return err
+		}
+		nodeUTXOs, err := getNodeUTXOs(genesisAddress)
+		if err != nil {
+			report.Skipped = append(report.Skipped, "utxos of "+genesisAddress+": "+err.Error())
+			continue
+		}
+		if height := store.DbCache.UTXOStore.CurrentHeight(store.QueryHeightCode); height != cacheHeight {
+			report.Skipped = append(report.Skipped, "utxos of "+genesisAddress+": cache is syncing")
+			continue
+		}
+
+		var addUTXOs []*store.AddressUTXO
+		var deleteInputs []*Input
+		for _, utxo := range cachedUTXOs {
+			discrepancy := &UTXODiscrepancy{
+				GenesisBlockAddress: genesisAddress,
+				TransactionHash:     utxo.Input.Previous.TxID.String(),
+				Index:               utxo.Input.Previous.Index,
+				CachedAmount:        utxo.Amount.String(),
+			}
+			nodeUTXO, ok := nodeUTXOs[utxo.Input.Previous]
+			if !ok {
+				discrepancy.Kind = UTXOSpent
+				deleteInputs = append(deleteInputs, utxo.Input)
+			} else {
+				delete(nodeUTXOs, utxo.Input.Previous)
+				if *nodeUTXO.Amount == *utxo.Amount && nodeUTXO.Input.Sequence == utxo.Input.Sequence {
+					continue
+				}
+				discrepancy.Kind = UTXOMismatched
+				discrepancy.NodeAmount = nodeUTXO.Amount.String()
+				deleteInputs = append(deleteInputs, utxo.Input)
+				addUTXOs = append(addUTXOs, nodeUTXO)
+			}
+			report.UTXOs = append(report.UTXOs, discrepancy)
+		}
+		for _, nodeUTXO := range nodeUTXOs {
+			report.UTXOs = append(report.UTXOs, &UTXODiscrepancy{
+				GenesisBlockAddress: genesisAddress,
+				TransactionHash:     nodeUTXO.Input.Previous.TxID.String(),
+				Index:               nodeUTXO.Input.Previous.Index,
+				Kind:                UTXOMissing,
+				NodeAmount:          nodeUTXO.Amount.String(),
+			})
+			addUTXOs = append(addUTXOs, nodeUTXO)
+		}
+
+		if !report.Repair {
+			continue
+		}
+		if len(deleteInputs) != 0 {
+			if err := store.DbCache.UTXOStore.DeleteUTXOs(deleteInputs); err != nil {
+				log.Warn("[Verify] Delete utxos of genesis address:", genesisAddress, "failed:", err)
+				report.Repaired = false
+				continue
+			}
+		}
+		if len(addUTXOs) != 0 {
+			if err := store.DbCache.UTXOStore.AddAddressUTXOs(addUTXOs); err != nil {
+				log.Warn("[Verify] Add utxos of genesis address:", genesisAddress, "failed:", err)
+				report.Repaired = false
+			}
+		}
+	}
+	return nil
+}
+
+// getNodeUTXOs returns the utxos of the genesis block address listed by the
+// main node, in the form they are cached.
+func getNodeUTXOs(genesisAddress string) (map[OutPoint]*store.AddressUTXO, error) {
+	utxoInfos, err := rpc.GetUnspentUtxo([]string{genesisAddress}, config.Parameters.MainNode.Rpc)
+	if err != nil {
+		return nil, err
+	}
+
+	utxos := make(map[OutPoint]*store.AddressUTXO, len(utxoInfos))
+	for _, utxoInfo := range utxoInfos {
+		txHashBytes, err := HexStringToBytes(utxoInfo.Txid)
+		if err != nil {
+			return nil, err
+		}
+		txHash, err := Uint256FromBytes(BytesReverse(txHashBytes))
+		if err != nil {
+			return nil, err
+		}
+		amount, err := StringToFixed64(utxoInfo.Amount)
+		if err != nil {
+			return nil, err
+		}
+		if *amount <= Fixed64(0) {
+			continue
+		}
+		input := &Input{
+			Previous: OutPoint{TxID: *txHash, Index: uint16(utxoInfo.VOut)},
+			Sequence: utxoInfo.OutputLock,
+		}
+		utxos[input.Previous] = &store.AddressUTXO{
+			Input:               input,
+			Amount:              amount,
+			GenesisBlockAddress: genesisAddress,
+		}
+	}
+	return utxos, nil
+}
+
+func (ar *ArbitratorImpl) verifyDepositTxs(report *VerifyReport) error {
+	txs, err := store.DbCache.MainChainStore.GetAllMainChainTxs()
+	if err != nil {
+		return err
+	}
+
+	var genesisAddresses []string
+	txHashes := make(map[string][]string)
+	txHeights := make(map[string][]uint32)
+	for _, tx := range txs {
+		if _, ok := txHashes[tx.GenesisBlockAddress]; !ok {
+			genesisAddresses = append(genesisAddresses, tx.GenesisBlockAddress)
+		}
+		var height uint32
+		if tx.Proof != nil {
+			height = tx.Proof.Height
+		}
+		txHashes[tx.GenesisBlockAddress] = append(txHashes[tx.GenesisBlockAddress], tx.TransactionHash)
+		txHeights[tx.GenesisBlockAddress] = append(txHeights[tx.GenesisBlockAddress], height)
+	}
+
+	for _, genesisAddress := range genesisAddresses {
+		var pendingTxs, finishedTxs []string
+		for _, txHash := range txHashes[genesisAddress] {
+			finished, err := store.FinishedTxsDbCache.HasDepositTx(txHash, genesisAddress)
+			if err != nil {
+				return err
+			}
+			if finished {
+				finishedTxs = append(finishedTxs, txHash)
+				report.DepositTxs = append(report.DepositTxs, &TxDiscrepancy{
+					TransactionHash:     txHash,
+					GenesisBlockAddress: genesisAddress,
+					Kind:                TxFinished,
+				})
+			} else {
+				pendingTxs = append(pendingTxs, txHash)
+			}
+		}
+
+		var existedTxs []string
+		if sc, ok := ar.GetSideChainManager().GetChain(genesisAddress); !ok {
+			report.Skipped = append(report.Skipped, "deposits of "+genesisAddress+": unknown side chain")
+		} else if len(pendingTxs) != 0 {
+			existedTxs, err = sc.GetExistDepositTransactions(pendingTxs)
+			if err != nil {
+				report.Skipped = append(report.Skipped, "deposits of "+genesisAddress+": "+err.Error())
+			}
+			for _, txHash := range existedTxs {
+				report.DepositTxs = append(report.DepositTxs, &TxDiscrepancy{
+					TransactionHash:     txHash,
+					GenesisBlockAddress: genesisAddress,
+					Kind:                TxExisted,
+				})
+			}
+		}
+
+		if !report.Repair {
+			continue
+		}
+		if len(finishedTxs) != 0 {
+			addresses := make([]string, len(finishedTxs))
+			for i := range addresses {
+				addresses[i] = genesisAddress
+			}
+			if err := store.DbCache.MainChainStore.RemoveMainChainTxs(finishedTxs, addresses); err != nil {
+				log.Warn("[Verify] Remove finished deposit transactions failed:", err)
+				report.Repaired = false
+			}
+		}
+		if len(existedTxs) != 0 {
+			addresses := make([]string, len(existedTxs))
+			for i := range addresses {
+				addresses[i] = genesisAddress
+			}
+			heights := GetTransactionBlockHeights(txHashes[genesisAddress], txHeights[genesisAddress], existedTxs)
+			if err := store.TxsFinisherSingleton.FinishDepositTxs(true, existedTxs, addresses, heights, nil); err != nil {
+				log.Warn("[Verify] Finish existed deposit transactions failed:", err)
+				report.Repaired = false
+			}
+		}
+	}
+	return nil
+}
+
+func (ar *ArbitratorImpl) verifyWithdrawTxs(report *VerifyReport) error {
+	txHashes, err := store.DbCache.SideChainStore.GetAllSideChainTxHashes()
+	if err != nil {
+		return err
+	}
+
+	var pendingTxs, finishedTxs []string
+	for _, txHash := range txHashes {
+		finished, err := store.FinishedTxsDbCache.HasWithdrawTx(txHash)
+		if err != nil {
+			return err
+		}
+		if finished {
+			finishedTxs = append(finishedTxs, txHash)
+			report.WithdrawTxs = append(report.WithdrawTxs, &TxDiscrepancy{TransactionHash: txHash, Kind: TxFinished})
+		} else {
+			pendingTxs = append(pendingTxs, txHash)
+		}
+	}
+
+	var existedTxs []string
+	if len(pendingTxs) != 0 {
+		existedTxs, err = rpc.GetExistWithdrawTransactions(pendingTxs)
+		if err != nil {
+			report.Skipped = append(report.Skipped, "withdraws: "+err.Error())
+		}
+		for _, txHash := range existedTxs {
+			report.WithdrawTxs = append(report.WithdrawTxs, &TxDiscrepancy{TransactionHash: txHash, Kind: TxExisted})
+		}
+	}
+
+	if !report.Repair {
+		return nil
+	}
+	if len(finishedTxs) != 0 {
+		if err := store.DbCache.SideChainStore.RemoveSideChainTxs(finishedTxs); err != nil {
+			log.Warn("[Verify] Remove finished withdraw transactions failed:", err)
+			report.Repaired = false
+		}
+	}
+	if len(existedTxs) != 0 {
+		if err := store.TxsFinisherSingleton.FinishWithdrawTxs(true, existedTxs, "", nil, ""); err != nil {
+			log.Warn("[Verify] Finish existed withdraw transactions failed:", err)
+			report.Repaired = false
+		}
+	}
+	return nil
+}
@@ -0,0 +1,350 @@
+package arbitrator
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	. "github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/store"
+
+	"github.com/elastos/Elastos.ELA.SPV/bloom"
+	"github.com/elastos/Elastos.ELA/common"
+	. "github.com/elastos/Elastos.ELA/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+const verifyGenesisAddress = "XQd1DCi6H62NQdWZQhJCRnrPn7sF9CTjaU"
+
+// testNode is the main node answering the requests of Verify.
+type testNode struct {
+	height         uint32
+	utxos          []UTXOInfo
+	existWithdraws []string
+}
+
+// start points the main node rpc to the node and returns the function
+// stopping it.
+func (n *testNode) start(t *testing.T) func() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Error("Decode request error.")
+		}
+		var result interface{}
+		switch request["method"] {
+		case "getblockcount":
+			result = n.height + 1
+		case "listunspent":
+			result = n.utxos
+		case "getexistwithdrawtransactions":
+			result = n.existWithdraws
+		default:
+			t.Error("Unexpected request:", request["method"])
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      request["id"],
+			"result":  result,
+		})
+	}))
+
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	httpJsonPort, _ := strconv.Atoi(port)
+	rpcConfig := config.Parameters.MainNode.Rpc
+	config.Parameters.MainNode.Rpc = &config.RpcConfig{IpAddress: host, HttpJsonPort: httpJsonPort}
+	return func() {
+		config.Parameters.MainNode.Rpc = rpcConfig
+		server.Close()
+	}
+}
+
+type testUTXOStore struct {
+	store.DataStoreUTXO
+	height  uint32
+	utxos   []*store.AddressUTXO
+	deleted []*Input
+	added   []*store.AddressUTXO
+}
+
+func (s *testUTXOStore) CurrentHeight(height uint32) uint32 {
+	return s.height
+}
+
+func (s *testUTXOStore) GetAddressUTXOsFromGenesisBlockAddress(genesisBlockAddress string) ([]*store.AddressUTXO, error) {
+	return s.utxos, nil
+}
+
+func (s *testUTXOStore) DeleteUTXOs(inputs []*Input) error {
+	s.deleted = append(s.deleted, inputs...)
+	return nil
+}
+
+func (s *testUTXOStore) AddAddressUTXOs(utxos []*store.AddressUTXO) error {
+	s.added = append(s.added, utxos...)
+	return nil
+}
+
+type testMainChainStore struct {
+	store.DataStoreMainChain
+	txs     []*MainChainTransaction
+	removed []string
+}
+
+func (s *testMainChainStore) GetAllMainChainTxs() ([]*MainChainTransaction, error) {
+	return s.txs, nil
+}
+
+func (s *testMainChainStore) RemoveMainChainTxs(transactionHashes, genesisBlockAddress []string) error {
+	s.removed = append(s.removed, transactionHashes...)
+	return nil
+}
+
+type testSideChainStore struct {
+	store.DataStoreSideChain
+	txHashes []string
+	removed  []string
+}
+
+func (s *testSideChainStore) GetAllSideChainTxHashes() ([]string, error) {
+	return s.txHashes, nil
+}
+
+func (s *testSideChainStore) RemoveSideChainTxs(transactionHashes []string) error {
+	s.removed = append(s.removed, transactionHashes...)
+	return nil
+}
+
+type testFinishedTxsStore struct {
+	store.FinishedTransactionsDataStore
+	deposits  map[string]bool
+	withdraws map[string]bool
+}
+
+func (s *testFinishedTxsStore) HasDepositTx(transactionHash string, genesisBlockAddress string) (bool, error) {
+	return s.deposits[transactionHash], nil
+}
+
+func (s *testFinishedTxsStore) HasWithdrawTx(transactionHash string) (bool, error) {
+	return s.withdraws[transactionHash], nil
+}
+
+type testSideChainManager struct {
+	SideChainManager
+	sideChain SideChain
+}
+
+func (m *testSideChainManager) GetChain(key string) (SideChain, bool) {
+	if key != m.sideChain.GetKey() {
+		return nil, false
+	}
+	return m.sideChain, true
+}
+
+func (m *testSideChainManager) GetAllChains() []SideChain {
+	return []SideChain{m.sideChain}
+}
+
+// setupVerify replaces the stores with fakes holding the cache contents and
+// returns the arbitrator verifying them.
+func setupVerify(utxoStore *testUTXOStore, mainChainStore *testMainChainStore, sideChainStore *testSideChainStore,
+	finishedStore *testFinishedTxsStore, finisher *testTxsFinisher, sideChain SideChain) (*ArbitratorImpl, func()) {
+	dbCache, finishedTxsDbCache, txsFinisher := store.DbCache, store.FinishedTxsDbCache, store.TxsFinisherSingleton
+	store.DbCache = store.DataStoreImpl{
+		UTXOStore:      utxoStore,
+		MainChainStore: mainChainStore,
+		SideChainStore: sideChainStore,
+	}
+	store.FinishedTxsDbCache = finishedStore
+	store.TxsFinisherSingleton = finisher
+
+	ar := &ArbitratorImpl{}
+	ar.SetSideChainManager(&testSideChainManager{sideChain: sideChain})
+	return ar, func() {
+		store.DbCache, store.FinishedTxsDbCache, store.TxsFinisherSingleton = dbCache, finishedTxsDbCache, txsFinisher
+	}
+}
+
+func TestGetNodeUTXOs(t *testing.T) {
+	txID := common.Uint256{1, 2, 3}
+	node := &testNode{utxos: []UTXOInfo{
+		{Txid: common.BytesToHexString(common.BytesReverse(txID.Bytes())), VOut: 1, Amount: "1", OutputLock: 10},
+		{Txid: common.BytesToHexString(common.BytesReverse(txID.Bytes())), VOut: 2, Amount: "0"},
+	}}
+	defer node.start(t)()
+
+	utxos, err := getNodeUTXOs(verifyGenesisAddress)
+	assert.NoError(t, err)
+	// The node lists transaction ids in reversed byte order
+	utxo, ok := utxos[OutPoint{TxID: txID, Index: 1}]
+	if assert.True(t, ok) {
+		assert.Equal(t, common.Fixed64(100000000), *utxo.Amount)
+		assert.Equal(t, uint32(10), utxo.Input.Sequence)
+		assert.Equal(t, verifyGenesisAddress, utxo.GenesisBlockAddress)
+	}
+	// Empty utxos are not cached
+	assert.Equal(t, 1, len(utxos))
+}
+
+func TestVerifyUTXOs(t *testing.T) {
+	txID := common.Uint256{1, 2, 3}
+	nodeTxID := common.BytesToHexString(common.BytesReverse(txID.Bytes()))
+	amount := common.Fixed64(100000000)
+	cached := &store.AddressUTXO{
+		Input:               &Input{Previous: OutPoint{TxID: txID, Index: 1}},
+		Amount:              &amount,
+		GenesisBlockAddress: verifyGenesisAddress,
+	}
+
+	tests := []struct {
+		name        string
+		cacheHeight uint32
+		cached      []*store.AddressUTXO
+		node        []UTXOInfo
+		kinds       []string
+		skipped     bool
+		deleted     int
+		added       int
+	}{
+		{
+			name:   "consistent",
+			cached: []*store.AddressUTXO{cached},
+			node:   []UTXOInfo{{Txid: nodeTxID, VOut: 1, Amount: "1"}},
+		},
+		{
+			name:    "spent",
+			cached:  []*store.AddressUTXO{cached},
+			kinds:   []string{UTXOSpent},
+			deleted: 1,
+		},
+		{
+			name:    "mismatched amount",
+			cached:  []*store.AddressUTXO{cached},
+			node:    []UTXOInfo{{Txid: nodeTxID, VOut: 1, Amount: "2"}},
+			kinds:   []string{UTXOMismatched},
+			deleted: 1,
+			added:   1,
+		},
+		{
+			name:    "mismatched lock",
+			cached:  []*store.AddressUTXO{cached},
+			node:    []UTXOInfo{{Txid: nodeTxID, VOut: 1, Amount: "1", OutputLock: 10}},
+			kinds:   []string{UTXOMismatched},
+			deleted: 1,
+			added:   1,
+		},
+		{
+			name:  "missing",
+			node:  []UTXOInfo{{Txid: nodeTxID, VOut: 1, Amount: "1"}},
+			kinds: []string{UTXOMissing},
+			added: 1,
+		},
+		{
+			name:        "syncing",
+			cacheHeight: 99,
+			node:        []UTXOInfo{{Txid: nodeTxID, VOut: 1, Amount: "1"}},
+			skipped:     true,
+		},
+	}
+
+	for _, test := range tests {
+		for _, repair := range []bool{false, true} {
+			node := &testNode{height: 100, utxos: test.node}
+			stopNode := node.start(t)
+			cacheHeight := test.cacheHeight
+			if cacheHeight == 0 {
+				cacheHeight = node.height
+			}
+			utxoStore := &testUTXOStore{height: cacheHeight, utxos: test.cached}
+			ar, teardown := setupVerify(utxoStore, &testMainChainStore{}, &testSideChainStore{},
+				&testFinishedTxsStore{}, &testTxsFinisher{}, &testSideChain{})
+
+			report, err := ar.Verify(repair)
+			teardown()
+			stopNode()
+			if !assert.NoError(t, err, test.name) {
+				continue
+			}
+
+			var kinds []string
+			for _, discrepancy := range report.UTXOs {
+				kinds = append(kinds, discrepancy.Kind)
+				assert.Equal(t, txID.String(), discrepancy.TransactionHash, test.name)
+			}
+			assert.Equal(t, test.kinds, kinds, test.name)
+			assert.Equal(t, test.skipped, len(report.Skipped) != 0, test.name)
+			assert.Equal(t, len(test.kinds) == 0 && !test.skipped, report.Consistent(), test.name)
+			if repair {
+				assert.Equal(t, test.deleted, len(utxoStore.deleted), test.name)
+				assert.Equal(t, test.added, len(utxoStore.added), test.name)
+				assert.True(t, report.Repaired, test.name)
+			} else {
+				assert.Equal(t, 0, len(utxoStore.deleted)+len(utxoStore.added), test.name)
+			}
+		}
+	}
+}
+
+func TestVerifyPendingTxs(t *testing.T) {
+	for _, repair := range []bool{false, true} {
+		node := &testNode{existWithdraws: []string{"withdraw3"}}
+		stopNode := node.start(t)
+
+		// 1 is pending, 2 is finished, and 3 is packed by the target chain
+		mainChainStore := &testMainChainStore{}
+		for i, txHash := range []string{"deposit1", "deposit2", "deposit3"} {
+			mainChainStore.txs = append(mainChainStore.txs, &MainChainTransaction{
+				TransactionHash:     txHash,
+				GenesisBlockAddress: verifyGenesisAddress,
+				Proof:               &bloom.MerkleProof{Height: uint32(i + 10)},
+			})
+		}
+		sideChainStore := &testSideChainStore{txHashes: []string{"withdraw1", "withdraw2", "withdraw3"}}
+		finishedStore := &testFinishedTxsStore{
+			deposits:  map[string]bool{"deposit2": true},
+			withdraws: map[string]bool{"withdraw2": true},
+		}
+		finisher := &testTxsFinisher{}
+		sideChain := &testSideChain{existDepositTxs: []string{"deposit3"}}
+		ar, teardown := setupVerify(&testUTXOStore{}, mainChainStore, sideChainStore, finishedStore, finisher,
+			sideChain)
+
+		report, err := ar.Verify(repair)
+		teardown()
+		stopNode()
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		assert.Equal(t, []*TxDiscrepancy{
+			{TransactionHash: "deposit2", GenesisBlockAddress: verifyGenesisAddress, Kind: TxFinished},
+			{TransactionHash: "deposit3", GenesisBlockAddress: verifyGenesisAddress, Kind: TxExisted},
+		}, report.DepositTxs)
+		assert.Equal(t, []*TxDiscrepancy{
+			{TransactionHash: "withdraw2", Kind: TxFinished},
+			{TransactionHash: "withdraw3", Kind: TxExisted},
+		}, report.WithdrawTxs)
+		// Only pending transactions are checked against the target chains
+		assert.Equal(t, []string{"deposit1", "deposit3"}, sideChain.checkedDepositTxs)
+
+		if !repair {
+			assert.Nil(t, mainChainStore.removed)
+			assert.Nil(t, sideChainStore.removed)
+			assert.Nil(t, finisher.succeedDepositTxs)
+			assert.Nil(t, finisher.succeedWithdrawTxs)
+			continue
+		}
+		// Finished transactions are removed from the caches, and the existed
+		// ones are finished as succeed
+		assert.Equal(t, []string{"deposit2"}, mainChainStore.removed)
+		assert.Equal(t, []string{"withdraw2"}, sideChainStore.removed)
+		assert.Equal(t, []string{"deposit3"}, finisher.succeedDepositTxs)
+		assert.Equal(t, []uint32{12}, finisher.depositHeights)
+		assert.Equal(t, []string{"withdraw3"}, finisher.succeedWithdrawTxs)
+		assert.True(t, report.Repaired)
+	}
+}
@@ -0,0 +1,78 @@
+package arbitrator
+
+import (
+	"bytes"
+
+	. "github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+
+	. "github.com/elastos/Elastos.ELA/core/types"
+)
+
+const (
+	// withdrawTxBaseSize covers the transaction type, payload version, block
+	// height and genesis address of the payload, the nonce attribute, the
+	// lock time and the var ints of the transaction
+	withdrawTxBaseSize = 128
+
+	sideChainTxHashSize = 32
+	withdrawOutputSize  = 65
+	withdrawInputSize   = 38
+	publicKeyScriptSize = 34
+	signatureScriptSize = 65
+)
+
+// EstimateWithdrawTransactionSize returns the serialized size of a withdraw
+// transaction with the given number of side chain transactions, outputs
+// and inputs, including the change output and the multi-sign program signed
+// by every arbiter.
+func EstimateWithdrawTransactionSize(sideChainTxCount, outputCount, inputCount int) int {
+	return withdrawTxBaseSize +
+		sideChainTxCount*sideChainTxHashSize +
+		(outputCount+1)*withdrawOutputSize +
+		inputCount*withdrawInputSize +
+		estimateProgramSize()
+}
+
+func estimateProgramSize() int {
+	arbitratorsCount := ArbitratorGroupSingleton.GetArbitratorsCount()
+	// OP_M, public keys, OP_N and OP_CHECKMULTISIG
+	redeemScriptSize := 3 + arbitratorsCount*publicKeyScriptSize
+	return redeemScriptSize + arbitratorsCount*signatureScriptSize
+}
+
+// GetWithdrawTransactionSize returns the serialized size of an unsigned
+// withdraw transaction after it is signed by every arbiter.
+func GetWithdrawTransactionSize(txn *Transaction) int {
+	buf := new(bytes.Buffer)
+	if err := txn.Serialize(buf); err != nil {
+		return 0
+	}
+	return buf.Len() + ArbitratorGroupSingleton.GetArbitratorsCount()*signatureScriptSize
+}
+
+// splitWithdrawTxs divides the side chain withdraw transactions into batches
+// limited by the number of side chain transactions, the number of outputs and
+// the estimated size, each batch is built into one withdraw transaction.
+func splitWithdrawTxs(withdrawTxs []*WithdrawTx) [][]*WithdrawTx {
+	var batches [][]*WithdrawTx
+	var batch []*WithdrawTx
+	var outputCount int
+	for _, tx := range withdrawTxs {
+		txOutputCount := len(tx.WithdrawInfo.WithdrawAssets)
+		if len(batch) > 0 && (len(batch)+1 > config.Parameters.WithdrawBatchMaxTxs ||
+			outputCount+txOutputCount > config.Parameters.WithdrawBatchMaxOutputs ||
+			EstimateWithdrawTransactionSize(len(batch)+1, outputCount+txOutputCount, 0) >
+				config.Parameters.WithdrawBatchMaxSize) {
+			batches = append(batches, batch)
+			batch = nil
+			outputCount = 0
+		}
+		batch = append(batch, tx)
+		outputCount += txOutputCount
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
@@ -0,0 +1,73 @@
+package arbitrator
+
+import (
+	"fmt"
+
+	. "github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+	"github.com/elastos/Elastos.ELA.Arbiter/store"
+
+	"github.com/elastos/Elastos.ELA/common"
+)
+
+// GetWithdrawFee returns the fee in main chain sela paid by the withdraw
+// assets, which is the difference between the amount destroyed on side chain
+// and the cross chain amount, converted by the exchange rate.
+func GetWithdrawFee(withdrawInfo *WithdrawInfo, exchangeRate float64) common.Fixed64 {
+	var fee common.Fixed64
+	for _, withdraw := range withdrawInfo.WithdrawAssets {
+		fee += common.Fixed64(float64(*withdraw.Amount)/exchangeRate) -
+			common.Fixed64(float64(*withdraw.CrossChainAmount)/exchangeRate)
+	}
+	return fee
+}
+
+// GetRequiredWithdrawFee returns the minimum fee of a withdraw transaction
+// with the given serialized size according to the configured fee rate.
+func GetRequiredWithdrawFee(size int) common.Fixed64 {
+	return common.Fixed64((int64(size)*config.Parameters.WithdrawFeeRate + 999) / 1000)
+}
+
+// InsufficientFeeError is returned when the fee paid by the side chain
+// transactions can not cover the size of the withdraw transaction built from
+// them.
+type InsufficientFeeError struct {
+	Fee      common.Fixed64
+	Required common.Fixed64
+}
+
+func (e *InsufficientFeeError) Error() string {
+	return fmt.Sprintf("insufficient fee: paid %s, required %s at %d sela/KB",
+		e.Fee.String(), e.Required.String(), config.Parameters.WithdrawFeeRate)
+}
+
+// filterUnderpaidWithdrawTxs removes the side chain transactions whose fee
+// can not cover a withdraw transaction built from it alone, the removed
+// transactions are recorded as failed with the reason.
+func filterUnderpaidWithdrawTxs(withdrawTxs []*WithdrawTx, exchangeRate float64) []*WithdrawTx {
+	var result []*WithdrawTx
+	for _, tx := range withdrawTxs {
+		fee := GetWithdrawFee(tx.WithdrawInfo, exchangeRate)
+		required := GetRequiredWithdrawFee(
+			EstimateWithdrawTransactionSize(1, len(tx.WithdrawInfo.WithdrawAssets), 1))
+		if fee >= required {
+			result = append(result, tx)
+			continue
+		}
+		finishUnderpaidWithdrawTx(tx, &InsufficientFeeError{Fee: fee, Required: required})
+	}
+	return result
+}
+
+// finishUnderpaidWithdrawTx records the side chain transaction as failed, so
+// it is not proposed again.
+func finishUnderpaidWithdrawTx(tx *WithdrawTx, feeErr *InsufficientFeeError) {
+	reason := feeErr.Error()
+	log.Warn("Side chain transaction", tx.Txid.String(), reason)
+
+	txHashes := []string{tx.Txid.String()}
+	if err := store.TxsFinisherSingleton.FinishWithdrawTxs(false, txHashes, "", nil, reason); err != nil {
+		log.Warn("Move underpaid side chain transaction into finished db failed, txHash:", tx.Txid.String(), "err:", err)
+	}
+}
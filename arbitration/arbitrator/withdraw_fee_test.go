@@ -0,0 +1,130 @@
+package arbitrator
+
+import (
+	"os"
+	"testing"
+
+	. "github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/store"
+
+	"github.com/elastos/Elastos.ELA/common"
+	. "github.com/elastos/Elastos.ELA/core/types"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+)
+
+func TestMain(m *testing.M) {
+	config.InitMockConfig()
+	Init()
+	os.Exit(m.Run())
+}
+
+// testMainChain fails the withdraw transactions containing an underpaid side
+// chain transaction, as the fee check of the real main chain does once the
+// inputs are selected.
+type testMainChain struct {
+	MainChain
+	underpaid map[string]bool
+}
+
+func (mc *testMainChain) CreateWithdrawTransaction(sideChain SideChain, withdrawInfo *WithdrawInfo,
+	sideChainTransactionHashes []string, mcFunc MainChainFunc) (*Transaction, error) {
+	for _, hash := range sideChainTransactionHashes {
+		if mc.underpaid[hash] {
+			return nil, &InsufficientFeeError{Fee: 10, Required: 100}
+		}
+	}
+	return &Transaction{
+		TxType:  WithdrawFromSideChain,
+		Payload: &payload.PayloadWithdrawFromSideChain{GenesisBlockAddress: sideChain.GetKey()},
+	}, nil
+}
+
+type testSideChain struct {
+	SideChain
+	existDepositTxs   []string
+	checkedDepositTxs []string
+}
+
+func (sc *testSideChain) GetKey() string {
+	return "XQd1DCi6H62NQdWZQhJCRnrPn7sF9CTjaU"
+}
+
+func (sc *testSideChain) GetExchangeRate() (float64, error) {
+	return 1.0, nil
+}
+
+func (sc *testSideChain) AddLastUsedOutPoints(ops []OutPoint) {
+}
+
+func (sc *testSideChain) GetExistDepositTransactions(txs []string) ([]string, error) {
+	sc.checkedDepositTxs = append(sc.checkedDepositTxs, txs...)
+	return sc.existDepositTxs, nil
+}
+
+type testTxsFinisher struct {
+	store.TxsFinisher
+	failedWithdrawTxs  []string
+	reasons            []string
+	succeedWithdrawTxs []string
+	succeedDepositTxs  []string
+	depositHeights     []uint32
+}
+
+func (s *testTxsFinisher) FinishDepositTxs(succeed bool, transactionHashes, genesisBlockAddresses []string,
+	blockHeights []uint32, sideChainTxHashes []string) error {
+	if succeed {
+		s.succeedDepositTxs = append(s.succeedDepositTxs, transactionHashes...)
+		s.depositHeights = append(s.depositHeights, blockHeights...)
+	}
+	return nil
+}
+
+func (s *testTxsFinisher) FinishWithdrawTxs(succeed bool, transactionHashes []string, mainChainTxHash string,
+	transactionByte []byte, reason string) error {
+	if succeed {
+		s.succeedWithdrawTxs = append(s.succeedWithdrawTxs, transactionHashes...)
+	} else {
+		s.failedWithdrawTxs = append(s.failedWithdrawTxs, transactionHashes...)
+		s.reasons = append(s.reasons, reason)
+	}
+	return nil
+}
+
+func TestCreateWithdrawTransactions_Underpaid(t *testing.T) {
+	config.Parameters.WithdrawFeeRate = 0
+	config.Parameters.WithdrawBatchMaxTxs = 100
+	config.Parameters.WithdrawBatchMaxOutputs = 1000
+	config.Parameters.WithdrawBatchMaxSize = 100000
+
+	finisher := &testTxsFinisher{}
+	store.TxsFinisherSingleton = finisher
+
+	var withdrawTxs []*WithdrawTx
+	for i := 0; i < 5; i++ {
+		amount := common.Fixed64(100000)
+		withdrawTxs = append(withdrawTxs, &WithdrawTx{
+			Txid: &common.Uint256{byte(i + 1)},
+			WithdrawInfo: &WithdrawInfo{WithdrawAssets: []*WithdrawAsset{{
+				TargetAddress:    "8VYXVxKKSAxkmRrfmGpQR2Kc66XhG6m3ta",
+				Amount:           &amount,
+				CrossChainAmount: &amount,
+			}}},
+		})
+	}
+	underpaidHash := withdrawTxs[2].Txid.String()
+
+	ar := &ArbitratorImpl{}
+	ar.SetMainChain(&testMainChain{underpaid: map[string]bool{underpaidHash: true}})
+	txns := ar.CreateWithdrawTransactions(withdrawTxs, &testSideChain{}, &DbMainChainFunc{})
+
+	if len(txns) == 0 {
+		t.Error("Withdraw transactions of the other side chain transactions should be created.")
+	}
+	if len(finisher.failedWithdrawTxs) != 1 || finisher.failedWithdrawTxs[0] != underpaidHash {
+		t.Error("Only the underpaid side chain transaction should be finished as failed.")
+	}
+	if len(finisher.reasons) != 1 || finisher.reasons[0] != (&InsufficientFeeError{Fee: 10, Required: 100}).Error() {
+		t.Error("Failed reason should be the fee shortfall.")
+	}
+}
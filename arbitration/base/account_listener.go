@@ -12,6 +12,7 @@ type AccountListener interface {
 	UpdateLastSubmitAuxpowHeight(genesisBlockHash common.Uint256)
 
 	SendCachedWithdrawTxs()
+	SendWithdrawTxs(txHashes []string)
 }
 
 type AccountMonitor interface {
@@ -0,0 +1,36 @@
+package base
+
+type PeerInfo struct {
+	ID           uint64
+	Addr         string
+	Arbiter      string
+	Version      uint32
+	Capabilities uint64
+	Score        int
+	Messages     uint64
+	Duplicates   uint64
+	ConnTime     int64
+}
+
+type MessageCacheInfo struct {
+	Size        int
+	Capacity    int
+	Hits        uint64
+	Misses      uint64
+	Evictions   uint64
+	Expirations uint64
+}
+
+type ArbiterConnection struct {
+	PublicKey string
+	Address   string
+	PeerAddr  string
+	Connected bool
+	Retries   uint32
+	NextRetry int64
+}
+
+type BannedPeer struct {
+	Host  string
+	Until int64
+}
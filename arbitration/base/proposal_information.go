@@ -0,0 +1,40 @@
+package base
+
+const (
+	ProposalPending   = "pending"
+	ProposalCompleted = "completed"
+	ProposalAbandoned = "abandoned"
+	ProposalExpired   = "expired"
+)
+
+type ProposalInfo struct {
+	TransactionHash     string
+	GenesisBlockAddress string
+	Deadline            int64
+	Broadcasts          uint32
+	Signers             []string
+	NonResponders       []string
+}
+
+type ProposalMetrics struct {
+	Pending      int
+	Created      uint64
+	Completed    uint64
+	Rebroadcasts uint64
+	Abandoned    uint64
+	Rejections   map[string]uint64
+}
+
+type ProposalSigner struct {
+	PublicKey string
+	Time      int64
+	Reason    string
+}
+
+type ProposalStatus struct {
+	TransactionHash string
+	Status          string
+	Approved        []*ProposalSigner
+	Rejected        []*ProposalSigner
+	NonResponders   []string
+}
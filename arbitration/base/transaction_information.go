@@ -43,6 +43,15 @@ type SideChainTransaction struct {
 	BlockHeight         uint32
 }
 
+type WithdrawProposal struct {
+	TransactionHash     string
+	GenesisBlockAddress string
+	Transaction         []byte
+	RedeemScript        []byte
+	Signatures          []byte
+	CreationHeight      uint32
+}
+
 func (info *WithdrawInfo) Serialize(w io.Writer) error {
 	if err := common.WriteVarUint(w, uint64(len(info.WithdrawAssets))); err != nil {
 		return errors.New("[Serialize] write len withdraw assets failed")
@@ -28,6 +28,14 @@ func PublicKeyFromString(str string) (*crypto.PublicKey, error) {
 	return publicKey, nil
 }
 
+func PublicKeyToString(key *crypto.PublicKey) (string, error) {
+	keyBytes, err := key.EncodePoint(true)
+	if err != nil {
+		return "", err
+	}
+	return BytesToHexString(keyBytes), nil
+}
+
 func StandardAcccountPublicKeyToProgramHash(key *crypto.PublicKey) (*Uint168, error) {
 	c, err := contract.CreateStandardContractByPubKey(key)
 	if err != nil {
@@ -113,6 +121,21 @@ func SubstractTransactionHashesAndBlockHeights(hashSet []string, blockHeights []
 	return resultTxHashes, resultBlockHeights
 }
 
+func GetTransactionBlockHeights(hashSet []string, blockHeights []uint32, subSet []string) []uint32 {
+	var result []uint32
+	for _, hash := range subSet {
+		var height uint32
+		for i := 0; i < len(hashSet); i++ {
+			if hashSet[i] == hash {
+				height = blockHeights[i]
+				break
+			}
+		}
+		result = append(result, height)
+	}
+	return result
+}
+
 func hasHash(hashSet []string, hash string) bool {
 	for _, item := range hashSet {
 		if item == hash {
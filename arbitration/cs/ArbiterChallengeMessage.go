@@ -0,0 +1,47 @@
+package cs
+
+import (
+	"io"
+
+	"github.com/elastos/Elastos.ELA/common"
+)
+
+const MaxArbiterChallengeMessageDataSize = 100
+
+// ArbiterChallengeMessage is sent to every new peer with a random challenge,
+// the arbiter of the peer signs the challenge in its hello message, so the
+// hello message can not be replayed on other connections.
+type ArbiterChallengeMessage struct {
+	Command   string
+	Challenge []byte
+	MessageVersion
+}
+
+func (msg *ArbiterChallengeMessage) CMD() string {
+	return msg.Command
+}
+
+func (msg *ArbiterChallengeMessage) MaxLength() uint32 {
+	return MaxArbiterChallengeMessageDataSize
+}
+
+func (msg *ArbiterChallengeMessage) Serialize(w io.Writer) error {
+	err := msg.serializeVersion(w)
+	if err != nil {
+		return err
+	}
+	return common.WriteVarBytes(w, msg.Challenge)
+}
+
+func (msg *ArbiterChallengeMessage) Deserialize(r io.Reader) error {
+	supported, err := msg.deserializeVersion(r)
+	if err != nil || !supported {
+		return err
+	}
+	challenge, err := common.ReadVarBytes(r, MaxArbiterChallengeMessageDataSize, "Challenge")
+	if err != nil {
+		return err
+	}
+	msg.Challenge = challenge
+	return nil
+}
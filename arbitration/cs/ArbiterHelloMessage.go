@@ -0,0 +1,77 @@
+package cs
+
+import (
+	"io"
+
+	"github.com/elastos/Elastos.ELA/common"
+)
+
+const MaxArbiterHelloMessageDataSize = 1000
+
+// ArbiterHelloMessage answers the challenge of a new peer, so the peer knows
+// which arbiter it is connected to and can send messages to the arbiter
+// directly. It also carries the latest protocol version and the capabilities
+// of the arbiter, the message itself is always in MinProtocolVersion.
+type ArbiterHelloMessage struct {
+	Command         string
+	Challenge       []byte
+	ProtocolVersion uint32
+	Capabilities    uint64
+	MessageVersion
+	Envelope
+}
+
+func (msg *ArbiterHelloMessage) CMD() string {
+	return msg.Command
+}
+
+func (msg *ArbiterHelloMessage) MaxLength() uint32 {
+	return MaxArbiterHelloMessageDataSize
+}
+
+func (msg *ArbiterHelloMessage) SerializeUnsigned(w io.Writer) error {
+	err := msg.serializeVersion(w)
+	if err != nil {
+		return err
+	}
+	err = common.WriteVarBytes(w, msg.Challenge)
+	if err != nil {
+		return err
+	}
+	err = common.WriteUint32(w, msg.ProtocolVersion)
+	if err != nil {
+		return err
+	}
+	return common.WriteUint64(w, msg.Capabilities)
+}
+
+func (msg *ArbiterHelloMessage) Serialize(w io.Writer) error {
+	err := msg.SerializeUnsigned(w)
+	if err != nil {
+		return err
+	}
+	return msg.Envelope.Serialize(w)
+}
+
+func (msg *ArbiterHelloMessage) Deserialize(r io.Reader) error {
+	supported, err := msg.deserializeVersion(r)
+	if err != nil || !supported {
+		return err
+	}
+	challenge, err := common.ReadVarBytes(r, MaxArbiterChallengeMessageDataSize, "Challenge")
+	if err != nil {
+		return err
+	}
+	msg.Challenge = challenge
+	protocolVersion, err := common.ReadUint32(r)
+	if err != nil {
+		return err
+	}
+	msg.ProtocolVersion = protocolVersion
+	capabilities, err := common.ReadUint64(r)
+	if err != nil {
+		return err
+	}
+	msg.Capabilities = capabilities
+	return msg.Envelope.Deserialize(r)
+}
@@ -17,6 +17,8 @@ type GetLastArbiterUsedUTXOMessage struct {
 	GenesisAddress string
 	Height         uint32
 	Nonce          string
+	MessageVersion
+	Envelope
 }
 
 func (msg *GetLastArbiterUsedUTXOMessage) CMD() string {
@@ -27,8 +29,12 @@ func (msg *GetLastArbiterUsedUTXOMessage) MaxLength() uint32 {
 	return MaxGetUsedUTXOMessageDataSize
 }
 
-func (msg *GetLastArbiterUsedUTXOMessage) Serialize(w io.Writer) error {
-	err := common.WriteVarString(w, msg.GenesisAddress)
+func (msg *GetLastArbiterUsedUTXOMessage) SerializeUnsigned(w io.Writer) error {
+	err := msg.serializeVersion(w)
+	if err != nil {
+		return err
+	}
+	err = common.WriteVarString(w, msg.GenesisAddress)
 	if err != nil {
 		return err
 	}
@@ -43,7 +49,19 @@ func (msg *GetLastArbiterUsedUTXOMessage) Serialize(w io.Writer) error {
 	return nil
 }
 
+func (msg *GetLastArbiterUsedUTXOMessage) Serialize(w io.Writer) error {
+	err := msg.SerializeUnsigned(w)
+	if err != nil {
+		return err
+	}
+	return msg.Envelope.Serialize(w)
+}
+
 func (msg *GetLastArbiterUsedUTXOMessage) Deserialize(r io.Reader) error {
+	supported, err := msg.deserializeVersion(r)
+	if err != nil || !supported {
+		return err
+	}
 	genesisAddress, err := common.ReadVarString(r)
 	if err != nil {
 		return err
@@ -59,7 +77,7 @@ func (msg *GetLastArbiterUsedUTXOMessage) Deserialize(r io.Reader) error {
 		return err
 	}
 	msg.Nonce = nonce
-	return nil
+	return msg.Envelope.Deserialize(r)
 }
 
 type SendLastArbiterUsedUTXOMessage struct {
@@ -68,6 +86,8 @@ type SendLastArbiterUsedUTXOMessage struct {
 	Height         uint32
 	OutPoints      []types.OutPoint
 	Nonce          string
+	MessageVersion
+	Envelope
 }
 
 func (msg *SendLastArbiterUsedUTXOMessage) CMD() string {
@@ -78,8 +98,12 @@ func (msg *SendLastArbiterUsedUTXOMessage) MaxLength() uint32 {
 	return MaxSendUsedUTXOMessageDataSize
 }
 
-func (msg *SendLastArbiterUsedUTXOMessage) Serialize(w io.Writer) error {
-	err := common.WriteVarString(w, msg.GenesisAddress)
+func (msg *SendLastArbiterUsedUTXOMessage) SerializeUnsigned(w io.Writer) error {
+	err := msg.serializeVersion(w)
+	if err != nil {
+		return err
+	}
+	err = common.WriteVarString(w, msg.GenesisAddress)
 	if err != nil {
 		return err
 	}
@@ -104,7 +128,19 @@ func (msg *SendLastArbiterUsedUTXOMessage) Serialize(w io.Writer) error {
 	return nil
 }
 
+func (msg *SendLastArbiterUsedUTXOMessage) Serialize(w io.Writer) error {
+	err := msg.SerializeUnsigned(w)
+	if err != nil {
+		return err
+	}
+	return msg.Envelope.Serialize(w)
+}
+
 func (msg *SendLastArbiterUsedUTXOMessage) Deserialize(r io.Reader) error {
+	supported, err := msg.deserializeVersion(r)
+	if err != nil || !supported {
+		return err
+	}
 	genesisAddress, err := common.ReadVarString(r)
 	if err != nil {
 		return err
@@ -135,5 +171,5 @@ func (msg *SendLastArbiterUsedUTXOMessage) Deserialize(r io.Reader) error {
 		return err
 	}
 	msg.Nonce = nonce
-	return nil
+	return msg.Envelope.Deserialize(r)
 }
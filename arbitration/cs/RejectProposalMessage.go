@@ -0,0 +1,131 @@
+package cs
+
+import (
+	"io"
+
+	"github.com/elastos/Elastos.ELA/common"
+)
+
+const (
+	MaxRejectProposalMessageDataSize = 1000
+	MaxRejectDetailLength            = 256
+
+	maxPublicKeyLength = 65
+	maxSignatureLength = 128
+)
+
+type RejectReason uint32
+
+const (
+	RejectUnknown RejectReason = iota
+	RejectInvalidPayload
+	RejectUnknownSideChain
+	RejectUnknownSideChainTx
+	RejectInvalidInputs
+	RejectInvalidOutputs
+	RejectInvalidExchangeRate
+	RejectSignFailed
+)
+
+var rejectReasonStrings = map[RejectReason]string{
+	RejectUnknown:             "Unknown",
+	RejectInvalidPayload:      "InvalidPayload",
+	RejectUnknownSideChain:    "UnknownSideChain",
+	RejectUnknownSideChainTx:  "UnknownSideChainTx",
+	RejectInvalidInputs:       "InvalidInputs",
+	RejectInvalidOutputs:      "InvalidOutputs",
+	RejectInvalidExchangeRate: "InvalidExchangeRate",
+	RejectSignFailed:          "SignFailed",
+}
+
+func (reason RejectReason) String() string {
+	if str, ok := rejectReasonStrings[reason]; ok {
+		return str
+	}
+	return rejectReasonStrings[RejectUnknown]
+}
+
+// RejectError is returned when a proposal fails the checks of current
+// arbiter, it carries the reason code sent back to the proposer.
+type RejectError struct {
+	Reason  RejectReason
+	message string
+}
+
+func (e *RejectError) Error() string {
+	return e.message
+}
+
+func newRejectError(reason RejectReason, message string) error {
+	return &RejectError{Reason: reason, message: message}
+}
+
+func getRejectReason(err error) RejectReason {
+	if rejectErr, ok := err.(*RejectError); ok {
+		return rejectErr.Reason
+	}
+	return RejectUnknown
+}
+
+type RejectProposalMessage struct {
+	Command         string
+	TransactionHash common.Uint256
+	Reason          RejectReason
+	Detail          string
+	MessageVersion
+	Envelope
+}
+
+func (msg *RejectProposalMessage) CMD() string {
+	return msg.Command
+}
+
+func (msg *RejectProposalMessage) MaxLength() uint32 {
+	return MaxRejectProposalMessageDataSize
+}
+
+func (msg *RejectProposalMessage) SerializeUnsigned(w io.Writer) error {
+	err := msg.serializeVersion(w)
+	if err != nil {
+		return err
+	}
+	err = msg.TransactionHash.Serialize(w)
+	if err != nil {
+		return err
+	}
+	err = common.WriteUint32(w, uint32(msg.Reason))
+	if err != nil {
+		return err
+	}
+	return common.WriteVarString(w, msg.Detail)
+}
+
+func (msg *RejectProposalMessage) Serialize(w io.Writer) error {
+	err := msg.SerializeUnsigned(w)
+	if err != nil {
+		return err
+	}
+	return msg.Envelope.Serialize(w)
+}
+
+func (msg *RejectProposalMessage) Deserialize(r io.Reader) error {
+	supported, err := msg.deserializeVersion(r)
+	if err != nil || !supported {
+		return err
+	}
+	err = msg.TransactionHash.Deserialize(r)
+	if err != nil {
+		return err
+	}
+	reason, err := common.ReadUint32(r)
+	if err != nil {
+		return err
+	}
+	msg.Reason = RejectReason(reason)
+	detail, err := common.ReadVarString(r)
+	if err != nil {
+		return err
+	}
+	msg.Detail = detail
+	return msg.Envelope.Deserialize(r)
+}
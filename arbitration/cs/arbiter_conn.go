@@ -0,0 +1,223 @@
+package cs
+
+import (
+	"time"
+
+	. "github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
+	. "github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+
+	"github.com/elastos/Elastos.ELA/p2p/server"
+)
+
+const (
+	defaultArbiterConnectInterval = 10 * time.Second
+
+	// maxReconnectBackoff is the longest time to wait before dialing an
+	// unreachable arbiter again
+	maxReconnectBackoff = 10 * time.Minute
+)
+
+// p2pServer is the p2p server able to dial an address. The server created by
+// server.NewServer is assigned to a p2pServer in InitP2PClient, so the build
+// fails if the server can not dial peers.
+type p2pServer interface {
+	server.IServer
+	ConnectPeer(addr string, permanent bool)
+}
+
+// arbiterConn is the outbound connection state to a configured arbiter.
+type arbiterConn struct {
+	publicKey string
+	address   string
+	retries   uint32
+	nextRetry time.Time
+}
+
+// getArbiterAddresses returns the configured addresses of the arbiters by
+// their public keys.
+func getArbiterAddresses() map[string]string {
+	addresses := make(map[string]string)
+	for _, arbiter := range config.Parameters.ArbiterPeers {
+		publicKey, err := PublicKeyFromString(arbiter.PublicKey)
+		if err != nil {
+			log.Warn("[getArbiterAddresses] Invalid arbiter public key:", arbiter.PublicKey)
+			continue
+		}
+		key, err := PublicKeyToString(publicKey)
+		if err != nil {
+			continue
+		}
+		addresses[key] = arbiter.Address
+	}
+	return addresses
+}
+
+// getSeeds returns the seeds together with the configured addresses of the
+// arbiters, which are dialed when the p2p server starts.
+func getSeeds() []string {
+	seeds := make([]string, 0, len(config.Parameters.SeedList)+len(config.Parameters.ArbiterPeers))
+	seeds = append(seeds, config.Parameters.SeedList...)
+	for _, arbiter := range config.Parameters.ArbiterPeers {
+		seeds = append(seeds, arbiter.Address)
+	}
+	return seeds
+}
+
+// getCurrentArbiters returns the public keys of current arbiter group in the
+// form used to identify the arbiters of peers.
+func getCurrentArbiters() []string {
+	var arbiters []string
+	for _, arbiter := range ArbitratorGroupSingleton.GetAllArbitrators() {
+		publicKey, err := PublicKeyFromString(arbiter)
+		if err != nil {
+			continue
+		}
+		key, err := PublicKeyToString(publicKey)
+		if err != nil {
+			continue
+		}
+		arbiters = append(arbiters, key)
+	}
+	return arbiters
+}
+
+// arbiterConnHandler keeps outbound connections to the other arbiters of
+// current arbiter group, and warns if not enough arbiters are reachable to
+// sign withdraw transactions.
+func (c *p2pclient) arbiterConnHandler() {
+	interval := time.Millisecond * config.Parameters.ArbiterConnectInterval
+	if interval <= 0 {
+		interval = defaultArbiterConnectInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.connectArbiters(interval)
+			c.checkReachableArbiters()
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// connectArbiters dials the arbiters not connected, with an exponential backoff
+// for the arbiters failing repeatedly.
+func (c *p2pclient) connectArbiters(interval time.Duration) {
+	addresses := getArbiterAddresses()
+	self, err := PublicKeyToString(ArbitratorGroupSingleton.GetCurrentArbitrator().GetPublicKey())
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	var dials []*arbiterConn
+	c.peerLock.Lock()
+	conns := make(map[string]*arbiterConn)
+	for _, arbiter := range getCurrentArbiters() {
+		address, ok := addresses[arbiter]
+		if !ok || arbiter == self {
+			continue
+		}
+
+		conn, ok := c.arbiterConns[arbiter]
+		if !ok || conn.address != address {
+			conn = &arbiterConn{publicKey: arbiter, address: address}
+		}
+		conns[arbiter] = conn
+
+		if _, connected := c.arbiterPeers[arbiter]; connected {
+			conn.retries = 0
+			conn.nextRetry = time.Time{}
+			continue
+		}
+		if now.Before(conn.nextRetry) {
+			continue
+		}
+
+		backoff := interval << conn.retries
+		if backoff > maxReconnectBackoff || backoff <= 0 {
+			backoff = maxReconnectBackoff
+		} else {
+			conn.retries++
+		}
+		conn.nextRetry = now.Add(backoff)
+		dials = append(dials, conn)
+	}
+	// Arbiters not in current arbiter group are not connected any more
+	c.arbiterConns = conns
+	c.peerLock.Unlock()
+
+	for _, conn := range dials {
+		log.Info("[connectArbiters] Connect arbiter:", conn.publicKey, "address:", conn.address,
+			"retries:", conn.retries)
+		c.server.ConnectPeer(conn.address, false)
+	}
+}
+
+// checkReachableArbiters warns when current arbiter together with the arbiters
+// connected are fewer than the agreement count of withdraw transactions.
+func (c *p2pclient) checkReachableArbiters() {
+	reachable := len(c.getReachableArbiters()) + 1
+	required := getTransactionAgreementArbitratorsCount()
+
+	c.peerLock.Lock()
+	defer c.peerLock.Unlock()
+	if reachable < required {
+		if !c.lackArbiters {
+			log.Warn("[checkReachableArbiters] Only", reachable, "arbiters are reachable, at least",
+				required, "are required to sign withdraw transactions")
+		}
+		c.lackArbiters = true
+		return
+	}
+	if c.lackArbiters {
+		log.Info("[checkReachableArbiters]", reachable, "arbiters are reachable")
+	}
+	c.lackArbiters = false
+}
+
+// getReachableArbiters returns the arbiters of current arbiter group which are
+// connected directly.
+func (c *p2pclient) getReachableArbiters() []string {
+	var reachable []string
+	for _, arbiter := range getCurrentArbiters() {
+		if _, ok := c.getArbiterPeer(arbiter); ok {
+			reachable = append(reachable, arbiter)
+		}
+	}
+	return reachable
+}
+
+// GetArbiterConnections returns the connection states of the arbiters of
+// current arbiter group.
+func (c *p2pclient) GetArbiterConnections() []*ArbiterConnection {
+	addresses := getArbiterAddresses()
+	arbiters := getCurrentArbiters()
+
+	c.peerLock.Lock()
+	defer c.peerLock.Unlock()
+	var connections []*ArbiterConnection
+	for _, arbiter := range arbiters {
+		connection := &ArbiterConnection{
+			PublicKey: arbiter,
+			Address:   addresses[arbiter],
+		}
+		if p, ok := c.arbiterPeers[arbiter]; ok {
+			connection.Connected = true
+			connection.PeerAddr = p.Addr()
+		}
+		if conn, ok := c.arbiterConns[arbiter]; ok {
+			connection.Retries = conn.retries
+			if !conn.nextRetry.IsZero() {
+				connection.NextRetry = conn.nextRetry.Unix()
+			}
+		}
+		connections = append(connections, connection)
+	}
+	return connections
+}
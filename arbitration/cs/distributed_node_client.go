@@ -3,6 +3,8 @@ package cs
 import (
 	"bytes"
 	"errors"
+	"sync"
+	"time"
 
 	. "github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
 	. "github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
@@ -12,10 +14,15 @@ import (
 	"github.com/elastos/Elastos.ELA/common"
 	ela "github.com/elastos/Elastos.ELA/core/types"
 	"github.com/elastos/Elastos.ELA/core/types/payload"
+	"github.com/elastos/Elastos.ELA/crypto"
 )
 
 type DistributedNodeClient struct {
 	P2pCommand string
+
+	mux               sync.Mutex
+	rejectedProposals map[common.Uint256]*ProposalSigner
+	rejectedOrder     []common.Uint256
 }
 
 type DistributedNodeClientFunc interface {
@@ -51,9 +58,22 @@ func (client *DistributedNodeClient) OnReceivedProposal(content []byte) error {
 		return nil
 	}
 
+	proposer := transactionItem.TargetArbitratorPublicKey
+	if err := client.signAndFeedback(transactionItem); err != nil {
+		client.recordRejection(transactionItem.ItemContent.Hash(), err.Error())
+		if rejectErr := client.sendRejection(transactionItem.ItemContent.Hash(), proposer, err); rejectErr != nil {
+			log.Warn("[OnReceivedProposal] Send rejection failed, err:", rejectErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (client *DistributedNodeClient) signAndFeedback(transactionItem *DistributedItem) error {
 	payloadWithdraw, ok := transactionItem.ItemContent.Payload.(*payload.PayloadWithdrawFromSideChain)
 	if !ok {
-		return errors.New("Unknown payload type.")
+		return newRejectError(RejectInvalidPayload, "Unknown payload type.")
 	}
 
 	err := checkWithdrawTransaction(transactionItem.ItemContent, client)
@@ -64,7 +84,7 @@ func (client *DistributedNodeClient) OnReceivedProposal(content []byte) error {
 	currentArbitrator := ArbitratorGroupSingleton.GetCurrentArbitrator()
 	sc, ok := currentArbitrator.GetSideChainManager().GetChain(payloadWithdraw.GenesisBlockAddress)
 	if !ok {
-		return errors.New("Get side chain from GenesisBlockAddress failed")
+		return newRejectError(RejectUnknownSideChain, "Get side chain from GenesisBlockAddress failed")
 	}
 
 	if payloadWithdraw.BlockHeight > sc.GetLastUsedUtxoHeight() {
@@ -76,7 +96,7 @@ func (client *DistributedNodeClient) OnReceivedProposal(content []byte) error {
 	}
 
 	if err := client.SignProposal(transactionItem); err != nil {
-		return err
+		return newRejectError(RejectSignFailed, err.Error())
 	}
 
 	if err := client.Feedback(transactionItem); err != nil {
@@ -86,7 +106,69 @@ func (client *DistributedNodeClient) OnReceivedProposal(content []byte) error {
 	return nil
 }
 
+// recordRejection keeps the reason why current arbiter refused to sign the
+// proposal, dropping the oldest record if there are too many.
+func (client *DistributedNodeClient) recordRejection(hash common.Uint256, reason string) {
+	client.mux.Lock()
+	defer client.mux.Unlock()
+
+	if client.rejectedProposals == nil {
+		client.rejectedProposals = make(map[common.Uint256]*ProposalSigner)
+	}
+
+	publicKey, err := PublicKeyToString(ArbitratorGroupSingleton.GetCurrentArbitrator().GetPublicKey())
+	if err != nil {
+		return
+	}
+	if _, ok := client.rejectedProposals[hash]; !ok {
+		client.rejectedOrder = append(client.rejectedOrder, hash)
+	}
+	client.rejectedProposals[hash] = &ProposalSigner{
+		PublicKey: publicKey,
+		Time:      time.Now().Unix(),
+		Reason:    reason,
+	}
+	if len(client.rejectedOrder) > maxProposalRecords {
+		delete(client.rejectedProposals, client.rejectedOrder[0])
+		client.rejectedOrder = client.rejectedOrder[1:]
+	}
+}
+
+// sendRejection tells the proposer why current arbiter refused to sign the
+// proposal by a signed reject proposal message.
+func (client *DistributedNodeClient) sendRejection(hash common.Uint256, proposer *crypto.PublicKey, err error) error {
+	if !proposerSupports(proposer, CapProposalRejection) {
+		log.Info("[sendRejection] Proposer does not support rejection message, txHash:", hash.String())
+		return nil
+	}
+
+	detail := err.Error()
+	if len(detail) > MaxRejectDetailLength {
+		detail = detail[:MaxRejectDetailLength]
+	}
+	msg := &RejectProposalMessage{
+		Command:         RejectProposalCommand,
+		TransactionHash: hash,
+		Reason:          getRejectReason(err),
+		Detail:          detail,
+	}
+	if e := sendToProposer(proposer, msg); e != nil {
+		return e
+	}
+	log.Info("[sendRejection] Rejected proposal, txHash:", hash.String(), "reason:", msg.Reason, "detail:", detail)
+	return nil
+}
+
+func (client *DistributedNodeClient) GetProposalRejection(hash common.Uint256) (*ProposalSigner, bool) {
+	client.mux.Lock()
+	defer client.mux.Unlock()
+
+	rejection, ok := client.rejectedProposals[hash]
+	return rejection, ok
+}
+
 func (client *DistributedNodeClient) Feedback(item *DistributedItem) error {
+	proposer := item.TargetArbitratorPublicKey
 	ar := ArbitratorGroupSingleton.GetCurrentArbitrator()
 	item.TargetArbitratorPublicKey = ar.GetPublicKey()
 
@@ -102,28 +184,52 @@ func (client *DistributedNodeClient) Feedback(item *DistributedItem) error {
 		return errors.New("Send complaint failed.")
 	}
 
-	client.broadcast(messageReader.Bytes())
-	return nil
-}
-
-func (client *DistributedNodeClient) broadcast(message []byte) {
 	msg := &SignMessage{
 		Command: client.P2pCommand,
-		Content: message,
+		Content: messageReader.Bytes(),
+	}
+	return sendToProposer(proposer, msg)
+}
+
+// proposerSupports returns if the proposer supports the capability, all the
+// connected arbiters must support it if the proposer is unknown.
+func proposerSupports(proposer *crypto.PublicKey, capability uint64) bool {
+	if proposer == nil {
+		return P2PClientSingleton.PeersSupport(capability)
 	}
-	P2PClientSingleton.AddMessageHash(P2PClientSingleton.GetMessageHash(msg))
-	P2PClientSingleton.Broadcast(msg)
+	publicKey, err := PublicKeyToString(proposer)
+	if err != nil {
+		return false
+	}
+	return P2PClientSingleton.ArbiterSupports(publicKey, capability)
+}
+
+// sendToProposer sends the message to the arbiter who made the proposal, or
+// broadcasts it if the proposer is unknown.
+func sendToProposer(proposer *crypto.PublicKey, msg AuthenticatedMessage) error {
+	if proposer == nil {
+		return P2PClientSingleton.SignAndBroadcast(msg)
+	}
+	publicKey, err := PublicKeyToString(proposer)
+	if err != nil {
+		return err
+	}
+	return P2PClientSingleton.SendToArbitrator(publicKey, msg)
 }
 
 func checkWithdrawTransaction(txn *ela.Transaction, clientFunc DistributedNodeClientFunc) error {
 	payloadWithdraw, ok := txn.Payload.(*payload.PayloadWithdrawFromSideChain)
 	if !ok {
-		return errors.New("Check withdraw transaction failed, unknown payload type")
+		return newRejectError(RejectInvalidPayload, "Check withdraw transaction failed, unknown payload type")
 	}
 
 	sideChain, exchangeRate, err := clientFunc.GetSideChainAndExchangeRate(payloadWithdraw.GenesisBlockAddress)
 	if err != nil {
-		return err
+		return newRejectError(RejectUnknownSideChain, err.Error())
+	}
+
+	if len(payloadWithdraw.SideChainTransactionHashes) == 0 {
+		return checkConsolidateTransaction(txn, payloadWithdraw)
 	}
 
 	//check genesis address
@@ -140,23 +246,23 @@ func checkWithdrawTransaction(txn *ela.Transaction, clientFunc DistributedNodeCl
 		for _, txHash := range payloadWithdraw.SideChainTransactionHashes {
 			tx, err := sideChain.GetWithdrawTransaction(txHash.String())
 			if err != nil {
-				return errors.New("[checkWithdrawTransaction] failed, unknown side chain transachtions:" + err.Error())
+				return newRejectError(RejectUnknownSideChainTx, "[checkWithdrawTransaction] failed, unknown side chain transachtions:"+err.Error())
 			}
 
 			txid, err := common.Uint256FromHexString(tx.TxID)
 			if err != nil {
-				return errors.New("[checkWithdrawTransaction] failed, invalid txid")
+				return newRejectError(RejectUnknownSideChainTx, "[checkWithdrawTransaction] failed, invalid txid")
 			}
 
 			var withdrawAssets []*WithdrawAsset
 			for _, cs := range tx.CrossChainAssets {
 				csAmount, err := common.StringToFixed64(cs.CrossChainAmount)
 				if err != nil {
-					return errors.New("[checkWithdrawTransaction] invlaid cross chain amount in tx")
+					return newRejectError(RejectUnknownSideChainTx, "[checkWithdrawTransaction] invlaid cross chain amount in tx")
 				}
 				opAmount, err := common.StringToFixed64(cs.OutputAmount)
 				if err != nil {
-					return errors.New("[checkWithdrawTransaction] invlaid output amount in tx")
+					return newRejectError(RejectUnknownSideChainTx, "[checkWithdrawTransaction] invlaid output amount in tx")
 				}
 				withdrawAssets = append(withdrawAssets, &WithdrawAsset{
 					TargetAddress:    cs.CrossChainAddress,
@@ -193,7 +299,7 @@ func checkWithdrawTransaction(txn *ela.Transaction, clientFunc DistributedNodeCl
 			}
 		}
 		if !isContained {
-			return errors.New("Check withdraw transaction failed, utxo is not from genesis address account")
+			return newRejectError(RejectInvalidInputs, "Check withdraw transaction failed, utxo is not from genesis address account")
 		}
 	}
 
@@ -210,7 +316,7 @@ func checkWithdrawTransaction(txn *ela.Transaction, clientFunc DistributedNodeCl
 		for _, w := range tx.WithdrawInfo.WithdrawAssets {
 
 			if *w.CrossChainAmount < 0 || *w.Amount <= 0 || *w.CrossChainAmount >= *w.Amount {
-				return errors.New("Check withdraw transaction failed, cross chain amount less than 0")
+				return newRejectError(RejectInvalidOutputs, "Check withdraw transaction failed, cross chain amount less than 0")
 			}
 			oriOutputAmount += common.Fixed64(float64(*w.CrossChainAmount) / exchangeRate)
 			totalFee += common.Fixed64(float64(*w.Amount-*w.CrossChainAmount) / exchangeRate)
@@ -220,13 +326,13 @@ func checkWithdrawTransaction(txn *ela.Transaction, clientFunc DistributedNodeCl
 
 	if inputTotalAmount != outputTotalAmount+totalFee {
 		log.Info("inputTotalAmount-", inputTotalAmount, " outputTotalAmount-", outputTotalAmount, " totalFee-", totalFee)
-		return errors.New("Check withdraw transaction failed, input amount not equal output amount")
+		return newRejectError(RejectInvalidOutputs, "Check withdraw transaction failed, input amount not equal output amount")
 	}
 
 	//check exchange rate
 	genesisBlockProgramHash, err := common.Uint168FromAddress(payloadWithdraw.GenesisBlockAddress)
 	if err != nil {
-		return errors.New("Check withdraw transaction failed, genesis block address to program hash failed")
+		return newRejectError(RejectInvalidPayload, "Check withdraw transaction failed, genesis block address to program hash failed")
 	}
 	var withdrawOutputAmount common.Fixed64
 	var totalWithdrawOutputCount int
@@ -238,12 +344,54 @@ func checkWithdrawTransaction(txn *ela.Transaction, clientFunc DistributedNodeCl
 	}
 
 	if totalCrossChainCount != totalWithdrawOutputCount {
-		return errors.New("Check withdraw transaction failed, cross chain count not equal withdraw output count")
+		return newRejectError(RejectInvalidOutputs, "Check withdraw transaction failed, cross chain count not equal withdraw output count")
 	}
 
 	if oriOutputAmount != withdrawOutputAmount {
 		log.Info("oriOutputAmount-", oriOutputAmount, " withdrawOutputAmount-", withdrawOutputAmount)
-		return errors.New("Check withdraw transaction failed, exchange rate verify failed")
+		return newRejectError(RejectInvalidExchangeRate, "Check withdraw transaction failed, exchange rate verify failed")
+	}
+
+	return nil
+}
+
+// checkConsolidateTransaction checks the withdraw transaction without side
+// chain transactions, which merges utxos of the genesis block address into one
+// output of the same address.
+func checkConsolidateTransaction(txn *ela.Transaction, payloadWithdraw *payload.PayloadWithdrawFromSideChain) error {
+	genesisBlockProgramHash, err := common.Uint168FromAddress(payloadWithdraw.GenesisBlockAddress)
+	if err != nil {
+		return newRejectError(RejectInvalidPayload, "Check consolidate transaction failed, genesis block address to program hash failed")
+	}
+
+	utxos, err := store.DbCache.UTXOStore.GetAddressUTXOsFromGenesisBlockAddress(payloadWithdraw.GenesisBlockAddress)
+	if err != nil {
+		return errors.New("Get spender's UTXOs failed")
+	}
+
+	//check inputs
+	var inputTotalAmount common.Fixed64
+	for _, input := range txn.Inputs {
+		isContained := false
+		for _, utxo := range utxos {
+			if utxo.Input.IsEqual(*input) {
+				isContained = true
+				inputTotalAmount += *utxo.Amount
+				break
+			}
+		}
+		if !isContained {
+			return newRejectError(RejectInvalidInputs, "Check consolidate transaction failed, utxo is not from genesis address account")
+		}
+	}
+
+	//check outputs and fee
+	if len(txn.Outputs) != 1 || txn.Outputs[0].ProgramHash != *genesisBlockProgramHash {
+		return newRejectError(RejectInvalidOutputs, "Check consolidate transaction failed, output is not to genesis address account")
+	}
+	fee := inputTotalAmount - txn.Outputs[0].Value
+	if fee < 0 || fee > GetRequiredWithdrawFee(GetWithdrawTransactionSize(txn)) {
+		return newRejectError(RejectInvalidOutputs, "Check consolidate transaction failed, invalid fee")
 	}
 
 	return nil
@@ -8,6 +8,7 @@ import (
 
 	. "github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
 	. "github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
 	"github.com/elastos/Elastos.ELA.Arbiter/log"
 	"github.com/elastos/Elastos.ELA.Arbiter/store"
 
@@ -30,6 +31,10 @@ type DistributedNodeServer struct {
 	withdrawMux          *sync.Mutex
 	P2pCommand           string
 	unsolvedTransactions map[common.Uint256]*Transaction
+	proposalStates       map[common.Uint256]*proposalState
+	finishedProposals    map[common.Uint256]*proposalState
+	finishedOrder        []common.Uint256
+	metrics              ProposalMetrics
 }
 
 func (dns *DistributedNodeServer) tryInit() {
@@ -42,6 +47,12 @@ func (dns *DistributedNodeServer) tryInit() {
 	if dns.unsolvedTransactions == nil {
 		dns.unsolvedTransactions = make(map[common.Uint256]*Transaction)
 	}
+	if dns.proposalStates == nil {
+		dns.proposalStates = make(map[common.Uint256]*proposalState)
+	}
+	if dns.finishedProposals == nil {
+		dns.finishedProposals = make(map[common.Uint256]*proposalState)
+	}
 }
 
 func (dns *DistributedNodeServer) UnsolvedTransactions() map[common.Uint256]*Transaction {
@@ -76,8 +87,10 @@ func (dns *DistributedNodeServer) sendToArbitrator(content []byte) {
 		Command: dns.P2pCommand,
 		Content: content,
 	}
-	P2PClientSingleton.AddMessageHash(P2PClientSingleton.GetMessageHash(msg))
-	P2PClientSingleton.Broadcast(msg)
+	if err := P2PClientSingleton.SignAndBroadcast(msg); err != nil {
+		log.Warn("[sendToArbitrator] Sign message failed, err:", err)
+		return
+	}
 	log.Info("[sendToArbitrator] Send withdraw transaction to arbtiers for multi sign")
 }
 
@@ -96,10 +109,37 @@ func (dns *DistributedNodeServer) BroadcastWithdrawProposal(transaction *Transac
 func (dns *DistributedNodeServer) generateWithdrawProposal(transaction *Transaction, itemFunc DistrubutedItemFunc) ([]byte, error) {
 	dns.tryInit()
 
+	transactionItem, content, err := createProposalItem(transaction, itemFunc)
+	if err != nil {
+		return nil, err
+	}
+
+	transaction.Programs[0].Parameter = transactionItem.GetSignedData()
+
+	dns.mux.Lock()
+	defer dns.mux.Unlock()
+
+	if _, ok := dns.unsolvedTransactions[transaction.Hash()]; ok {
+		return nil, errors.New("Transaction already in process.")
+	}
+	dns.unsolvedTransactions[transaction.Hash()] = transaction
+	state := newProposalState()
+	state.addSigner(transactionItem.TargetArbitratorPublicKey)
+	dns.proposalStates[transaction.Hash()] = state
+	dns.metrics.Created++
+
+	if err := saveProposal(transaction); err != nil {
+		log.Warn("[generateWithdrawProposal] Save proposal failed, txHash:", transaction.Hash().String(), "err:", err)
+	}
+
+	return content, nil
+}
+
+func createProposalItem(transaction *Transaction, itemFunc DistrubutedItemFunc) (*DistributedItem, []byte, error) {
 	currentArbitrator := ArbitratorGroupSingleton.GetCurrentArbitrator()
 	programHash, err := StandardAcccountPublicKeyToProgramHash(currentArbitrator.GetPublicKey())
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	transactionItem := &DistributedItem{
 		ItemContent:                 transaction,
@@ -112,20 +152,100 @@ func (dns *DistributedNodeServer) generateWithdrawProposal(transaction *Transact
 	buf := new(bytes.Buffer)
 	err = transactionItem.Serialize(buf)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	transaction.Programs[0].Parameter = transactionItem.GetSignedData()
+	return transactionItem, buf.Bytes(), nil
+}
+
+func saveProposal(transaction *Transaction) error {
+	withdrawPayload, ok := transaction.Payload.(*payload.PayloadWithdrawFromSideChain)
+	if !ok {
+		return errors.New("Save proposal but withdraw transaction has invalid payload")
+	}
+
+	buf := new(bytes.Buffer)
+	if err := transaction.Serialize(buf); err != nil {
+		return err
+	}
+
+	return store.DbCache.MainChainStore.AddProposal(&WithdrawProposal{
+		TransactionHash:     transaction.Hash().String(),
+		GenesisBlockAddress: withdrawPayload.GenesisBlockAddress,
+		Transaction:         buf.Bytes(),
+		RedeemScript:        transaction.Programs[0].Code,
+		Signatures:          transaction.Programs[0].Parameter,
+		CreationHeight:      store.DbCache.UTXOStore.CurrentHeight(store.QueryHeightCode),
+	})
+}
+
+func updateProposalSignatures(transaction *Transaction) error {
+	buf := new(bytes.Buffer)
+	if err := transaction.Serialize(buf); err != nil {
+		return err
+	}
+
+	return store.DbCache.MainChainStore.UpdateProposalSignatures(transaction.Hash().String(),
+		buf.Bytes(), transaction.Programs[0].Parameter)
+}
+
+// LoadProposals restores the proposals persisted before the arbiter restarted,
+// so signatures collected for them are not lost.
+func (dns *DistributedNodeServer) LoadProposals() error {
+	dns.tryInit()
+
+	proposals, err := store.DbCache.MainChainStore.GetAllProposals()
+	if err != nil {
+		return err
+	}
 
 	dns.mux.Lock()
 	defer dns.mux.Unlock()
 
-	if _, ok := dns.unsolvedTransactions[transaction.Hash()]; ok {
-		return nil, errors.New("Transaction already in process.")
+	for _, proposal := range proposals {
+		txn := new(Transaction)
+		if err := txn.Deserialize(bytes.NewReader(proposal.Transaction)); err != nil {
+			log.Warn("[LoadProposals] Invalid proposal transaction, txHash:", proposal.TransactionHash, "err:", err)
+			store.DbCache.MainChainStore.RemoveProposal(proposal.TransactionHash)
+			continue
+		}
+		dns.unsolvedTransactions[txn.Hash()] = txn
+		dns.proposalStates[txn.Hash()] = newProposalState()
+	}
+	log.Info("[LoadProposals] Loaded", len(dns.unsolvedTransactions), "proposals")
+
+	return nil
+}
+
+// ExpireProposals drops the proposals created more than ProposalExpiryBlocks
+// main chain blocks before currentHeight.
+func (dns *DistributedNodeServer) ExpireProposals(currentHeight uint32) error {
+	dns.tryInit()
+
+	expiryBlocks := config.Parameters.ProposalExpiryBlocks
+	if expiryBlocks == 0 || currentHeight <= expiryBlocks {
+		return nil
+	}
+
+	txHashes, err := store.DbCache.MainChainStore.RemoveProposalsBelowHeight(currentHeight - expiryBlocks)
+	if err != nil {
+		return err
+	}
+
+	dns.mux.Lock()
+	defer dns.mux.Unlock()
+
+	for _, txHash := range txHashes {
+		hash, err := common.Uint256FromHexString(txHash)
+		if err != nil {
+			continue
+		}
+		delete(dns.unsolvedTransactions, *hash)
+		dns.finishProposal(*hash, ProposalExpired)
+		log.Info("[ExpireProposals] Proposal expired, txHash:", txHash)
 	}
-	dns.unsolvedTransactions[transaction.Hash()] = transaction
 
-	return buf.Bytes(), nil
+	return nil
 }
 
 func (dns *DistributedNodeServer) ReceiveProposalFeedback(content []byte) error {
@@ -175,12 +295,23 @@ func (dns *DistributedNodeServer) ReceiveProposalFeedback(content []byte) error
 	if err != nil {
 		return err
 	}
+	dns.addProposalSigner(txn.Hash(), transactionItem.TargetArbitratorPublicKey)
 
-	if signedCount >= getTransactionAgreementArbitratorsCount() {
+	if signedCount < getTransactionAgreementArbitratorsCount() {
+		if err := updateProposalSignatures(txn); err != nil {
+			log.Warn("[ReceiveProposalFeedback] Update proposal signatures failed, txHash:", txn.Hash().String(), "err:", err)
+		}
+	} else {
 		dns.mux.Lock()
 		delete(dns.unsolvedTransactions, txn.Hash())
+		dns.finishProposal(txn.Hash(), ProposalCompleted)
+		dns.metrics.Completed++
 		dns.mux.Unlock()
 
+		if err := store.DbCache.MainChainStore.RemoveProposal(txn.Hash().String()); err != nil {
+			log.Warn("[ReceiveProposalFeedback] Remove proposal failed, txHash:", txn.Hash().String(), "err:", err)
+		}
+
 		withdrawPayload, ok := txn.Payload.(*payload.PayloadWithdrawFromSideChain)
 		if !ok {
 			return errors.New("Received proposal feed back but withdraw transaction has invalid payload")
@@ -194,22 +325,43 @@ func (dns *DistributedNodeServer) ReceiveProposalFeedback(content []byte) error
 			transactionHashes = append(transactionHashes, hash.String())
 		}
 
+		// Consolidate transactions have no side chain transactions to move
+		if len(transactionHashes) == 0 {
+			if err != nil || resp.Error != nil {
+				log.Warn("Send consolidate transaction failed, txHash:", txn.Hash().String())
+				sidechain, ok := currentArbitrator.GetSideChainManager().GetChain(withdrawPayload.GenesisBlockAddress)
+				if ok {
+					var outPoints []OutPoint
+					for _, input := range txn.Inputs {
+						outPoints = append(outPoints, input.Previous)
+					}
+					sidechain.RemoveLastUsedOutPoints(outPoints)
+				}
+			} else {
+				log.Info("Send consolidate transaction succeed, txHash:", txn.Hash().String())
+			}
+			return nil
+		}
+
 		if err != nil || resp.Error != nil && resp.Code != MCErrDoubleSpend {
 			log.Warn("Send withdraw transaction failed, move to finished db, txHash:", txn.Hash().String())
 
+			reason := "send withdraw transaction failed"
+			if err != nil {
+				reason += ": " + err.Error()
+			} else {
+				reason += ": " + resp.Error.Message
+			}
+
 			buf := new(bytes.Buffer)
 			err := txn.Serialize(buf)
 			if err != nil {
 				return errors.New("Send withdraw transaction faild, invalid transaction")
 			}
 
-			err = store.DbCache.SideChainStore.RemoveSideChainTxs(transactionHashes)
-			if err != nil {
-				return errors.New("Remove failed withdraw transaction from db failed")
-			}
-			err = store.FinishedTxsDbCache.AddFailedWithdrawTxs(transactionHashes, buf.Bytes())
+			err = store.TxsFinisherSingleton.FinishWithdrawTxs(false, transactionHashes, txn.Hash().String(), buf.Bytes(), reason)
 			if err != nil {
-				return errors.New("Add failed withdraw transaction into finished db failed")
+				return errors.New("Move failed withdraw transaction into finished db failed")
 			}
 		} else if resp.Error == nil && resp.Result != nil || resp.Error != nil && resp.Code == MCErrSidechainTxDuplicate {
 			if resp.Error != nil {
@@ -227,13 +379,9 @@ func (dns *DistributedNodeServer) ReceiveProposalFeedback(content []byte) error
 			}
 			sidechain.AddLastUsedOutPoints(newUsedUtxos)
 
-			err = store.DbCache.SideChainStore.RemoveSideChainTxs(transactionHashes)
-			if err != nil {
-				return errors.New("Remove succeed withdraw transaction from db failed")
-			}
-			err = store.FinishedTxsDbCache.AddSucceedWithdrawTxs(transactionHashes)
+			err = store.TxsFinisherSingleton.FinishWithdrawTxs(true, transactionHashes, txn.Hash().String(), nil, "")
 			if err != nil {
-				return errors.New("Add succeed withdraw transaction into finished db failed")
+				return errors.New("Move succeed withdraw transaction into finished db failed")
 			}
 		} else {
 			log.Warn("Send withdraw transaction failed, need to resend")
@@ -0,0 +1,162 @@
+package cs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
+
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/crypto"
+	"github.com/elastos/Elastos.ELA/p2p"
+)
+
+// maxMessageTimeOffset is the max difference between the clocks of arbiters.
+const maxMessageTimeOffset = time.Minute
+
+// Envelope is appended to the messages between arbiters, it carries the
+// public key of the arbiter who created the message, the public key of the
+// arbiter the message is sent to, which is empty for broadcast messages, the
+// time the message is signed, and the signature over the command, payload,
+// target and timestamp of the message.
+type Envelope struct {
+	PublicKey []byte
+	Target    []byte
+	Timestamp int64
+	Signature []byte
+}
+
+func (e *Envelope) GetEnvelope() *Envelope {
+	return e
+}
+
+func (e *Envelope) Serialize(w io.Writer) error {
+	err := common.WriteVarBytes(w, e.PublicKey)
+	if err != nil {
+		return err
+	}
+	err = common.WriteVarBytes(w, e.Target)
+	if err != nil {
+		return err
+	}
+	err = common.WriteUint64(w, uint64(e.Timestamp))
+	if err != nil {
+		return err
+	}
+	return common.WriteVarBytes(w, e.Signature)
+}
+
+func (e *Envelope) Deserialize(r io.Reader) error {
+	publicKey, err := common.ReadVarBytes(r, maxPublicKeyLength, "PublicKey")
+	if err != nil {
+		return err
+	}
+	e.PublicKey = publicKey
+	target, err := common.ReadVarBytes(r, maxPublicKeyLength, "Target")
+	if err != nil {
+		return err
+	}
+	e.Target = target
+	timestamp, err := common.ReadUint64(r)
+	if err != nil {
+		return err
+	}
+	e.Timestamp = int64(timestamp)
+	signature, err := common.ReadVarBytes(r, maxSignatureLength, "Signature")
+	if err != nil {
+		return err
+	}
+	e.Signature = signature
+	return nil
+}
+
+// AuthenticatedMessage is a message which must be signed by an arbiter.
+type AuthenticatedMessage interface {
+	p2p.Message
+	SerializeUnsigned(w io.Writer) error
+	GetEnvelope() *Envelope
+}
+
+func getSignedData(msg AuthenticatedMessage) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := common.WriteVarString(buf, msg.CMD()); err != nil {
+		return nil, err
+	}
+	if err := msg.SerializeUnsigned(buf); err != nil {
+		return nil, err
+	}
+	if err := common.WriteVarBytes(buf, msg.GetEnvelope().Target); err != nil {
+		return nil, err
+	}
+	if err := common.WriteUint64(buf, uint64(msg.GetEnvelope().Timestamp)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// checkEnvelopeTime rejects the messages signed earlier than the message cache
+// keeps their hashes, which could be replayed as new messages, allowing for the
+// clock difference of the arbiters.
+func checkEnvelopeTime(envelope *Envelope, cacheExpiration time.Duration, now time.Time) error {
+	offset := now.Sub(time.Unix(envelope.Timestamp, 0))
+	if offset < -maxMessageTimeOffset {
+		return errors.New("message is signed in the future")
+	}
+	if offset+maxMessageTimeOffset > cacheExpiration {
+		return errors.New("message is out of date")
+	}
+	return nil
+}
+
+// SignP2PMessage fills the envelope of the message with the public key and
+// signature of current arbiter.
+func SignP2PMessage(msg AuthenticatedMessage) error {
+	currentArbitrator := ArbitratorGroupSingleton.GetCurrentArbitrator()
+	publicKey, err := currentArbitrator.GetPublicKey().EncodePoint(true)
+	if err != nil {
+		return err
+	}
+
+	envelope := msg.GetEnvelope()
+	envelope.Timestamp = time.Now().Unix()
+	data, err := getSignedData(msg)
+	if err != nil {
+		return err
+	}
+	signature, err := currentArbitrator.Sign(data)
+	if err != nil {
+		return err
+	}
+
+	envelope.PublicKey = publicKey
+	envelope.Signature = signature
+	return nil
+}
+
+// VerifyP2PMessage checks the message is signed by one of the arbiters and
+// returns the public key of the signer.
+func VerifyP2PMessage(msg AuthenticatedMessage) (*crypto.PublicKey, error) {
+	envelope := msg.GetEnvelope()
+	if len(envelope.PublicKey) == 0 || len(envelope.Signature) == 0 {
+		return nil, errors.New("Unauthenticated message")
+	}
+
+	publicKey, err := crypto.DecodePoint(envelope.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if !isArbitrator(publicKey) {
+		return nil, errors.New("Message is not signed by an arbiter")
+	}
+
+	data, err := getSignedData(msg)
+	if err != nil {
+		return nil, err
+	}
+	if err := crypto.Verify(*publicKey, data, envelope.Signature); err != nil {
+		return nil, errors.New("Invalid message signature")
+	}
+	return publicKey, nil
+}
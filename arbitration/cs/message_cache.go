@@ -0,0 +1,135 @@
+package cs
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+
+	"github.com/elastos/Elastos.ELA/common"
+)
+
+const (
+	defaultMessageCacheSize       = 10000
+	defaultMessageCacheExpiration = 10 * time.Minute
+)
+
+type cacheEntry struct {
+	hash     common.Uint256
+	lastSeen time.Time
+}
+
+// messageCache remembers the hashes of recently seen messages, so a message is
+// only handled and relayed once. Entries are dropped when they have not been
+// seen for the expiration, or when the cache is full from the least recently
+// seen one.
+type messageCache struct {
+	mux        sync.Mutex
+	capacity   int
+	expiration time.Duration
+	entries    map[common.Uint256]*list.Element
+	// order keeps the entries from the most recently seen to the least
+	order *list.List
+	now   func() time.Time
+
+	hits        uint64
+	misses      uint64
+	evictions   uint64
+	expirations uint64
+}
+
+func newMessageCache(capacity int, expiration time.Duration) *messageCache {
+	if capacity <= 0 {
+		capacity = defaultMessageCacheSize
+	}
+	if expiration <= 0 {
+		expiration = defaultMessageCacheExpiration
+	}
+	return &messageCache{
+		capacity:   capacity,
+		expiration: expiration,
+		entries:    make(map[common.Uint256]*list.Element, capacity),
+		order:      list.New(),
+		now:        time.Now,
+	}
+}
+
+// Exist returns if the hash is in the cache, and refreshes the entry if so.
+func (c *messageCache) Exist(hash common.Uint256) bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	now := c.now()
+	c.expire(now)
+	elem, ok := c.entries[hash]
+	if !ok {
+		c.misses++
+		return false
+	}
+	c.hits++
+	c.touch(elem, now)
+	return true
+}
+
+// Add puts the hash into the cache and returns if it was already there.
+func (c *messageCache) Add(hash common.Uint256) bool {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	now := c.now()
+	c.expire(now)
+	if elem, ok := c.entries[hash]; ok {
+		c.touch(elem, now)
+		return true
+	}
+
+	c.entries[hash] = c.order.PushFront(&cacheEntry{hash: hash, lastSeen: now})
+	for c.order.Len() > c.capacity {
+		c.remove(c.order.Back())
+		c.evictions++
+	}
+	return false
+}
+
+func (c *messageCache) Len() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.order.Len()
+}
+
+// Info returns the metrics of the cache.
+func (c *messageCache) Info() *base.MessageCacheInfo {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return &base.MessageCacheInfo{
+		Size:        c.order.Len(),
+		Capacity:    c.capacity,
+		Hits:        c.hits,
+		Misses:      c.misses,
+		Evictions:   c.evictions,
+		Expirations: c.expirations,
+	}
+}
+
+func (c *messageCache) touch(elem *list.Element, now time.Time) {
+	elem.Value.(*cacheEntry).lastSeen = now
+	c.order.MoveToFront(elem)
+}
+
+// expire drops the entries not seen for the expiration, since the entries are
+// ordered by the last seen time, only the back of the list need to be checked.
+func (c *messageCache) expire(now time.Time) {
+	for elem := c.order.Back(); elem != nil; elem = c.order.Back() {
+		if now.Sub(elem.Value.(*cacheEntry).lastSeen) < c.expiration {
+			return
+		}
+		c.remove(elem)
+		c.expirations++
+	}
+}
+
+func (c *messageCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*cacheEntry).hash)
+}
@@ -0,0 +1,71 @@
+package cs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMessageCache(capacity int, expiration time.Duration) (*messageCache, *time.Time) {
+	now := time.Unix(1539760252, 0)
+	cache := newMessageCache(capacity, expiration)
+	cache.now = func() time.Time { return now }
+	return cache, &now
+}
+
+func TestMessageCache_Capacity(t *testing.T) {
+	cache, _ := newTestMessageCache(3, time.Minute)
+
+	assert.False(t, cache.Add(common.Uint256{1}))
+	assert.False(t, cache.Add(common.Uint256{2}))
+	assert.False(t, cache.Add(common.Uint256{3}))
+	assert.True(t, cache.Add(common.Uint256{1}))
+
+	// 2 is the least recently seen one
+	assert.False(t, cache.Add(common.Uint256{4}))
+	assert.Equal(t, 3, cache.Len())
+	assert.False(t, cache.Exist(common.Uint256{2}))
+	assert.True(t, cache.Exist(common.Uint256{1}))
+	assert.True(t, cache.Exist(common.Uint256{3}))
+	assert.True(t, cache.Exist(common.Uint256{4}))
+
+	info := cache.Info()
+	assert.Equal(t, 3, info.Size)
+	assert.Equal(t, 3, info.Capacity)
+	assert.Equal(t, uint64(3), info.Hits)
+	assert.Equal(t, uint64(1), info.Misses)
+	assert.Equal(t, uint64(1), info.Evictions)
+	assert.Equal(t, uint64(0), info.Expirations)
+}
+
+func TestMessageCache_Expiration(t *testing.T) {
+	cache, now := newTestMessageCache(10, time.Minute)
+
+	cache.Add(common.Uint256{1})
+	*now = now.Add(40 * time.Second)
+	cache.Add(common.Uint256{2})
+
+	// Seeing the message again keeps it in the cache
+	*now = now.Add(40 * time.Second)
+	assert.True(t, cache.Exist(common.Uint256{2}))
+	assert.False(t, cache.Exist(common.Uint256{1}))
+
+	*now = now.Add(59 * time.Second)
+	assert.True(t, cache.Exist(common.Uint256{2}))
+
+	*now = now.Add(time.Minute)
+	assert.False(t, cache.Exist(common.Uint256{2}))
+	assert.Equal(t, 0, cache.Len())
+
+	info := cache.Info()
+	assert.Equal(t, uint64(2), info.Expirations)
+	assert.Equal(t, uint64(0), info.Evictions)
+}
+
+func TestMessageCache_Defaults(t *testing.T) {
+	cache := newMessageCache(0, 0)
+	assert.Equal(t, defaultMessageCacheSize, cache.capacity)
+	assert.Equal(t, defaultMessageCacheExpiration, cache.expiration)
+}
@@ -2,11 +2,10 @@ package cs
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
 	"sync"
+	"time"
 
-	. "github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
 	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
 	"github.com/elastos/Elastos.ELA.Arbiter/config"
 	"github.com/elastos/Elastos.ELA.Arbiter/log"
@@ -22,9 +21,8 @@ import (
 var P2PClientSingleton *p2pclient
 
 const (
-	OpenService        = 1 << 2
-	messageStoreHeight = 5
-	defaultMaxPeers    = 12
+	OpenService     = 1 << 2
+	defaultMaxPeers = 12
 )
 
 const (
@@ -33,14 +31,23 @@ const (
 	ComplainCommand                = "complain"
 	GetLastArbiterUsedUtxoCommand  = "RQLastUtxo"
 	SendLastArbiterUsedUtxoCommand = "SDLastUtxo"
+	RejectProposalCommand          = "rejproposal"
+	ArbiterHelloCommand            = "arbhello"
+	ArbiterChallengeCommand        = "challenge"
 )
 
 type p2pclient struct {
-	server    server.IServer
+	server    p2pServer
 	listeners []base.P2PClientListener
 
-	cacheLock     sync.Mutex
-	messageHashes map[common.Uint256]uint32
+	messageCache *messageCache
+
+	peerLock     sync.Mutex
+	peers        map[*peer.Peer]*peerState
+	banned       map[string]time.Time
+	arbiterPeers map[string]*peer.Peer
+	arbiterConns map[string]*arbiterConn
+	lackArbiters bool
 
 	newPeers  chan *peer.Peer
 	donePeers chan *peer.Peer
@@ -53,9 +60,14 @@ func InitP2PClient(dataDir string) error {
 		maxPeers = defaultMaxPeers
 	}
 	a := p2pclient{
-		messageHashes: make(map[common.Uint256]uint32, 0),
-		newPeers:      make(chan *peer.Peer, maxPeers),
-		donePeers:     make(chan *peer.Peer, maxPeers),
+		messageCache: newMessageCache(config.Parameters.MessageCacheSize,
+			time.Millisecond*config.Parameters.MessageCacheExpiration),
+		peers:        make(map[*peer.Peer]*peerState),
+		banned:       make(map[string]time.Time),
+		arbiterPeers: make(map[string]*peer.Peer),
+		arbiterConns: make(map[string]*arbiterConn),
+		newPeers:     make(chan *peer.Peer, maxPeers),
+		donePeers:    make(chan *peer.Peer, maxPeers),
 	}
 	// Initiate P2P server configuration
 	serverCfg := server.NewDefaultConfig(
@@ -63,7 +75,7 @@ func InitP2PClient(dataDir string) error {
 		p2p.EIP001Version,
 		OpenService,
 		config.Parameters.NodePort,
-		config.Parameters.SeedList,
+		getSeeds(),
 		[]string{fmt.Sprint(":", config.Parameters.NodePort)},
 		a.newPeer, a.donePeer,
 		makeEmptyMessage,
@@ -95,24 +107,24 @@ func (c *p2pclient) donePeer(peer server.IPeer) {
 // peerHandler handles new peers and done peers from P2P server.
 // When comes new peer, create a spv peer warpper for it
 func (c *p2pclient) peerHandler() {
-	peers := make(map[*peer.Peer]struct{})
-
 out:
 	for {
 		select {
 		case p := <-c.newPeers:
 			log.Debugf("p2pclient new peer %v", p)
-			peers[p] = struct{}{}
+			if !c.addPeer(p) {
+				log.Warnf("p2pclient refuse banned peer %v", p)
+				p.Disconnect()
+				continue
+			}
 			p.AddMessageFunc(c.handleMessage)
+			c.sendChallenge(p)
 
 		case p := <-c.donePeers:
-			_, ok := peers[p]
-			if !ok {
+			if !c.removePeer(p) {
 				log.Errorf("unknown done peer %v", p)
 				continue
 			}
-
-			delete(peers, p)
 			log.Debugf("p2pclient done peer %v", p)
 
 		case <-c.quit:
@@ -143,6 +155,7 @@ func (c *p2pclient) tryInit() {
 func (c *p2pclient) Start() {
 	c.server.Start()
 	go c.peerHandler()
+	go c.arbiterConnHandler()
 }
 
 func (c *p2pclient) Stop() {
@@ -163,34 +176,17 @@ func (c *p2pclient) GetMessageHash(msg p2p.Message) common.Uint256 {
 }
 
 func (c *p2pclient) ExistMessageHash(msgHash common.Uint256) bool {
-	c.cacheLock.Lock()
-	defer c.cacheLock.Unlock()
-	for k := range c.messageHashes {
-		if k == msgHash {
-			return true
-		}
-	}
-	return false
+	return c.messageCache.Exist(msgHash)
 }
 
+// AddMessageHash records the message hash and returns if it was already seen.
 func (c *p2pclient) AddMessageHash(msgHash common.Uint256) bool {
-	c.cacheLock.Lock()
-	defer c.cacheLock.Unlock()
-	currentMainChainHeight := *ArbitratorGroupSingleton.GetCurrentHeight()
-	c.messageHashes[msgHash] = currentMainChainHeight
-
-	//delete message height 5 less than current main chain height
-	var needToDeleteMessages []common.Uint256
-	for k, v := range c.messageHashes {
-		if currentMainChainHeight > messageStoreHeight && v < currentMainChainHeight-messageStoreHeight {
-			needToDeleteMessages = append(needToDeleteMessages, k)
-		}
-	}
-	for _, msg := range needToDeleteMessages {
-		delete(c.messageHashes, msg)
-	}
+	return c.messageCache.Add(msgHash)
+}
 
-	return false
+// GetMessageCacheInfo returns the metrics of the message deduplication cache.
+func (c *p2pclient) GetMessageCacheInfo() *base.MessageCacheInfo {
+	return c.messageCache.Info()
 }
 
 func (c *p2pclient) Broadcast(msg p2p.Message) {
@@ -203,13 +199,81 @@ func (c *p2pclient) Broadcast(msg p2p.Message) {
 
 }
 
+// SignAndBroadcast signs the message by current arbiter and broadcasts it.
+func (c *p2pclient) SignAndBroadcast(msg AuthenticatedMessage) error {
+	if err := c.signMessage(msg); err != nil {
+		return err
+	}
+	c.AddMessageHash(c.GetMessageHash(msg))
+	c.Broadcast(msg)
+	return nil
+}
+
 func (c *p2pclient) handleMessage(peer *peer.Peer, msg p2p.Message) {
+	if _, ok := msg.(*unsupportedMessage); ok {
+		c.misbehaving(peer, unsupportedMessageScore, "unsupported message "+msg.CMD())
+		return
+	}
+
+	// Messages in versions this node does not understand are expected from
+	// newer arbiters during upgrades, they are relayed but not processed
+	if versioned, ok := msg.(VersionedMessage); ok && !isSupportedVersion(versioned.GetVersion()) {
+		switch msg.(type) {
+		case *ArbiterChallengeMessage, *ArbiterHelloMessage:
+			log.Debug("[HandleMessage] skip msg:", msg.CMD(), "of unsupported version:",
+				versioned.GetVersion(), "from peer id-", peer.ID())
+		default:
+			c.relayUnsupportedMessage(peer, msg)
+		}
+		return
+	}
+
+	// Challenge and hello messages are only for the connected peer, never
+	// relayed
+	switch m := msg.(type) {
+	case *ArbiterChallengeMessage:
+		if err := c.receiveChallenge(peer, m); err != nil {
+			c.misbehaving(peer, invalidMessageScore, msg.CMD()+" "+err.Error())
+		}
+		return
+	case *ArbiterHelloMessage:
+		if err := c.receiveHello(peer, m); err != nil {
+			c.misbehaving(peer, invalidMessageScore, msg.CMD()+" "+err.Error())
+		}
+		return
+	}
+
 	msgHash := c.GetMessageHash(msg)
 	if c.ExistMessageHash(msgHash) {
+		c.countMessage(peer, true)
 		return
+	}
+	c.countMessage(peer, false)
+
+	// Messages between arbiters must be signed by one of the arbiters
+	authMsg, isAuthMsg := msg.(AuthenticatedMessage)
+	if isAuthMsg {
+		if _, err := VerifyP2PMessage(authMsg); err != nil {
+			c.misbehaving(peer, invalidMessageScore, msg.CMD()+" "+err.Error())
+			return
+		}
+		// The hash of a replayed message may have left the cache
+		if err := checkEnvelopeTime(authMsg.GetEnvelope(), c.messageCache.expiration, time.Now()); err != nil {
+			log.Warn("[HandleMessage] drop msg:", msg.CMD(), "from peer id-", peer.ID(), "err:", err)
+			return
+		}
+	}
+
+	c.AddMessageHash(msgHash)
+	log.Info("[HandleMessage] received msg:", msg.CMD(), "from peer id-", peer.ID())
+
+	// Messages addressed to other arbiter are only passed on
+	if isAuthMsg && len(authMsg.GetEnvelope().Target) != 0 {
+		if !isCurrentArbitrator(authMsg.GetEnvelope().Target) {
+			c.route(authMsg)
+			return
+		}
 	} else {
-		c.AddMessageHash(msgHash)
-		log.Info("[HandleMessage] received msg:", msg.CMD(), "from peer id-", peer.ID())
 		c.Broadcast(msg)
 	}
 
@@ -249,8 +313,15 @@ func makeEmptyMessage(cmd string) (message p2p.Message, err error) {
 		message = &GetLastArbiterUsedUTXOMessage{Command: GetLastArbiterUsedUtxoCommand}
 	case SendLastArbiterUsedUtxoCommand:
 		message = &SendLastArbiterUsedUTXOMessage{Command: SendLastArbiterUsedUtxoCommand}
+	case RejectProposalCommand:
+		message = &RejectProposalMessage{Command: RejectProposalCommand}
+	case ArbiterHelloCommand:
+		message = &ArbiterHelloMessage{Command: ArbiterHelloCommand}
+	case ArbiterChallengeCommand:
+		message = &ArbiterChallengeMessage{Command: ArbiterChallengeCommand}
 	default:
-		return nil, errors.New("Received unsupported message, CMD " + cmd)
+		// Score the peer in handleMessage instead of dropping it silently
+		message = &unsupportedMessage{command: cmd}
 	}
 	return message, nil
 }
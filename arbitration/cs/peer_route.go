@@ -0,0 +1,173 @@
+package cs
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+
+	. "github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
+	. "github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/p2p/peer"
+)
+
+// helloChallengeSize is the size of the random challenge sent to a new peer.
+const helloChallengeSize = 32
+
+// sendChallenge sends a random challenge to the new peer, which is expected to
+// be signed in the hello message of the peer.
+func (c *p2pclient) sendChallenge(p *peer.Peer) {
+	challenge := make([]byte, helloChallengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		log.Warn("[sendChallenge] Generate challenge failed, err:", err)
+		return
+	}
+
+	c.peerLock.Lock()
+	state, ok := c.peers[p]
+	if ok {
+		state.challenge = challenge
+	}
+	c.peerLock.Unlock()
+	if !ok {
+		return
+	}
+
+	p.QueueMessage(&ArbiterChallengeMessage{
+		Command:        ArbiterChallengeCommand,
+		Challenge:      challenge,
+		MessageVersion: MessageVersion{Version: MinProtocolVersion},
+	}, nil)
+}
+
+// receiveChallenge answers the challenge of the peer with the hello message,
+// only the first challenge of a connection is answered.
+func (c *p2pclient) receiveChallenge(p *peer.Peer, msg *ArbiterChallengeMessage) error {
+	if len(msg.Challenge) != helloChallengeSize {
+		return errors.New("invalid challenge size")
+	}
+
+	c.peerLock.Lock()
+	state, ok := c.peers[p]
+	if !ok || state.helloSent {
+		c.peerLock.Unlock()
+		return nil
+	}
+	state.helloSent = true
+	c.peerLock.Unlock()
+
+	c.sendHello(p, msg.Challenge)
+	return nil
+}
+
+// sendHello tells the peer which arbiter it is connected to.
+func (c *p2pclient) sendHello(p *peer.Peer, challenge []byte) {
+	if ArbitratorGroupSingleton == nil || ArbitratorGroupSingleton.GetCurrentArbitrator() == nil {
+		return
+	}
+	msg := &ArbiterHelloMessage{
+		Command:         ArbiterHelloCommand,
+		Challenge:       challenge,
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    LocalCapabilities,
+		MessageVersion:  MessageVersion{Version: MinProtocolVersion},
+	}
+	if err := SignP2PMessage(msg); err != nil {
+		log.Warn("[sendHello] Sign hello message failed, err:", err)
+		return
+	}
+	p.QueueMessage(msg, nil)
+}
+
+// receiveHello maps the arbiter who signed the hello message to the peer, and
+// records the protocol version and capabilities of the arbiter. The hello
+// message must sign the challenge sent on this connection, the challenge is
+// used only once, so a hello message replayed from other connections or
+// replayed again on this connection can not take over the mapping.
+func (c *p2pclient) receiveHello(p *peer.Peer, msg *ArbiterHelloMessage) error {
+	c.peerLock.Lock()
+	state, ok := c.peers[p]
+	if !ok {
+		c.peerLock.Unlock()
+		return nil
+	}
+	challenge := state.challenge
+	state.challenge = nil
+	c.peerLock.Unlock()
+	if len(challenge) == 0 || !bytes.Equal(challenge, msg.Challenge) {
+		return errors.New("hello message does not answer the challenge")
+	}
+
+	publicKey, err := VerifyP2PMessage(msg)
+	if err != nil {
+		return err
+	}
+	arbiter, err := PublicKeyToString(publicKey)
+	if err != nil {
+		return err
+	}
+
+	c.peerLock.Lock()
+	defer c.peerLock.Unlock()
+	state, ok = c.peers[p]
+	if !ok {
+		return nil
+	}
+	state.arbiter = arbiter
+	state.version = msg.ProtocolVersion
+	state.capabilities = msg.Capabilities
+	c.arbiterPeers[arbiter] = p
+	log.Info("[receiveHello] arbiter:", arbiter, "connected by peer:", p.Addr(),
+		"protocol version:", msg.ProtocolVersion, "capabilities:", msg.Capabilities)
+	return nil
+}
+
+func (c *p2pclient) getArbiterPeer(arbiter string) (*peer.Peer, bool) {
+	c.peerLock.Lock()
+	defer c.peerLock.Unlock()
+	p, ok := c.arbiterPeers[arbiter]
+	return p, ok
+}
+
+// SendToArbitrator signs the message and sends it to the arbiter with the given
+// public key, directly if the arbiter is connected, otherwise by gossip.
+func (c *p2pclient) SendToArbitrator(arbiter string, msg AuthenticatedMessage) error {
+	publicKey, err := PublicKeyFromString(arbiter)
+	if err != nil {
+		return err
+	}
+	target, err := publicKey.EncodePoint(true)
+	if err != nil {
+		return err
+	}
+	msg.GetEnvelope().Target = target
+	if err := c.signMessage(msg); err != nil {
+		return err
+	}
+	c.AddMessageHash(c.GetMessageHash(msg))
+	c.route(msg)
+	return nil
+}
+
+// route sends the message addressed to an arbiter through the direct route if
+// there is one and the arbiter supports it, otherwise broadcasts it.
+func (c *p2pclient) route(msg AuthenticatedMessage) {
+	target := common.BytesToHexString(msg.GetEnvelope().Target)
+	if p, ok := c.getArbiterPeer(target); ok && c.ArbiterSupports(target, CapDirectRoute) {
+		log.Debug("[route] msg:", msg.CMD(), "to arbiter:", target, "by peer:", p.Addr())
+		p.QueueMessage(msg, nil)
+		return
+	}
+	c.Broadcast(msg)
+}
+
+// isCurrentArbitrator returns if the public key belongs to current arbiter.
+func isCurrentArbitrator(publicKey []byte) bool {
+	current, err := ArbitratorGroupSingleton.GetCurrentArbitrator().GetPublicKey().EncodePoint(true)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(current, publicKey)
+}
@@ -0,0 +1,44 @@
+package cs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA/p2p/peer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReceiveHello_Replay(t *testing.T) {
+	p1, p2 := &peer.Peer{}, &peer.Peer{}
+	challenge1 := make([]byte, helloChallengeSize)
+	challenge1[0] = 1
+	challenge2 := make([]byte, helloChallengeSize)
+	challenge2[0] = 2
+	c := &p2pclient{
+		peers: map[*peer.Peer]*peerState{
+			p1: {connTime: time.Now(), challenge: challenge1},
+			p2: {connTime: time.Now(), challenge: challenge2},
+		},
+		arbiterPeers: map[string]*peer.Peer{"arbiter": p1},
+	}
+
+	// A hello message answering the challenge of another connection
+	hello := &ArbiterHelloMessage{
+		Command:        ArbiterHelloCommand,
+		Challenge:      challenge1,
+		MessageVersion: MessageVersion{Version: MinProtocolVersion},
+	}
+	assert.Error(t, c.receiveHello(p2, hello))
+	assert.Nil(t, c.peers[p2].challenge)
+	assert.Equal(t, p1, c.arbiterPeers["arbiter"])
+
+	// The challenge is used only once, even if the hello message is invalid
+	assert.Error(t, c.receiveHello(p1, hello))
+	assert.Nil(t, c.peers[p1].challenge)
+	assert.EqualError(t, c.receiveHello(p1, hello), "hello message does not answer the challenge")
+	assert.Equal(t, "", c.peers[p1].arbiter)
+	assert.Equal(t, p1, c.arbiterPeers["arbiter"])
+
+	assert.Error(t, c.receiveChallenge(p1, &ArbiterChallengeMessage{Challenge: []byte{1}}))
+	assert.False(t, c.peers[p1].helloSent)
+}
@@ -0,0 +1,222 @@
+package cs
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+
+	"github.com/elastos/Elastos.ELA/p2p/msg"
+	"github.com/elastos/Elastos.ELA/p2p/peer"
+)
+
+const (
+	// Scores added to a peer for each kind of misbehavior, the peer is
+	// disconnected and banned once its score reaches MaxMisbehaviorScore
+	invalidMessageScore     = 25
+	unsupportedMessageScore = 10
+	duplicateFloodScore     = 5
+
+	// A peer sending more than maxDuplicatesPerWindow duplicated messages
+	// within duplicateWindow is regarded as flooding
+	duplicateWindow        = time.Minute
+	maxDuplicatesPerWindow = 200
+)
+
+type peerState struct {
+	arbiter      string
+	version      uint32
+	capabilities uint64
+	score        int
+	messages     uint64
+	duplicates   uint64
+	windowStart  time.Time
+	windowDups   int
+	connTime     time.Time
+	// challenge is sent to the peer and expected in its hello message
+	challenge []byte
+	helloSent bool
+}
+
+// unsupportedMessage takes the place of the messages with unknown commands,
+// so the peer sending them can be scored instead of failing silently.
+type unsupportedMessage struct {
+	command string
+}
+
+func (m *unsupportedMessage) CMD() string {
+	return m.command
+}
+
+func (m *unsupportedMessage) MaxLength() uint32 {
+	return msg.MaxBlockSize
+}
+
+func (m *unsupportedMessage) Serialize(w io.Writer) error {
+	return nil
+}
+
+func (m *unsupportedMessage) Deserialize(r io.Reader) error {
+	_, err := io.Copy(ioutil.Discard, r)
+	return err
+}
+
+func peerHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// addPeer registers a new connection, returns false if the peer is banned.
+func (c *p2pclient) addPeer(p *peer.Peer) bool {
+	c.peerLock.Lock()
+	defer c.peerLock.Unlock()
+
+	host := peerHost(p.Addr())
+	if until, ok := c.banned[host]; ok {
+		if time.Now().Before(until) {
+			return false
+		}
+		delete(c.banned, host)
+	}
+	c.peers[p] = &peerState{connTime: time.Now(), windowStart: time.Now()}
+	return true
+}
+
+func (c *p2pclient) removePeer(p *peer.Peer) bool {
+	c.peerLock.Lock()
+	defer c.peerLock.Unlock()
+
+	state, ok := c.peers[p]
+	if !ok {
+		return false
+	}
+	if state.arbiter != "" && c.arbiterPeers[state.arbiter] == p {
+		delete(c.arbiterPeers, state.arbiter)
+	}
+	delete(c.peers, p)
+	return true
+}
+
+// countMessage records a message received from the peer, duplicated messages
+// beyond the flood limit add score to the peer.
+func (c *p2pclient) countMessage(p *peer.Peer, duplicate bool) {
+	c.peerLock.Lock()
+	state, ok := c.peers[p]
+	if !ok {
+		c.peerLock.Unlock()
+		return
+	}
+	state.messages++
+	if !duplicate {
+		c.peerLock.Unlock()
+		return
+	}
+	state.duplicates++
+	now := time.Now()
+	if now.Sub(state.windowStart) > duplicateWindow {
+		state.windowStart = now
+		state.windowDups = 0
+	}
+	state.windowDups++
+	flooding := state.windowDups > maxDuplicatesPerWindow
+	c.peerLock.Unlock()
+
+	if flooding {
+		c.misbehaving(p, duplicateFloodScore, "duplicated messages flood")
+	}
+}
+
+// misbehaving adds score to the misbehavior score of the peer, and disconnects
+// and bans the peer if the score reaches MaxMisbehaviorScore.
+func (c *p2pclient) misbehaving(p *peer.Peer, score int, reason string) {
+	c.peerLock.Lock()
+	state, ok := c.peers[p]
+	if !ok {
+		c.peerLock.Unlock()
+		return
+	}
+	state.score += score
+	total := state.score
+	c.peerLock.Unlock()
+
+	log.Warn("[misbehaving] peer:", p.Addr(), "reason:", reason, "score:", total)
+	if total >= config.Parameters.MaxMisbehaviorScore {
+		c.BanPeer(peerHost(p.Addr()), time.Millisecond*config.Parameters.BanDuration)
+	}
+}
+
+// BanPeer disconnects all peers of the host and refuses their connections
+// until the duration passes.
+func (c *p2pclient) BanPeer(host string, duration time.Duration) {
+	c.peerLock.Lock()
+	c.banned[host] = time.Now().Add(duration)
+	var toDisconnect []*peer.Peer
+	for p := range c.peers {
+		if peerHost(p.Addr()) == host {
+			toDisconnect = append(toDisconnect, p)
+		}
+	}
+	c.peerLock.Unlock()
+
+	log.Warn("[BanPeer] ban host:", host, "duration:", duration)
+	for _, p := range toDisconnect {
+		p.Disconnect()
+	}
+}
+
+// UnbanPeer lifts the ban of the host, returns false if it is not banned.
+func (c *p2pclient) UnbanPeer(host string) bool {
+	c.peerLock.Lock()
+	defer c.peerLock.Unlock()
+
+	if _, ok := c.banned[host]; !ok {
+		return false
+	}
+	delete(c.banned, host)
+	log.Info("[UnbanPeer] unban host:", host)
+	return true
+}
+
+func (c *p2pclient) GetPeerInfo() []*PeerInfo {
+	c.peerLock.Lock()
+	defer c.peerLock.Unlock()
+
+	var peers []*PeerInfo
+	for p, state := range c.peers {
+		peers = append(peers, &PeerInfo{
+			ID:           p.ID(),
+			Addr:         p.Addr(),
+			Arbiter:      state.arbiter,
+			Version:      state.version,
+			Capabilities: state.capabilities,
+			Score:        state.score,
+			Messages:     state.messages,
+			Duplicates:   state.duplicates,
+			ConnTime:     state.connTime.Unix(),
+		})
+	}
+	return peers
+}
+
+func (c *p2pclient) GetBannedPeers() []*BannedPeer {
+	c.peerLock.Lock()
+	defer c.peerLock.Unlock()
+
+	now := time.Now()
+	var banned []*BannedPeer
+	for host, until := range c.banned {
+		if now.After(until) {
+			delete(c.banned, host)
+			continue
+		}
+		banned = append(banned, &BannedPeer{Host: host, Until: until.Unix()})
+	}
+	return banned
+}
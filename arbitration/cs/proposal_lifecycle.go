@@ -0,0 +1,389 @@
+package cs
+
+import (
+	"sort"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
+	. "github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+	"github.com/elastos/Elastos.ELA.Arbiter/store"
+
+	"github.com/elastos/Elastos.ELA/common"
+	. "github.com/elastos/Elastos.ELA/core/types"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+	"github.com/elastos/Elastos.ELA/crypto"
+)
+
+const (
+	proposalCheckInterval = 5 * time.Second
+
+	// maxProposalRecords is the number of finished or rejected proposals whose
+	// status is kept for querying
+	maxProposalRecords = 1000
+)
+
+type proposalState struct {
+	status       string
+	deadline     time.Time
+	rebroadcasts uint32
+	signers      map[string]*ProposalSigner
+	rejecters    map[string]*ProposalSigner
+}
+
+func newProposalState() *proposalState {
+	return &proposalState{
+		status:    ProposalPending,
+		deadline:  time.Now().Add(time.Millisecond * config.Parameters.ProposalTimeout),
+		signers:   make(map[string]*ProposalSigner),
+		rejecters: make(map[string]*ProposalSigner),
+	}
+}
+
+func (state *proposalState) addSigner(publicKey *crypto.PublicKey) {
+	key, err := PublicKeyToString(publicKey)
+	if err != nil {
+		return
+	}
+	delete(state.rejecters, key)
+	state.signers[key] = &ProposalSigner{PublicKey: key, Time: time.Now().Unix()}
+}
+
+func (state *proposalState) addRejecter(publicKey *crypto.PublicKey, reason string) {
+	key, err := PublicKeyToString(publicKey)
+	if err != nil {
+		return
+	}
+	if _, ok := state.signers[key]; ok {
+		return
+	}
+	state.rejecters[key] = &ProposalSigner{PublicKey: key, Time: time.Now().Unix(), Reason: reason}
+}
+
+func (state *proposalState) getSigners() []string {
+	var signers []string
+	for key := range state.signers {
+		signers = append(signers, key)
+	}
+	sort.Strings(signers)
+	return signers
+}
+
+func (state *proposalState) getNonResponders() []string {
+	var nonResponders []string
+	for _, arbiter := range ArbitratorGroupSingleton.GetAllArbitrators() {
+		publicKey, err := PublicKeyFromString(arbiter)
+		if err != nil {
+			continue
+		}
+		key, err := PublicKeyToString(publicKey)
+		if err != nil {
+			continue
+		}
+		_, signed := state.signers[key]
+		_, rejected := state.rejecters[key]
+		if !signed && !rejected {
+			nonResponders = append(nonResponders, key)
+		}
+	}
+	return nonResponders
+}
+
+func (state *proposalState) getStatus(hash common.Uint256) *ProposalStatus {
+	status := &ProposalStatus{
+		TransactionHash: hash.String(),
+		Status:          state.status,
+		NonResponders:   state.getNonResponders(),
+	}
+	for _, key := range state.getSigners() {
+		status.Approved = append(status.Approved, state.signers[key])
+	}
+	for _, rejecter := range state.rejecters {
+		status.Rejected = append(status.Rejected, rejecter)
+	}
+	return status
+}
+
+// finishProposal moves the state of a proposal which is no longer in process
+// to the finished records, dropping the oldest record if there are too many.
+// The caller must hold dns.mux.
+func (dns *DistributedNodeServer) finishProposal(hash common.Uint256, status string) {
+	state, ok := dns.proposalStates[hash]
+	if !ok {
+		return
+	}
+	delete(dns.proposalStates, hash)
+
+	state.status = status
+	if _, ok := dns.finishedProposals[hash]; !ok {
+		dns.finishedOrder = append(dns.finishedOrder, hash)
+	}
+	dns.finishedProposals[hash] = state
+	if len(dns.finishedOrder) > maxProposalRecords {
+		delete(dns.finishedProposals, dns.finishedOrder[0])
+		dns.finishedOrder = dns.finishedOrder[1:]
+	}
+}
+
+// GetProposalStatus returns which arbiters approved, rejected or have not
+// answered the proposal of the withdraw transaction.
+func (dns *DistributedNodeServer) GetProposalStatus(hash common.Uint256) (*ProposalStatus, bool) {
+	dns.tryInit()
+	dns.mux.Lock()
+	defer dns.mux.Unlock()
+
+	if state, ok := dns.proposalStates[hash]; ok {
+		return state.getStatus(hash), true
+	}
+	if state, ok := dns.finishedProposals[hash]; ok {
+		return state.getStatus(hash), true
+	}
+	return nil, false
+}
+
+func (dns *DistributedNodeServer) addProposalSigner(hash common.Uint256, publicKey *crypto.PublicKey) {
+	dns.mux.Lock()
+	defer dns.mux.Unlock()
+
+	if state, ok := dns.proposalStates[hash]; ok {
+		state.addSigner(publicKey)
+	}
+}
+
+// ReceiveProposalRejection records the rejection of a proposal made by current
+// arbiter. Once the remaining arbiters are not enough to reach the agreement
+// count, the proposal is abandoned, so its side chain transactions will be
+// built into a new withdraw transaction.
+func (dns *DistributedNodeServer) ReceiveProposalRejection(msg *RejectProposalMessage) error {
+	dns.tryInit()
+	dns.withdrawMux.Lock()
+	defer dns.withdrawMux.Unlock()
+
+	dns.mux.Lock()
+	txn, ok := dns.unsolvedTransactions[msg.TransactionHash]
+	state, hasState := dns.proposalStates[msg.TransactionHash]
+	dns.mux.Unlock()
+	if !ok || !hasState {
+		// Proposal of other arbiter
+		return nil
+	}
+
+	publicKey, err := VerifyP2PMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	dns.mux.Lock()
+	state.addRejecter(publicKey, msg.Reason.String()+": "+msg.Detail)
+	if dns.metrics.Rejections == nil {
+		dns.metrics.Rejections = make(map[string]uint64)
+	}
+	dns.metrics.Rejections[msg.Reason.String()]++
+	rejections := len(state.rejecters)
+	dns.mux.Unlock()
+
+	log.Warn("[ReceiveProposalRejection] Proposal rejected, txHash:", msg.TransactionHash.String(),
+		"reason:", msg.Reason, "detail:", msg.Detail)
+
+	if ArbitratorGroupSingleton.GetArbitratorsCount()-rejections < getTransactionAgreementArbitratorsCount() {
+		log.Warn("[ReceiveProposalRejection] Proposal can not be agreed, rebuild withdraw transaction, txHash:",
+			msg.TransactionHash.String())
+		dns.abandonProposal(txn)
+	}
+	return nil
+}
+
+func isArbitrator(publicKey *crypto.PublicKey) bool {
+	for _, arbiter := range ArbitratorGroupSingleton.GetAllArbitrators() {
+		pk, err := PublicKeyFromString(arbiter)
+		if err != nil {
+			continue
+		}
+		if crypto.Equal(pk, publicKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// MonitorProposals re-broadcasts the proposals which have not collected enough
+// signatures before their deadlines, and abandons them after
+// ProposalMaxRebroadcasts re-broadcasts.
+func (dns *DistributedNodeServer) MonitorProposals() {
+	dns.tryInit()
+	for {
+		dns.checkProposals(time.Now())
+		time.Sleep(proposalCheckInterval)
+	}
+}
+
+func (dns *DistributedNodeServer) checkProposals(now time.Time) {
+	dns.withdrawMux.Lock()
+	defer dns.withdrawMux.Unlock()
+
+	var timeoutTxs []*Transaction
+	dns.mux.Lock()
+	for hash, state := range dns.proposalStates {
+		if now.Before(state.deadline) {
+			continue
+		}
+		if txn, ok := dns.unsolvedTransactions[hash]; ok {
+			timeoutTxs = append(timeoutTxs, txn)
+		}
+	}
+	dns.mux.Unlock()
+
+	for _, txn := range timeoutTxs {
+		dns.mux.Lock()
+		state, ok := dns.proposalStates[txn.Hash()]
+		dns.mux.Unlock()
+		if !ok {
+			continue
+		}
+
+		if state.rebroadcasts >= config.Parameters.ProposalMaxRebroadcasts {
+			dns.abandonProposal(txn)
+			continue
+		}
+		if err := dns.rebroadcastProposal(txn, state, now); err != nil {
+			log.Warn("[checkProposals] Re-broadcast proposal failed, txHash:", txn.Hash().String(), "err:", err)
+		}
+	}
+}
+
+// rebroadcastProposal signs the proposal again and sends it to each arbiter
+// which has not answered. The new signature makes a message which has not been
+// seen by the peers, so the non responders get another chance to sign it.
+func (dns *DistributedNodeServer) rebroadcastProposal(txn *Transaction, state *proposalState, now time.Time) error {
+	_, content, err := createProposalItem(txn, &DistrubutedItemFuncImpl{})
+	if err != nil {
+		return err
+	}
+
+	dns.mux.Lock()
+	state.rebroadcasts++
+	state.deadline = now.Add(time.Millisecond * config.Parameters.ProposalTimeout)
+	dns.metrics.Rebroadcasts++
+	nonResponders := state.getNonResponders()
+	dns.mux.Unlock()
+
+	for _, arbiter := range nonResponders {
+		publicKey, err := common.HexStringToBytes(arbiter)
+		if err != nil || isCurrentArbitrator(publicKey) {
+			continue
+		}
+		msg := &SignMessage{Command: dns.P2pCommand, Content: content}
+		if err := P2PClientSingleton.SendToArbitrator(arbiter, msg); err != nil {
+			log.Warn("[rebroadcastProposal] Send proposal to arbiter:", arbiter, "failed, err:", err)
+		}
+	}
+
+	log.Info("[rebroadcastProposal] Re-broadcast proposal, txHash:", txn.Hash().String(),
+		"non responders:", nonResponders)
+	return nil
+}
+
+// abandonProposal drops the proposal and releases the UTXOs it used. The side
+// chain transactions of the proposal are kept in the cache, and are proposed
+// again unless another proposal still holds them.
+func (dns *DistributedNodeServer) abandonProposal(txn *Transaction) {
+	hash := txn.Hash()
+	dns.mux.Lock()
+	txHashes := dns.releaseProposal(hash)
+	dns.finishProposal(hash, ProposalAbandoned)
+	dns.metrics.Abandoned++
+	dns.mux.Unlock()
+
+	log.Warn("[abandonProposal] Proposal abandoned, txHash:", hash.String())
+
+	if err := store.DbCache.MainChainStore.RemoveProposal(hash.String()); err != nil {
+		log.Warn("[abandonProposal] Remove proposal failed, txHash:", hash.String(), "err:", err)
+	}
+
+	withdrawPayload, ok := txn.Payload.(*payload.PayloadWithdrawFromSideChain)
+	if !ok {
+		return
+	}
+	currentArbitrator := ArbitratorGroupSingleton.GetCurrentArbitrator()
+	sideChain, ok := currentArbitrator.GetSideChainManager().GetChain(withdrawPayload.GenesisBlockAddress)
+	if !ok {
+		return
+	}
+
+	var outPoints []OutPoint
+	for _, input := range txn.Inputs {
+		outPoints = append(outPoints, input.Previous)
+	}
+	sideChain.RemoveLastUsedOutPoints(outPoints)
+
+	if currentArbitrator.IsOnDutyOfMain() && len(txHashes) != 0 {
+		go sideChain.SendWithdrawTxs(txHashes)
+	}
+}
+
+// releaseProposal removes the unsolved proposal and returns its side chain
+// transactions not held by the other unsolved proposals.
+func (dns *DistributedNodeServer) releaseProposal(hash common.Uint256) []string {
+	txn, ok := dns.unsolvedTransactions[hash]
+	if !ok {
+		return nil
+	}
+	delete(dns.unsolvedTransactions, hash)
+
+	withdrawPayload, ok := txn.Payload.(*payload.PayloadWithdrawFromSideChain)
+	if !ok {
+		return nil
+	}
+	held := make(map[common.Uint256]bool)
+	for _, other := range dns.unsolvedTransactions {
+		if otherPayload, ok := other.Payload.(*payload.PayloadWithdrawFromSideChain); ok {
+			for _, txHash := range otherPayload.SideChainTransactionHashes {
+				held[txHash] = true
+			}
+		}
+	}
+	var txHashes []string
+	for _, txHash := range withdrawPayload.SideChainTransactionHashes {
+		if !held[txHash] {
+			txHashes = append(txHashes, txHash.String())
+		}
+	}
+	return txHashes
+}
+
+func (dns *DistributedNodeServer) GetProposals() []*ProposalInfo {
+	dns.tryInit()
+	dns.mux.Lock()
+	defer dns.mux.Unlock()
+
+	var proposals []*ProposalInfo
+	for hash, txn := range dns.unsolvedTransactions {
+		info := &ProposalInfo{TransactionHash: hash.String()}
+		if withdrawPayload, ok := txn.Payload.(*payload.PayloadWithdrawFromSideChain); ok {
+			info.GenesisBlockAddress = withdrawPayload.GenesisBlockAddress
+		}
+		if state, ok := dns.proposalStates[hash]; ok {
+			info.Deadline = state.deadline.Unix()
+			info.Broadcasts = state.rebroadcasts + 1
+			info.Signers = state.getSigners()
+			info.NonResponders = state.getNonResponders()
+		}
+		proposals = append(proposals, info)
+	}
+	return proposals
+}
+
+func (dns *DistributedNodeServer) GetProposalMetrics() ProposalMetrics {
+	dns.tryInit()
+	dns.mux.Lock()
+	defer dns.mux.Unlock()
+
+	metrics := dns.metrics
+	metrics.Pending = len(dns.unsolvedTransactions)
+	metrics.Rejections = make(map[string]uint64, len(dns.metrics.Rejections))
+	for reason, count := range dns.metrics.Rejections {
+		metrics.Rejections[reason] = count
+	}
+	return metrics
+}
@@ -0,0 +1,46 @@
+package cs
+
+import (
+	"testing"
+
+	"github.com/elastos/Elastos.ELA/common"
+	. "github.com/elastos/Elastos.ELA/core/types"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestProposal(sideChainTxHashes ...common.Uint256) *Transaction {
+	return &Transaction{
+		TxType: WithdrawFromSideChain,
+		Payload: &payload.PayloadWithdrawFromSideChain{
+			GenesisBlockAddress:        "XQd1DCi6H62NQdWZQhJCRnrPn7sF9CTjaU",
+			SideChainTransactionHashes: sideChainTxHashes,
+		},
+	}
+}
+
+func TestReleaseProposal(t *testing.T) {
+	dns := &DistributedNodeServer{}
+	dns.tryInit()
+
+	// Two batches of the same side chain are in flight, one is abandoned
+	abandoned := newTestProposal(common.Uint256{1}, common.Uint256{2})
+	inFlight := newTestProposal(common.Uint256{3}, common.Uint256{4})
+	dns.unsolvedTransactions[abandoned.Hash()] = abandoned
+	dns.unsolvedTransactions[inFlight.Hash()] = inFlight
+
+	txHashes := dns.releaseProposal(abandoned.Hash())
+	assert.Equal(t, []string{common.Uint256{1}.String(), common.Uint256{2}.String()}, txHashes)
+	assert.Equal(t, 1, len(dns.unsolvedTransactions))
+	assert.Equal(t, inFlight, dns.unsolvedTransactions[inFlight.Hash()])
+
+	// Side chain transactions still held by another proposal are not proposed
+	// again
+	overlapped := newTestProposal(common.Uint256{4}, common.Uint256{5})
+	dns.unsolvedTransactions[overlapped.Hash()] = overlapped
+	txHashes = dns.releaseProposal(overlapped.Hash())
+	assert.Equal(t, []string{common.Uint256{5}.String()}, txHashes)
+
+	assert.Nil(t, dns.releaseProposal(overlapped.Hash()))
+	assert.Equal(t, 1, len(dns.unsolvedTransactions))
+}
@@ -0,0 +1,215 @@
+package cs
+
+import (
+	"io"
+	"io/ioutil"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/p2p"
+	"github.com/elastos/Elastos.ELA/p2p/msg"
+	"github.com/elastos/Elastos.ELA/p2p/peer"
+)
+
+const (
+	// ProtocolVersion is the latest version of the messages between arbiters
+	// this node understands, MinProtocolVersion is the oldest one.
+	ProtocolVersion    uint32 = 1
+	MinProtocolVersion uint32 = 1
+)
+
+// Capabilities of an arbiter, announced in the hello message when a peer
+// connects, so features are only used with the peers supporting them.
+const (
+	// CapDirectRoute means the arbiter handles messages addressed to it and
+	// passes on messages addressed to others.
+	CapDirectRoute uint64 = 1 << iota
+	// CapProposalRejection means the arbiter understands reject proposal
+	// messages.
+	CapProposalRejection
+	// CapConsolidation means the arbiter signs withdraw transactions which
+	// consolidate the utxos of genesis block addresses.
+	CapConsolidation
+)
+
+// LocalCapabilities is the capabilities of this node.
+const LocalCapabilities = CapDirectRoute | CapProposalRejection | CapConsolidation
+
+// VersionedMessage is a message whose serialization starts with its version.
+type VersionedMessage interface {
+	GetVersion() uint32
+	SetVersion(version uint32)
+}
+
+// MessageVersion is embedded in the messages between arbiters, the version is
+// the first field of the serialized message and is covered by the signature.
+type MessageVersion struct {
+	Version uint32
+
+	// unsupportedPayload is the rest of a message with an unsupported version,
+	// kept so the message is relayed as received.
+	unsupportedPayload []byte
+}
+
+func (v *MessageVersion) GetVersion() uint32 {
+	return v.Version
+}
+
+func (v *MessageVersion) SetVersion(version uint32) {
+	v.Version = version
+}
+
+func (v *MessageVersion) serializeVersion(w io.Writer) error {
+	return common.WriteUint32(w, v.Version)
+}
+
+// deserializeVersion reads the version of the message and returns if the rest
+// of the message can be read. The rest of a message with an unsupported version
+// is kept unread, so the peer sending it is not disconnected.
+func (v *MessageVersion) deserializeVersion(r io.Reader) (bool, error) {
+	version, err := common.ReadUint32(r)
+	if err != nil {
+		return false, err
+	}
+	v.Version = version
+	if !isSupportedVersion(version) {
+		v.unsupportedPayload, err = ioutil.ReadAll(r)
+		return false, err
+	}
+	return true, nil
+}
+
+// relayedMessage returns the message with an unsupported version as received.
+func (v *MessageVersion) relayedMessage(command string) *relayedMessage {
+	return &relayedMessage{command: command, version: v.Version, payload: v.unsupportedPayload}
+}
+
+// relayedMessage is a message in a version this node does not understand, it
+// is relayed as received for the arbiters of newer versions.
+type relayedMessage struct {
+	command string
+	version uint32
+	payload []byte
+}
+
+func (m *relayedMessage) CMD() string {
+	return m.command
+}
+
+func (m *relayedMessage) MaxLength() uint32 {
+	return msg.MaxBlockSize
+}
+
+func (m *relayedMessage) Serialize(w io.Writer) error {
+	if err := common.WriteUint32(w, m.version); err != nil {
+		return err
+	}
+	_, err := w.Write(m.payload)
+	return err
+}
+
+func (m *relayedMessage) Deserialize(r io.Reader) error {
+	version, err := common.ReadUint32(r)
+	if err != nil {
+		return err
+	}
+	m.version = version
+	m.payload, err = ioutil.ReadAll(r)
+	return err
+}
+
+// relayUnsupportedMessage relays the message in a version this node does not
+// understand as received, so newer arbiters still reach each other through
+// this node during upgrades, but does not process it.
+func (c *p2pclient) relayUnsupportedMessage(p *peer.Peer, message p2p.Message) {
+	versioned, ok := message.(interface {
+		relayedMessage(command string) *relayedMessage
+	})
+	if !ok {
+		return
+	}
+	relayed := versioned.relayedMessage(message.CMD())
+
+	msgHash := c.GetMessageHash(relayed)
+	if c.ExistMessageHash(msgHash) {
+		c.countMessage(p, true)
+		return
+	}
+	c.countMessage(p, false)
+	c.AddMessageHash(msgHash)
+
+	log.Debug("[HandleMessage] relay msg:", message.CMD(), "of unsupported version:", relayed.version,
+		"from peer id-", p.ID())
+	c.Broadcast(relayed)
+}
+
+func isSupportedVersion(version uint32) bool {
+	return version >= MinProtocolVersion && version <= ProtocolVersion
+}
+
+// negotiatedVersion returns the highest message version all the connected
+// arbiters understand, so messages are readable during rolling upgrades.
+func (c *p2pclient) negotiatedVersion() uint32 {
+	c.peerLock.Lock()
+	defer c.peerLock.Unlock()
+
+	version := ProtocolVersion
+	for _, state := range c.peers {
+		if state.arbiter == "" {
+			continue
+		}
+		if state.version < version {
+			version = state.version
+		}
+	}
+	if version < MinProtocolVersion {
+		version = MinProtocolVersion
+	}
+	return version
+}
+
+// signMessage sets the message version negotiated with the connected arbiters
+// and signs the message by current arbiter.
+func (c *p2pclient) signMessage(msg AuthenticatedMessage) error {
+	if versioned, ok := msg.(VersionedMessage); ok {
+		versioned.SetVersion(c.negotiatedVersion())
+	}
+	return SignP2PMessage(msg)
+}
+
+// ArbiterSupports returns if the arbiter with the given public key supports
+// the capability. Arbiters not connected directly are assumed to support it,
+// since messages to them are passed on by others.
+func (c *p2pclient) ArbiterSupports(arbiter string, capability uint64) bool {
+	c.peerLock.Lock()
+	defer c.peerLock.Unlock()
+
+	p, ok := c.arbiterPeers[arbiter]
+	if !ok {
+		return true
+	}
+	state, ok := c.peers[p]
+	if !ok {
+		return true
+	}
+	return state.capabilities&capability == capability
+}
+
+// PeersSupport returns if all the connected arbiters support the capability.
+func (c *p2pclient) PeersSupport(capability uint64) bool {
+	c.peerLock.Lock()
+	defer c.peerLock.Unlock()
+
+	for p, state := range c.peers {
+		if state.arbiter == "" {
+			continue
+		}
+		if state.capabilities&capability != capability {
+			log.Debug("[PeersSupport] arbiter:", state.arbiter, "of peer:", p.Addr(),
+				"does not support capability:", capability)
+			return false
+		}
+	}
+	return true
+}
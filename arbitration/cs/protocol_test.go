@@ -0,0 +1,133 @@
+package cs
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types"
+	"github.com/elastos/Elastos.ELA/p2p"
+	"github.com/elastos/Elastos.ELA/p2p/peer"
+	"github.com/elastos/Elastos.ELA/p2p/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendLastArbiterUsedUTXOMessage_Version(t *testing.T) {
+	msg := &SendLastArbiterUsedUTXOMessage{
+		Command:        SendLastArbiterUsedUtxoCommand,
+		GenesisAddress: "XQd1DCi6H62NQdWZQhJCRnrPn7sF9CTjaU",
+		Height:         100,
+		OutPoints:      []types.OutPoint{{TxID: common.Uint256{1}, Index: 2}},
+		Nonce:          "nonce",
+		MessageVersion: MessageVersion{Version: ProtocolVersion},
+		Envelope:       Envelope{PublicKey: []byte{1}, Target: []byte{2}, Timestamp: 1540000000, Signature: []byte{3}},
+	}
+	buf := new(bytes.Buffer)
+	assert.NoError(t, msg.Serialize(buf))
+
+	received := &SendLastArbiterUsedUTXOMessage{Command: SendLastArbiterUsedUtxoCommand}
+	assert.NoError(t, received.Deserialize(bytes.NewReader(buf.Bytes())))
+	assert.Equal(t, msg, received)
+
+	// Messages from newer arbiters are read without error but left empty
+	msg.Version = ProtocolVersion + 1
+	buf.Reset()
+	assert.NoError(t, msg.Serialize(buf))
+
+	received = &SendLastArbiterUsedUTXOMessage{Command: SendLastArbiterUsedUtxoCommand}
+	reader := bytes.NewReader(buf.Bytes())
+	assert.NoError(t, received.Deserialize(reader))
+	assert.Equal(t, ProtocolVersion+1, received.GetVersion())
+	assert.Equal(t, "", received.GenesisAddress)
+	assert.Equal(t, 0, reader.Len())
+	assert.False(t, isSupportedVersion(received.GetVersion()))
+}
+
+// testP2PServer records the broadcast messages.
+type testP2PServer struct {
+	p2pServer
+	broadcast chan p2p.Message
+}
+
+func (s *testP2PServer) ConnectedPeers() []server.IPeer {
+	return nil
+}
+
+func (s *testP2PServer) BroadcastMessage(msg p2p.Message) {
+	s.broadcast <- msg
+}
+
+func TestHandleMessage_UnsupportedVersion(t *testing.T) {
+	msg := &SendLastArbiterUsedUTXOMessage{
+		Command:        SendLastArbiterUsedUtxoCommand,
+		GenesisAddress: "XQd1DCi6H62NQdWZQhJCRnrPn7sF9CTjaU",
+		Nonce:          "nonce",
+		MessageVersion: MessageVersion{Version: ProtocolVersion + 1},
+		Envelope:       Envelope{PublicKey: []byte{1}, Timestamp: 1540000000, Signature: []byte{3}},
+	}
+	buf := new(bytes.Buffer)
+	assert.NoError(t, msg.Serialize(buf))
+	raw := buf.Bytes()
+
+	p := &peer.Peer{}
+	s := &testP2PServer{broadcast: make(chan p2p.Message, 2)}
+	c := &p2pclient{
+		peers:        map[*peer.Peer]*peerState{p: {connTime: time.Now()}},
+		messageCache: newMessageCache(0, time.Minute),
+		server:       s,
+	}
+
+	// The message is relayed as received although it can not be read
+	for i := 0; i < 2; i++ {
+		received := &SendLastArbiterUsedUTXOMessage{Command: SendLastArbiterUsedUtxoCommand}
+		assert.NoError(t, received.Deserialize(bytes.NewReader(raw)))
+		c.handleMessage(p, received)
+	}
+	select {
+	case relayed := <-s.broadcast:
+		assert.Equal(t, SendLastArbiterUsedUtxoCommand, relayed.CMD())
+		buf.Reset()
+		assert.NoError(t, relayed.Serialize(buf))
+		assert.Equal(t, raw, buf.Bytes())
+	case <-time.After(time.Second):
+		t.Fatal("Message of unsupported version should be relayed.")
+	}
+
+	// The duplicated one is not relayed again
+	select {
+	case <-s.broadcast:
+		t.Error("Duplicated message should not be relayed.")
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.Equal(t, uint64(1), c.peers[p].duplicates)
+}
+
+func TestCheckEnvelopeTime(t *testing.T) {
+	now := time.Unix(1540000000, 0)
+	expiration := 10 * time.Minute
+	for _, test := range []struct {
+		offset time.Duration
+		valid  bool
+	}{
+		{0, true},
+		{-maxMessageTimeOffset, true},
+		{-maxMessageTimeOffset - time.Second, false},
+		{expiration - maxMessageTimeOffset, true},
+		{expiration - maxMessageTimeOffset + time.Second, false},
+	} {
+		envelope := &Envelope{Timestamp: now.Add(-test.offset).Unix()}
+		err := checkEnvelopeTime(envelope, expiration, now)
+		assert.Equal(t, test.valid, err == nil, "offset %s", test.offset)
+	}
+
+	// The timestamp is signed, so it can not be refreshed by a replayer
+	msg := &SignMessage{Command: "test", Content: []byte{1}}
+	msg.Timestamp = 1540000000
+	data, err := getSignedData(msg)
+	assert.NoError(t, err)
+	msg.Timestamp++
+	refreshed, err := getSignedData(msg)
+	assert.NoError(t, err)
+	assert.NotEqual(t, data, refreshed)
+}
@@ -10,6 +10,8 @@ import (
 type SignMessage struct {
 	Command string
 	Content []byte
+	MessageVersion
+	Envelope
 }
 
 func (s *SignMessage) CMD() string {
@@ -20,15 +22,31 @@ func (s *SignMessage) MaxLength() uint32 {
 	return msg.MaxBlockSize
 }
 
-func (s *SignMessage) Serialize(w io.Writer) error {
+func (s *SignMessage) SerializeUnsigned(w io.Writer) error {
+	err := s.serializeVersion(w)
+	if err != nil {
+		return err
+	}
 	return common.WriteVarBytes(w, s.Content)
 }
 
+func (s *SignMessage) Serialize(w io.Writer) error {
+	err := s.SerializeUnsigned(w)
+	if err != nil {
+		return err
+	}
+	return s.Envelope.Serialize(w)
+}
+
 func (s *SignMessage) Deserialize(r io.Reader) error {
+	supported, err := s.deserializeVersion(r)
+	if err != nil || !supported {
+		return err
+	}
 	content, err := common.ReadVarBytes(r, msg.MaxBlockSize, "Content")
 	if err != nil {
 		return err
 	}
 	s.Content = content
-	return nil
+	return s.Envelope.Deserialize(r)
 }
@@ -0,0 +1,118 @@
+package mainchain
+
+import (
+	"math/rand"
+	"strconv"
+
+	. "github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
+	. "github.com/elastos/Elastos.ELA.Arbiter/arbitration/cs"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+	. "github.com/elastos/Elastos.ELA.Arbiter/store"
+
+	. "github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/contract/program"
+	. "github.com/elastos/Elastos.ELA/core/types"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+)
+
+// CreateConsolidateTransaction creates a transaction merging the dust utxos of
+// the genesis block address into one output of the same address. It is a
+// withdraw transaction without side chain transactions, so it is signed by
+// the arbiters through the withdraw proposal flow. Nil is returned if there
+// are not enough dust utxos.
+func (mc *MainChainImpl) CreateConsolidateTransaction(sideChain SideChain, mcFunc MainChainFunc) (*Transaction, error) {
+	// Arbiters not upgraded yet would refuse to sign the transaction
+	if P2PClientSingleton != nil && !P2PClientSingleton.PeersSupport(CapConsolidation) {
+		log.Info("[CreateConsolidateTransaction] Not all arbiters support consolidation, skip")
+		return nil, nil
+	}
+
+	withdrawBank := sideChain.GetKey()
+	availableUTXOs, err := mcFunc.GetAvailableUtxos(withdrawBank)
+	if err != nil {
+		return nil, err
+	}
+
+	ops := sideChain.GetLastUsedOutPoints()
+	var dustUTXOs []*AddressUTXO
+	for _, utxo := range sortUTXOs(availableUTXOs, true) {
+		if *utxo.Amount >= Fixed64(config.Parameters.ConsolidateDustThreshold) {
+			break
+		}
+		isUsed := false
+		for _, op := range ops {
+			if op.IsEqual(utxo.Input.Previous) {
+				isUsed = true
+				break
+			}
+		}
+		if !isUsed {
+			dustUTXOs = append(dustUTXOs, utxo)
+		}
+	}
+
+	if len(dustUTXOs) < config.Parameters.ConsolidateMinUTXOs {
+		return nil, nil
+	}
+	if len(dustUTXOs) > config.Parameters.ConsolidateMaxUTXOs {
+		dustUTXOs = dustUTXOs[:config.Parameters.ConsolidateMaxUTXOs]
+	}
+
+	// Create transaction inputs
+	var txInputs []*Input
+	for _, utxo := range dustUTXOs {
+		txInputs = append(txInputs, utxo.Input)
+	}
+
+	programHash, err := Uint168FromAddress(withdrawBank)
+	if err != nil {
+		return nil, err
+	}
+	txOutput := &Output{
+		AssetID:     Uint256(SystemAssetId),
+		OutputLock:  uint32(0),
+		ProgramHash: *programHash,
+	}
+
+	redeemScript, err := CreateRedeemScript()
+	if err != nil {
+		return nil, err
+	}
+
+	chainHeight, err := mcFunc.GetMainNodeCurrentHeight()
+	if err != nil {
+		return nil, err
+	}
+
+	txPayload := &payload.PayloadWithdrawFromSideChain{
+		BlockHeight:         chainHeight,
+		GenesisBlockAddress: withdrawBank,
+	}
+	p := &program.Program{redeemScript, nil}
+
+	// Create attributes
+	txAttr := NewAttribute(Nonce, []byte(strconv.FormatInt(rand.Int63(), 10)))
+	attributes := make([]*Attribute, 0)
+	attributes = append(attributes, &txAttr)
+
+	txn := &Transaction{
+		TxType:     WithdrawFromSideChain,
+		Payload:    txPayload,
+		Attributes: attributes,
+		Inputs:     txInputs,
+		Outputs:    []*Output{txOutput},
+		Programs:   []*program.Program{p},
+		LockTime:   uint32(0),
+	}
+
+	// The size does not depend on the output value, so pay the fee after
+	// the transaction is built
+	fee := GetRequiredWithdrawFee(GetWithdrawTransactionSize(txn))
+	txOutput.Value = sumUTXOs(dustUTXOs) - fee
+	if txOutput.Value <= 0 {
+		return nil, nil
+	}
+
+	return txn, nil
+}
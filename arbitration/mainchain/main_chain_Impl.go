@@ -40,6 +40,7 @@ func (mc *MainChainImpl) SyncMainChainCachedTxs() error {
 	}
 
 	allSideChainTxHashes := make(map[SideChain][]string, 0)
+	allSideChainTxHeights := make(map[SideChain][]uint32, 0)
 	for _, tx := range txs {
 		sc, ok := ArbitratorGroupSingleton.GetCurrentArbitrator().GetSideChainManager().GetChain(tx.GenesisBlockAddress)
 		if !ok {
@@ -56,36 +57,35 @@ func (mc *MainChainImpl) SyncMainChainCachedTxs() error {
 		}
 		if hasSideChainInMap {
 			allSideChainTxHashes[sc] = append(allSideChainTxHashes[sc], tx.TransactionHash)
+			allSideChainTxHeights[sc] = append(allSideChainTxHeights[sc], tx.Proof.Height)
 		} else {
 			allSideChainTxHashes[sc] = []string{tx.TransactionHash}
+			allSideChainTxHeights[sc] = []uint32{tx.Proof.Height}
 		}
 	}
 
 	for k, v := range allSideChainTxHashes {
-		go mc.createAndSendDepositTransactionsInDB(k, v)
+		go mc.createAndSendDepositTransactionsInDB(k, v, allSideChainTxHeights[k])
 	}
 
 	return nil
 }
 
-func (mc *MainChainImpl) createAndSendDepositTransactionsInDB(sideChain SideChain, txHashes []string) {
+func (mc *MainChainImpl) createAndSendDepositTransactionsInDB(sideChain SideChain, txHashes []string, blockHeights []uint32) {
 	receivedTxs, err := sideChain.GetExistDepositTransactions(txHashes)
 	if err != nil {
 		log.Warn("[SyncMainChainCachedTxs] Get exist deposit transactions failed, err:", err.Error())
 		return
 	}
 	unsolvedTxs := SubstractTransactionHashes(txHashes, receivedTxs)
+	receivedBlockHeights := GetTransactionBlockHeights(txHashes, blockHeights, receivedTxs)
 	var addresses []string
 	for i := 0; i < len(receivedTxs); i++ {
 		addresses = append(addresses, sideChain.GetKey())
 	}
-	err = DbCache.MainChainStore.RemoveMainChainTxs(receivedTxs, addresses)
+	err = TxsFinisherSingleton.FinishDepositTxs(true, receivedTxs, addresses, receivedBlockHeights, nil)
 	if err != nil {
-		log.Warn("[SyncMainChainCachedTxs] Remove main chain txs failed, err:", err.Error())
-	}
-	err = FinishedTxsDbCache.AddSucceedDepositTxs(receivedTxs, addresses)
-	if err != nil {
-		log.Error("[SyncMainChainCachedTxs] Add succeed deposit transactions into finished db failed, err:", err.Error())
+		log.Error("[SyncMainChainCachedTxs] Move succeed deposit transactions into finished db failed, err:", err.Error())
 	}
 
 	spvTxs, err := DbCache.MainChainStore.GetMainChainTxsFromHashes(unsolvedTxs, sideChain.GetKey())
@@ -98,13 +98,15 @@ func (mc *MainChainImpl) createAndSendDepositTransactionsInDB(sideChain SideChai
 }
 
 func (mc *MainChainImpl) OnP2PReceived(peer *peer.Peer, msg p2p.Message) error {
-	if msg.CMD() != mc.P2pCommand {
+	if msg.CMD() != mc.P2pCommand && msg.CMD() != RejectProposalCommand {
 		return nil
 	}
 
 	switch m := msg.(type) {
 	case *SignMessage:
 		return mc.ReceiveProposalFeedback(m.Content)
+	case *RejectProposalMessage:
+		return mc.ReceiveProposalRejection(m)
 	}
 	return nil
 }
@@ -143,84 +145,32 @@ func (mc *MainChainImpl) CreateWithdrawTransaction(sideChain SideChain, withdraw
 		return nil, err
 	}
 
-	//get real available utxos
-	ops := sideChain.GetLastUsedOutPoints()
-
-	var realAvailableUtxos []*AddressUTXO
-	var unavailableUtxos []*AddressUTXO
-	for _, utxo := range availableUTXOs {
-		isUsed := false
-		for _, ops := range ops {
-			if ops.IsEqual(utxo.Input.Previous) {
-				isUsed = true
-			}
-		}
-		if !isUsed {
-			realAvailableUtxos = append(realAvailableUtxos, utxo)
-		} else {
-			unavailableUtxos = append(unavailableUtxos, utxo)
-		}
+	selector, err := getUTXOSelector(withdrawBank)
+	if err != nil {
+		return nil, err
+	}
+	selectedUTXOs, err := SelectWithdrawUTXOs(selector, availableUTXOs, sideChain.GetLastUsedOutPoints(), totalOutputAmount)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create transaction inputs
 	var txInputs []*Input
-	for _, utxo := range realAvailableUtxos {
+	for _, utxo := range selectedUTXOs {
 		txInputs = append(txInputs, utxo.Input)
-		if *utxo.Amount < totalOutputAmount {
-			totalOutputAmount -= *utxo.Amount
-		} else if *utxo.Amount == totalOutputAmount {
-			totalOutputAmount = 0
-			break
-		} else if *utxo.Amount > totalOutputAmount {
-			programHash, err := Uint168FromAddress(withdrawBank)
-			if err != nil {
-				return nil, err
-			}
-			change := &Output{
-				AssetID:     Uint256(SystemAssetId),
-				Value:       Fixed64(*utxo.Amount - totalOutputAmount),
-				OutputLock:  uint32(0),
-				ProgramHash: *programHash,
-			}
-			txOutputs = append(txOutputs, change)
-			totalOutputAmount = 0
-			break
-		}
 	}
 
-	//if available utxo is not enough, try to use unavailable utxos from biggest one
-	if totalOutputAmount > 0 && len(unavailableUtxos) != 0 {
-		for i := len(unavailableUtxos) - 1; i >= 0; i++ {
-			utxo := unavailableUtxos[i]
-			txInputs = append(txInputs, utxo.Input)
-			if *utxo.Amount < totalOutputAmount {
-				totalOutputAmount -= *utxo.Amount
-			} else if *utxo.Amount == totalOutputAmount {
-				totalOutputAmount = 0
-				break
-			} else if *utxo.Amount > totalOutputAmount {
-				programHash, err := Uint168FromAddress(withdrawBank)
-				if err != nil {
-					return nil, err
-				}
-				change := &Output{
-					AssetID:     Uint256(SystemAssetId),
-					Value:       Fixed64(*utxo.Amount - totalOutputAmount),
-					OutputLock:  uint32(0),
-					ProgramHash: *programHash,
-				}
-				txOutputs = append(txOutputs, change)
-				totalOutputAmount = 0
-				break
-			}
+	if change := sumUTXOs(selectedUTXOs) - totalOutputAmount; change > 0 {
+		programHash, err := Uint168FromAddress(withdrawBank)
+		if err != nil {
+			return nil, err
 		}
-	}
-
-	if totalOutputAmount > 0 {
-		return nil, errors.New("Available token is not enough")
-	}
-	if err != nil {
-		return nil, err
+		txOutputs = append(txOutputs, &Output{
+			AssetID:     Uint256(SystemAssetId),
+			Value:       change,
+			OutputLock:  uint32(0),
+			ProgramHash: *programHash,
+		})
 	}
 
 	redeemScript, err := CreateRedeemScript()
@@ -258,7 +208,7 @@ func (mc *MainChainImpl) CreateWithdrawTransaction(sideChain SideChain, withdraw
 	attributes := make([]*Attribute, 0)
 	attributes = append(attributes, &txAttr)
 
-	return &Transaction{
+	txn := &Transaction{
 		TxType:     WithdrawFromSideChain,
 		Payload:    txPayload,
 		Attributes: attributes,
@@ -266,7 +216,16 @@ func (mc *MainChainImpl) CreateWithdrawTransaction(sideChain SideChain, withdraw
 		Outputs:    txOutputs,
 		Programs:   []*program.Program{p},
 		LockTime:   uint32(0),
-	}, nil
+	}
+
+	// Check the fee is enough for the size of the signed transaction
+	fee := GetWithdrawFee(withdrawInfo, exchangeRate)
+	requiredFee := GetRequiredWithdrawFee(GetWithdrawTransactionSize(txn))
+	if fee < requiredFee {
+		return nil, &InsufficientFeeError{Fee: fee, Required: requiredFee}
+	}
+
+	return txn, nil
 }
 
 func (mc *MainChainImpl) SyncChainData() {
@@ -292,17 +251,61 @@ func (mc *MainChainImpl) SyncChainData() {
 		}
 
 		for currentHeight < chainHeight {
-			err := mc.syncAndProcessBlock(currentHeight + 1)
+			block, err := rpc.GetBlockByHeight(currentHeight+1, config.Parameters.MainNode.Rpc)
 			if err != nil {
 				log.Error("get block by height failed, chain height:", chainHeight,
 					"current height:", currentHeight+1, "err:", err.Error())
 				break
 			}
+
+			// Check if the block is connected to the last processed block
+			if hash, err := DbCache.UTXOStore.GetBlockHash(currentHeight); err == nil &&
+				hash != block.PreviousBlockHash {
+				log.Warn("[SyncChainData] main chain reorganized at height:", currentHeight,
+					"stored block hash:", hash, "previous block hash:", block.PreviousBlockHash)
+				currentHeight = mc.rollbackBlock(currentHeight)
+				continue
+			}
+
+			if err := mc.processBlock(block, currentHeight+1); err != nil {
+				log.Error("process block failed, chain height:", chainHeight,
+					"current height:", currentHeight+1, "err:", err.Error())
+				break
+			}
 			currentHeight += 1
 		}
 		// Update wallet height
 		currentHeight = DbCache.UTXOStore.CurrentHeight(currentHeight)
 	}
+
+	if err := mc.ExpireProposals(DbCache.UTXOStore.CurrentHeight(QueryHeightCode)); err != nil {
+		log.Warn("[SyncChainData] expire proposals failed, err:", err.Error())
+	}
+}
+
+// rollbackBlock reverts the UTXO changes of the orphaned block at height and
+// returns the height to continue syncing from. If the block can not be
+// reverted, the UTXO cache is reset and synced again from the genesis block.
+func (mc *MainChainImpl) rollbackBlock(height uint32) uint32 {
+	sideChains := ArbitratorGroupSingleton.GetCurrentArbitrator().GetSideChainManager().GetAllChains()
+	for _, sc := range sideChains {
+		sc.ClearLastUsedOutPoints()
+	}
+
+	if err := DbCache.UTXOStore.RollbackBlock(height); err != nil {
+		log.Error("[rollbackBlock] rollback block at height:", height, "failed:", err.Error(),
+			", reset utxo cache and sync from genesis block")
+		if err := DbCache.UTXOStore.ResetDataStore(); err != nil {
+			log.Error("[rollbackBlock] reset utxo cache failed:", err.Error())
+		}
+		return 0
+	}
+
+	log.Info("[rollbackBlock] rolled back orphaned block at height:", height)
+	if height == 0 {
+		return 0
+	}
+	return height - 1
 }
 
 func (mc *MainChainImpl) syncAndProcessBlock(currentHeight uint32) error {
@@ -311,8 +314,7 @@ func (mc *MainChainImpl) syncAndProcessBlock(currentHeight uint32) error {
 		return err
 	}
 
-	mc.processBlock(block, currentHeight)
-	return nil
+	return mc.processBlock(block, currentHeight)
 }
 
 func (mc *MainChainImpl) needSyncBlocks() (uint32, uint32, bool) {
@@ -355,7 +357,7 @@ func (mc *MainChainImpl) containGenesisBlockAddress(address string) bool {
 	return false
 }
 
-func (mc *MainChainImpl) processBlock(block *BlockInfo, height uint32) {
+func (mc *MainChainImpl) processBlock(block *BlockInfo, height uint32) error {
 	log.Info("[processBlock] block height:", block.Height, "current height:", height)
 	sideChains := ArbitratorGroupSingleton.GetCurrentArbitrator().GetSideChainManager().GetAllChains()
 	// Add UTXO to wallet address from transaction outputs
@@ -411,14 +413,16 @@ func (mc *MainChainImpl) processBlock(block *BlockInfo, height uint32) {
 			inputs = append(inputs, txInput)
 		}
 	}
-	DbCache.UTXOStore.AddAddressUTXOs(utxos)
-	DbCache.UTXOStore.DeleteUTXOs(inputs)
+	if err := DbCache.UTXOStore.ApplyBlock(height, block.Hash, utxos, inputs); err != nil {
+		return err
+	}
 
 	for _, sc := range sideChains {
 		sc.ClearLastUsedOutPoints()
 		sc.SetLastUsedUtxoHeight(height)
 		log.Info("Side chain [", sc.GetKey(), "] SetLastUsedUtxoHeight ", height)
 	}
+	return nil
 }
 
 func (mc *MainChainImpl) CheckAndRemoveDepositTransactionsFromDB() error {
@@ -433,6 +437,7 @@ func (mc *MainChainImpl) CheckAndRemoveDepositTransactionsFromDB() error {
 	}
 
 	allSideChainTxHashes := make(map[SideChain][]string, 0)
+	allSideChainTxHeights := make(map[SideChain][]uint32, 0)
 	for _, tx := range txs {
 		sc, ok := ArbitratorGroupSingleton.GetCurrentArbitrator().GetSideChainManager().GetChain(tx.GenesisBlockAddress)
 		if !ok {
@@ -449,8 +454,10 @@ func (mc *MainChainImpl) CheckAndRemoveDepositTransactionsFromDB() error {
 		}
 		if hasSideChainInMap {
 			allSideChainTxHashes[sc] = append(allSideChainTxHashes[sc], tx.TransactionHash)
+			allSideChainTxHeights[sc] = append(allSideChainTxHeights[sc], tx.Proof.Height)
 		} else {
 			allSideChainTxHashes[sc] = []string{tx.TransactionHash}
+			allSideChainTxHeights[sc] = []uint32{tx.Proof.Height}
 		}
 	}
 
@@ -464,14 +471,11 @@ func (mc *MainChainImpl) CheckAndRemoveDepositTransactionsFromDB() error {
 		for i := 0; i < len(receivedTxs); i++ {
 			finalGenesisAddresses = append(finalGenesisAddresses, k.GetKey())
 		}
-		err = DbCache.MainChainStore.RemoveMainChainTxs(receivedTxs, finalGenesisAddresses)
+		finalBlockHeights := GetTransactionBlockHeights(v, allSideChainTxHeights[k], receivedTxs)
+		err = TxsFinisherSingleton.FinishDepositTxs(true, receivedTxs, finalGenesisAddresses, finalBlockHeights, nil)
 		if err != nil {
 			return err
 		}
-		err = FinishedTxsDbCache.AddSucceedDepositTxs(receivedTxs, finalGenesisAddresses)
-		if err != nil {
-			log.Error("[CheckAndRemoveDepositTransactionsFromDB] Add succeed deposit transactions into finished db failed")
-		}
 	}
 
 	return nil
@@ -484,6 +488,10 @@ func InitMainChain(arbitrator Arbitrator) error {
 	}
 
 	mainChainServer := &MainChainImpl{&DistributedNodeServer{P2pCommand: WithdrawCommand}}
+	if err := mainChainServer.LoadProposals(); err != nil {
+		return err
+	}
+	go mainChainServer.MonitorProposals()
 	P2PClientSingleton.AddListener(mainChainServer)
 	currentArbitrator.SetMainChain(mainChainServer)
 
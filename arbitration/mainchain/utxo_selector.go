@@ -0,0 +1,204 @@
+package mainchain
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	. "github.com/elastos/Elastos.ELA.Arbiter/store"
+
+	. "github.com/elastos/Elastos.ELA/common"
+	. "github.com/elastos/Elastos.ELA/core/types"
+)
+
+const (
+	SmallestFirstSelector   = "smallestfirst"
+	LargestFirstSelector    = "largestfirst"
+	BranchAndBoundSelector  = "branchandbound"
+	ConsolidateDustSelector = "consolidatedust"
+
+	// maxBranchAndBoundTries limits the nodes visited while searching for an
+	// exact match, the search falls back to largest first when reached
+	maxBranchAndBoundTries = 100000
+
+	// maxConsolidateInputs is the max number of inputs of a withdraw
+	// transaction when consolidating dust
+	maxConsolidateInputs = 100
+)
+
+var ErrInsufficientUTXO = errors.New("Available token is not enough")
+
+// UTXOSelector chooses the utxos of the withdraw bank to spend for a given
+// amount, the returned utxos must be a subset of the given utxos.
+type UTXOSelector interface {
+	Select(utxos []*AddressUTXO, amount Fixed64) ([]*AddressUTXO, error)
+}
+
+// NewUTXOSelector returns the selector with the given name.
+func NewUTXOSelector(name string) (UTXOSelector, error) {
+	switch name {
+	case SmallestFirstSelector:
+		return &SmallestFirst{}, nil
+	case LargestFirstSelector:
+		return &LargestFirst{}, nil
+	case BranchAndBoundSelector:
+		return &BranchAndBound{}, nil
+	case ConsolidateDustSelector:
+		return &ConsolidateDust{}, nil
+	default:
+		return nil, errors.New("Unknown utxo selector: " + name)
+	}
+}
+
+// getUTXOSelector returns the selector configured for the side chain with the
+// given genesis block address.
+func getUTXOSelector(genesisBlockAddress string) (UTXOSelector, error) {
+	name := config.DefaultUTXOSelector
+	for _, node := range config.Parameters.SideNodeList {
+		if node.GenesisBlockAddress == genesisBlockAddress && node.UTXOSelector != "" {
+			name = node.UTXOSelector
+			break
+		}
+	}
+	return NewUTXOSelector(name)
+}
+
+// SelectWithdrawUTXOs selects the utxos to spend for the amount, the utxos in
+// used outpoints are never spent, they may be spent by other proposals. If the
+// others are not enough, ErrInsufficientUTXO is returned and the withdraw
+// transactions wait for the next round.
+func SelectWithdrawUTXOs(selector UTXOSelector, utxos []*AddressUTXO,
+	usedOutPoints []OutPoint, amount Fixed64) ([]*AddressUTXO, error) {
+
+	var availableUtxos []*AddressUTXO
+	for _, utxo := range utxos {
+		isUsed := false
+		for _, op := range usedOutPoints {
+			if op.IsEqual(utxo.Input.Previous) {
+				isUsed = true
+				break
+			}
+		}
+		if !isUsed {
+			availableUtxos = append(availableUtxos, utxo)
+		}
+	}
+
+	return selector.Select(availableUtxos, amount)
+}
+
+// SmallestFirst spends the smallest utxos first, which keeps the big utxos
+// and reduces the number of utxos of the withdraw bank.
+type SmallestFirst struct{}
+
+func (s *SmallestFirst) Select(utxos []*AddressUTXO, amount Fixed64) ([]*AddressUTXO, error) {
+	return accumulateUTXOs(sortUTXOs(utxos, true), amount)
+}
+
+// LargestFirst spends the largest utxos first, which uses the fewest inputs.
+type LargestFirst struct{}
+
+func (s *LargestFirst) Select(utxos []*AddressUTXO, amount Fixed64) ([]*AddressUTXO, error) {
+	return accumulateUTXOs(sortUTXOs(utxos, false), amount)
+}
+
+// BranchAndBound searches for utxos exactly matching the amount, so no change
+// output is created, and falls back to largest first if there is no match.
+type BranchAndBound struct{}
+
+func (s *BranchAndBound) Select(utxos []*AddressUTXO, amount Fixed64) ([]*AddressUTXO, error) {
+	sorted := sortUTXOs(utxos, false)
+	if sumUTXOs(sorted) < amount {
+		return nil, ErrInsufficientUTXO
+	}
+
+	// remains[i] is the sum of the utxos from index i
+	remains := make([]Fixed64, len(sorted)+1)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		remains[i] = remains[i+1] + *sorted[i].Amount
+	}
+
+	tries := 0
+	var selected []*AddressUTXO
+	var search func(index int, target Fixed64) bool
+	search = func(index int, target Fixed64) bool {
+		if target == 0 {
+			return true
+		}
+		tries++
+		if index >= len(sorted) || remains[index] < target || tries > maxBranchAndBoundTries {
+			return false
+		}
+		if *sorted[index].Amount <= target {
+			selected = append(selected, sorted[index])
+			if search(index+1, target-*sorted[index].Amount) {
+				return true
+			}
+			selected = selected[:len(selected)-1]
+		}
+		return search(index+1, target)
+	}
+	if amount > 0 && search(0, amount) {
+		return selected, nil
+	}
+
+	return accumulateUTXOs(sorted, amount)
+}
+
+// ConsolidateDust spends the largest utxos for the amount, then adds the utxos
+// below ConsolidateDustThreshold of config as extra inputs to merge them into
+// the change.
+type ConsolidateDust struct{}
+
+func (s *ConsolidateDust) Select(utxos []*AddressUTXO, amount Fixed64) ([]*AddressUTXO, error) {
+	sorted := sortUTXOs(utxos, false)
+	selected, err := accumulateUTXOs(sorted, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	spent := len(selected)
+	for i := len(sorted) - 1; i >= spent && len(selected) < maxConsolidateInputs; i-- {
+		if *sorted[i].Amount >= Fixed64(config.Parameters.ConsolidateDustThreshold) {
+			break
+		}
+		selected = append(selected, sorted[i])
+	}
+	return selected, nil
+}
+
+func accumulateUTXOs(utxos []*AddressUTXO, amount Fixed64) ([]*AddressUTXO, error) {
+	var selected []*AddressUTXO
+	var total Fixed64
+	for _, utxo := range utxos {
+		if total >= amount && len(selected) > 0 {
+			break
+		}
+		selected = append(selected, utxo)
+		total += *utxo.Amount
+	}
+	if total < amount {
+		return nil, ErrInsufficientUTXO
+	}
+	return selected, nil
+}
+
+func sortUTXOs(utxos []*AddressUTXO, ascending bool) []*AddressUTXO {
+	sorted := make([]*AddressUTXO, len(utxos))
+	copy(sorted, utxos)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if ascending {
+			return *sorted[i].Amount < *sorted[j].Amount
+		}
+		return *sorted[i].Amount > *sorted[j].Amount
+	})
+	return sorted
+}
+
+func sumUTXOs(utxos []*AddressUTXO) Fixed64 {
+	var total Fixed64
+	for _, utxo := range utxos {
+		total += *utxo.Amount
+	}
+	return total
+}
@@ -0,0 +1,147 @@
+package mainchain
+
+import (
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/store"
+
+	"github.com/elastos/Elastos.ELA/common"
+	"github.com/elastos/Elastos.ELA/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestUTXOs(amounts ...int64) []*store.AddressUTXO {
+	var utxos []*store.AddressUTXO
+	for i, value := range amounts {
+		amount := common.Fixed64(value)
+		utxos = append(utxos, &store.AddressUTXO{
+			Input: &types.Input{
+				Previous: types.OutPoint{
+					TxID:  common.Uint256{byte(i + 1)},
+					Index: uint16(i),
+				},
+			},
+			Amount:              &amount,
+			GenesisBlockAddress: "XKUh4GLhFJiqAMTF6HyWQrV9pK9HcGUdfJ",
+		})
+	}
+	return utxos
+}
+
+func assertNoDoubleUse(t *testing.T, selected []*store.AddressUTXO, usedOutPoints []types.OutPoint) {
+	for i, utxo := range selected {
+		for _, op := range usedOutPoints {
+			assert.False(t, op.IsEqual(utxo.Input.Previous), "selected an used outpoint")
+		}
+		for _, other := range selected[i+1:] {
+			assert.False(t, other.Input.Previous.IsEqual(utxo.Input.Previous), "selected an outpoint twice")
+		}
+	}
+}
+
+func TestUTXOSelectors_NoDoubleUse(t *testing.T) {
+	utxos := newTestUTXOs(50000, 100000000, 300, 2000000, 700, 100000000, 4000000, 90000)
+	usedOutPoints := []types.OutPoint{
+		utxos[1].Input.Previous,
+		utxos[3].Input.Previous,
+		utxos[6].Input.Previous,
+	}
+	amounts := []common.Fixed64{1, 700, 50700, 90000, 140000, 100000000, 100141000}
+
+	for _, name := range []string{SmallestFirstSelector, LargestFirstSelector,
+		BranchAndBoundSelector, ConsolidateDustSelector} {
+		selector, err := NewUTXOSelector(name)
+		assert.NoError(t, err)
+
+		for _, amount := range amounts {
+			selected, err := SelectWithdrawUTXOs(selector, utxos, usedOutPoints, amount)
+			assert.NoError(t, err, name)
+			assert.True(t, sumUTXOs(selected) >= amount, name)
+			assertNoDoubleUse(t, selected, usedOutPoints)
+		}
+	}
+}
+
+func TestUTXOSelectors_Insufficient(t *testing.T) {
+	utxos := newTestUTXOs(100, 200, 300)
+
+	for _, name := range []string{SmallestFirstSelector, LargestFirstSelector,
+		BranchAndBoundSelector, ConsolidateDustSelector} {
+		selector, err := NewUTXOSelector(name)
+		assert.NoError(t, err)
+
+		_, err = SelectWithdrawUTXOs(selector, utxos, nil, 601)
+		assert.Equal(t, ErrInsufficientUTXO, err, name)
+	}
+
+	_, err := NewUTXOSelector("unknown")
+	assert.Error(t, err)
+}
+
+func TestSelectWithdrawUTXOs_NeverUseUsed(t *testing.T) {
+	utxos := newTestUTXOs(100, 200, 300, 400)
+	usedOutPoints := []types.OutPoint{
+		utxos[1].Input.Previous,
+		utxos[2].Input.Previous,
+		utxos[3].Input.Previous,
+	}
+
+	for _, name := range []string{SmallestFirstSelector, LargestFirstSelector,
+		BranchAndBoundSelector, ConsolidateDustSelector} {
+		selector, err := NewUTXOSelector(name)
+		assert.NoError(t, err)
+
+		selected, err := SelectWithdrawUTXOs(selector, utxos, usedOutPoints, 100)
+		assert.NoError(t, err, name)
+		assertNoDoubleUse(t, selected, usedOutPoints)
+
+		// Used utxos are not spent even if the others are not enough
+		selected, err = SelectWithdrawUTXOs(selector, utxos, usedOutPoints, 450)
+		assert.Equal(t, ErrInsufficientUTXO, err, name)
+		assert.Nil(t, selected, name)
+	}
+}
+
+func TestUTXOSelectors_Order(t *testing.T) {
+	utxos := newTestUTXOs(500, 100, 300, 200)
+
+	selected, err := (&SmallestFirst{}).Select(utxos, 250)
+	assert.NoError(t, err)
+	assert.Equal(t, []common.Fixed64{100, 200}, utxoAmounts(selected))
+
+	selected, err = (&LargestFirst{}).Select(utxos, 600)
+	assert.NoError(t, err)
+	assert.Equal(t, []common.Fixed64{500, 300}, utxoAmounts(selected))
+
+	selected, err = (&BranchAndBound{}).Select(utxos, 600)
+	assert.NoError(t, err)
+	assert.Equal(t, common.Fixed64(600), sumUTXOs(selected))
+
+	// No exact match, fall back to largest first
+	selected, err = (&BranchAndBound{}).Select(utxos, 1050)
+	assert.NoError(t, err)
+	assert.Equal(t, []common.Fixed64{500, 300, 200, 100}, utxoAmounts(selected))
+}
+
+func TestConsolidateDust_Select(t *testing.T) {
+	defer func(threshold int64) {
+		config.Parameters.ConsolidateDustThreshold = threshold
+	}(config.Parameters.ConsolidateDustThreshold)
+	config.Parameters.ConsolidateDustThreshold = 100000
+	dustThreshold := config.Parameters.ConsolidateDustThreshold
+	utxos := newTestUTXOs(dustThreshold*10, 10, dustThreshold, 20, dustThreshold*20)
+
+	selected, err := (&ConsolidateDust{}).Select(utxos, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, []common.Fixed64{common.Fixed64(dustThreshold * 20), 10, 20}, utxoAmounts(selected))
+	assertNoDoubleUse(t, selected, nil)
+}
+
+func utxoAmounts(utxos []*store.AddressUTXO) []common.Fixed64 {
+	var amounts []common.Fixed64
+	for _, utxo := range utxos {
+		amounts = append(amounts, *utxo.Amount)
+	}
+	return amounts
+}
@@ -64,7 +64,6 @@ func (sc *SideChainImpl) ReceiveSendLastArbiterUsedUtxos(height uint32, genesisA
 	scKey := sc.GetKey()
 	scHeight := sc.ToSendTransactionsHeight
 	ready := sc.Ready
-	txs := sc.ToSendTransactionHashes
 	sc.mux.Unlock()
 	log.Info("[ReceiveSendLastArbiterUsedUtxos] Received mssage, scKey", scKey, "genesisAddress:", genesisAddress)
 	log.Info("[ReceiveSendLastArbiterUsedUtxos] Received mssage, received height:", height, "my height:", sc.LastUsedUtxoHeight)
@@ -76,17 +75,19 @@ func (sc *SideChainImpl) ReceiveSendLastArbiterUsedUtxos(height uint32, genesisA
 		sc.AddLastUsedOutPoints(outPoints)
 		sc.SetLastUsedUtxoHeight(height)
 		if ready && msgNum >= config.Parameters.MinReceivedUsedUtxoMsgNumber {
+			// Transactions added by sendWithdrawTxs meanwhile are taken too
+			sc.mux.Lock()
+			txs := sc.ToSendTransactionHashes
+			sc.Ready = false
+			sc.ToSendTransactionHashes = make(map[uint32][]string, 0)
+			sc.ToSendTransactionsHeight = 0
+			sc.mux.Unlock()
 			for _, v := range txs {
 				err := sc.CreateAndBroadcastWithdrawProposal(v)
 				if err != nil {
 					log.Error("[ReceiveSendLastArbiterUsedUtxos] CreateAndBroadcastWithdrawProposal failed")
 				}
 			}
-			sc.mux.Lock()
-			sc.Ready = false
-			sc.ToSendTransactionHashes = make(map[uint32][]string, 0)
-			sc.ToSendTransactionsHeight = 0
-			sc.mux.Unlock()
 			log.Info("[ReceiveSendLastArbiterUsedUtxos] Send transactions for multi sign")
 		}
 	}
@@ -111,9 +112,9 @@ func (sc *SideChainImpl) ReceiveGetLastArbiterUsedUtxos(height uint32, genesisAd
 				OutPoints:      sc.LastUsedOutPoints,
 				Nonce:          strconv.FormatInt(nonce, 10),
 			}
-			msgHash := cs.P2PClientSingleton.GetMessageHash(msg)
-			cs.P2PClientSingleton.AddMessageHash(msgHash)
-			cs.P2PClientSingleton.Broadcast(msg)
+			if err := cs.P2PClientSingleton.SignAndBroadcast(msg); err != nil {
+				return err
+			}
 
 			utxos, err := store.DbCache.UTXOStore.GetAddressUTXOsFromGenesisBlockAddress(genesisAddress)
 			if err != nil {
@@ -239,7 +240,7 @@ func (sc *SideChainImpl) GetBlockByHeight(height uint32) (*BlockInfo, error) {
 
 func (sc *SideChainImpl) SendTransaction(txHash *common.Uint256) (rpc.Response, error) {
 	log.Info("[Rpc-sendtransactioninfo] Deposit transaction to side chain：", sc.CurrentConfig.Rpc.IpAddress, ":", sc.CurrentConfig.Rpc.HttpJsonPort)
-	response, err := rpc.CallAndUnmarshalResponse("sendrechargetransaction", rpc.Param("txid", txHash.String()), sc.CurrentConfig.Rpc)
+	response, err := rpc.GetClient(sc.CurrentConfig.Rpc).SendResponse("sendrechargetransaction", rpc.Param("txid", txHash.String()))
 	if err != nil {
 		return rpc.Response{}, err
 	}
@@ -349,6 +350,44 @@ func (sc *SideChainImpl) SendCachedWithdrawTxs() {
 		return
 	}
 
+	sc.sendWithdrawTxs(txHashes, blockHeights)
+}
+
+// SendWithdrawTxs proposes the cached withdraw transactions of txHashes again,
+// other cached withdraw transactions are left to their own proposals.
+func (sc *SideChainImpl) SendWithdrawTxs(txHashes []string) {
+	cachedHashes, cachedHeights, err := store.DbCache.SideChainStore.GetAllSideChainTxHashesAndHeights(sc.GetKey())
+	if err != nil {
+		log.Errorf("[SendWithdrawTxs] %s", err.Error())
+		return
+	}
+
+	wanted := make(map[string]bool, len(txHashes))
+	for _, txHash := range txHashes {
+		wanted[txHash] = true
+	}
+	var hashes []string
+	var heights []uint32
+	for i, txHash := range cachedHashes {
+		if wanted[txHash] {
+			hashes = append(hashes, txHash)
+			heights = append(heights, cachedHeights[i])
+		}
+	}
+
+	if len(hashes) == 0 {
+		log.Info("No cached withdraw transaction need to send")
+		return
+	}
+
+	sc.sendWithdrawTxs(hashes, heights)
+}
+
+// sendWithdrawTxs asks the other arbiters for their last used utxos, the
+// withdraw transactions not packed by the main chain yet are proposed once
+// enough arbiters answered. The transactions are added to the ones waiting
+// for the answers if a request is already sent.
+func (sc *SideChainImpl) sendWithdrawTxs(txHashes []string, blockHeights []uint32) {
 	receivedTxs, err := rpc.GetExistWithdrawTransactions(txHashes)
 	if err != nil {
 		log.Errorf("[SendCachedWithdrawTxs] %s", err.Error())
@@ -366,38 +405,57 @@ func (sc *SideChainImpl) SendCachedWithdrawTxs() {
 	if len(unsolvedTxs) != 0 {
 		heightTxsMap := GetHeightTransactionHashesMap(unsolvedTxs, unsolvedBlockHeights)
 
-		sc.ToSendTransactionHashes = heightTxsMap
-		sc.ToSendTransactionsHeight = chainHeight - 1
-		sc.Ready = true
-		sc.ReceivedUsedUtxoMsgNumber = 0
-
-		var number = make([]byte, 8)
-		var nonce int64
-		rand.Read(number)
-		binary.Read(bytes.NewReader(number), binary.LittleEndian, &nonce)
-
-		msg := &cs.GetLastArbiterUsedUTXOMessage{
-			Command:        cs.GetLastArbiterUsedUtxoCommand,
-			GenesisAddress: sc.GetKey(),
-			Height:         chainHeight - 1,
-			Nonce:          strconv.FormatInt(nonce, 10)}
-		msgHash := cs.P2PClientSingleton.GetMessageHash(msg)
-		cs.P2PClientSingleton.AddMessageHash(msgHash)
-		cs.P2PClientSingleton.Broadcast(msg)
-		log.Info("[SendCachedWithdrawTxs] Find withdraw transaction, send GetLastArbiterUsedUtxoCommand mssage")
+		sc.mux.Lock()
+		if sc.Ready {
+			mergeHeightTransactionHashes(sc.ToSendTransactionHashes, heightTxsMap)
+			sc.mux.Unlock()
+			log.Info("[SendCachedWithdrawTxs] Add withdraw transactions to the ones waiting for used utxos")
+		} else {
+			sc.ToSendTransactionHashes = heightTxsMap
+			sc.ToSendTransactionsHeight = chainHeight - 1
+			sc.Ready = true
+			sc.ReceivedUsedUtxoMsgNumber = 0
+			sc.mux.Unlock()
+
+			var number = make([]byte, 8)
+			var nonce int64
+			rand.Read(number)
+			binary.Read(bytes.NewReader(number), binary.LittleEndian, &nonce)
+
+			msg := &cs.GetLastArbiterUsedUTXOMessage{
+				Command:        cs.GetLastArbiterUsedUtxoCommand,
+				GenesisAddress: sc.GetKey(),
+				Height:         chainHeight - 1,
+				Nonce:          strconv.FormatInt(nonce, 10)}
+			if err := cs.P2PClientSingleton.SignAndBroadcast(msg); err != nil {
+				log.Errorf("[SendCachedWithdrawTxs] %s", err.Error())
+				return
+			}
+			log.Info("[SendCachedWithdrawTxs] Find withdraw transaction, send GetLastArbiterUsedUtxoCommand mssage")
+		}
 	}
 
 	if len(receivedTxs) != 0 {
-		err = store.DbCache.SideChainStore.RemoveSideChainTxs(receivedTxs)
+		err = store.TxsFinisherSingleton.FinishWithdrawTxs(true, receivedTxs, "", nil, "")
 		if err != nil {
 			log.Errorf("[SendCachedWithdrawTxs] %s", err.Error())
 			return
 		}
+	}
+}
 
-		err = store.FinishedTxsDbCache.AddSucceedWithdrawTxs(receivedTxs)
-		if err != nil {
-			log.Errorf("[SendCachedWithdrawTxs] %s", err.Error())
-			return
+// mergeHeightTransactionHashes adds the transaction hashes of src to dst,
+// skipping the ones already in dst.
+func mergeHeightTransactionHashes(dst, src map[uint32][]string) {
+	for height, hashes := range src {
+		existed := make(map[string]bool, len(dst[height]))
+		for _, hash := range dst[height] {
+			existed[hash] = true
+		}
+		for _, hash := range hashes {
+			if !existed[hash] {
+				dst[height] = append(dst[height], hash)
+			}
 		}
 	}
 }
@@ -412,14 +470,9 @@ func (sc *SideChainImpl) CreateAndBroadcastWithdrawProposal(txnHashes []string)
 		return nil
 	}
 
-	withdrawInfo, err := sc.ParseUserWithdrawTransactionInfo(unsolvedTransactions)
-	if err != nil {
-		return err
-	}
-
 	currentArbitrator := arbitrator.ArbitratorGroupSingleton.GetCurrentArbitrator()
 	currentArbitrator.GetMainChain().SyncChainData()
-	transactions := currentArbitrator.CreateWithdrawTransactions(withdrawInfo, sc, txnHashes, &arbitrator.DbMainChainFunc{})
+	transactions := currentArbitrator.CreateWithdrawTransactions(unsolvedTransactions, sc, &arbitrator.DbMainChainFunc{})
 
 	log.Info("[CreateAndBroadcastWithdrawProposal] Transactions count: ", len(transactions))
 	currentArbitrator.BroadcastWithdrawProposal(transactions)
@@ -113,6 +113,7 @@ func TestCheckWithdrawTransaction(t *testing.T) {
 	var spvTxs []*SpvTransaction
 	var finalTxHashes []string
 	var genesisAddresses []string
+	var blockHeights []uint32
 	for i := 0; i < len(result); i++ {
 		if result[i] {
 			depositInfo, err := ParseUserDepositTransactionInfo(txs[i].Transaction, genesisAddress)
@@ -123,6 +124,7 @@ func TestCheckWithdrawTransaction(t *testing.T) {
 			spvTxs = append(spvTxs, &SpvTransaction{txs[i].Transaction, txs[i].Proof, depositInfo})
 			finalTxHashes = append(finalTxHashes, txs[i].TransactionHash)
 			genesisAddresses = append(genesisAddresses, txs[i].GenesisBlockAddress)
+			blockHeights = append(blockHeights, txs[i].Proof.Height)
 		}
 	}
 
@@ -131,7 +133,7 @@ func TestCheckWithdrawTransaction(t *testing.T) {
 		t.Error("Create deposit transactions failed")
 	}
 
-	err = fhDataStore.AddSucceedDepositTxs(finalTxHashes, genesisAddresses)
+	err = fhDataStore.AddSucceedDepositTxs(finalTxHashes, genesisAddresses, blockHeights)
 	if err != nil {
 		t.Error("Add succeed deposit tx failed")
 	}
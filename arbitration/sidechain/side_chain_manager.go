@@ -48,12 +48,7 @@ func (sideManager *SideChainManagerImpl) CheckAndRemoveWithdrawTransactionsFromD
 	}
 
 	if len(receivedTxs) != 0 {
-		err = store.DbCache.SideChainStore.RemoveSideChainTxs(receivedTxs)
-		if err != nil {
-			return err
-		}
-
-		err = store.FinishedTxsDbCache.AddSucceedWithdrawTxs(receivedTxs)
+		err = store.TxsFinisherSingleton.FinishWithdrawTxs(true, receivedTxs, "", nil, "")
 		if err != nil {
 			return err
 		}
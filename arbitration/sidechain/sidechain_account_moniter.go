@@ -63,16 +63,46 @@ func (monitor *SideChainAccountMonitorImpl) SyncChainData(sideNode *config.SideN
 
 		if needSync {
 			log.Info("currentHeight:", currentHeight, " chainHeight:", chainHeight)
+			confirmations := sideNode.ConfirmationDepth
 			for currentHeight < chainHeight {
-				if currentHeight >= 6 {
-					transactions, err := GetWithdrawTransactionByHeight(currentHeight+1-6, sideNode.Rpc)
+				if currentHeight >= confirmations {
+					height := currentHeight + 1 - confirmations
+					block, err := GetBlockByHeight(height, sideNode.Rpc)
 					if err != nil {
-						log.Error("Get destoryed transaction at height:", currentHeight+1-6, "failed\n"+
+						log.Error("Get side chain block at height:", height, "failed\n"+
 							"rpc:", sideNode.Rpc.IpAddress, ":", sideNode.Rpc.HttpJsonPort, "\n"+
 							"error:", err)
 						break
 					}
-					monitor.processTransactions(transactions, sideNode.GenesisBlockAddress, currentHeight+1-6)
+
+					if height > 0 {
+						prevHash, err := store.DbCache.SideChainStore.GetSideChainBlockHash(sideNode.GenesisBlockAddress, height-1)
+						if err == nil && prevHash != block.PreviousBlockHash {
+							log.Warn("[SyncSideChain] Side chain [", sideNode.GenesisBlockAddress, "] reorganized at height:", height,
+								"recorded previous block:", prevHash, "actual previous block:", block.PreviousBlockHash)
+							currentHeight, err = monitor.rollback(sideNode, height-1)
+							if err != nil {
+								log.Error("[SyncSideChain] Rollback side chain [", sideNode.GenesisBlockAddress, "] failed, error:", err)
+								break
+							}
+							continue
+						}
+					}
+
+					transactions, err := GetWithdrawTransactionByHeight(height, sideNode.Rpc)
+					if err != nil {
+						log.Error("Get destoryed transaction at height:", height, "failed\n"+
+							"rpc:", sideNode.Rpc.IpAddress, ":", sideNode.Rpc.HttpJsonPort, "\n"+
+							"error:", err)
+						break
+					}
+					monitor.processTransactions(transactions, sideNode.GenesisBlockAddress, height)
+
+					err = store.DbCache.SideChainStore.AddSideChainBlock(sideNode.GenesisBlockAddress, height, block.Hash)
+					if err != nil {
+						log.Error("[SyncSideChain] Record side chain block at height:", height, "failed, error:", err)
+						break
+					}
 				}
 				currentHeight++
 			}
@@ -94,6 +124,46 @@ func (monitor *SideChainAccountMonitorImpl) SyncChainData(sideNode *config.SideN
 	}
 }
 
+// findForkHeight walks back from height and returns the highest recorded
+// block which is still on the best chain of the side node.
+func (monitor *SideChainAccountMonitorImpl) findForkHeight(sideNode *config.SideNodeConfig, height uint32) (uint32, error) {
+	for ; height > 0; height-- {
+		recordedHash, err := store.DbCache.SideChainStore.GetSideChainBlockHash(sideNode.GenesisBlockAddress, height)
+		if err != nil {
+			// Blocks older than the recorded ones are considered final
+			return height, nil
+		}
+		block, err := GetBlockByHeight(height, sideNode.Rpc)
+		if err != nil {
+			return 0, err
+		}
+		if block.Hash == recordedHash {
+			return height, nil
+		}
+	}
+	return 0, nil
+}
+
+// rollback purges the withdraw transactions found in orphaned side chain
+// blocks, which will be found again while re-scanning the best chain from
+// the fork point. It returns the side height to continue syncing from.
+func (monitor *SideChainAccountMonitorImpl) rollback(sideNode *config.SideNodeConfig, height uint32) (uint32, error) {
+	forkHeight, err := monitor.findForkHeight(sideNode, height)
+	if err != nil {
+		return 0, err
+	}
+
+	currentHeight := forkHeight + sideNode.ConfirmationDepth
+	removedTxs, err := store.DbCache.SideChainStore.RollbackSideChain(sideNode.GenesisBlockAddress, forkHeight, currentHeight)
+	if err != nil {
+		return 0, err
+	}
+
+	log.Warn("[SyncSideChain] Side chain [", sideNode.GenesisBlockAddress, "] rolled back to fork height:", forkHeight,
+		"removed withdraw transactions:", removedTxs)
+	return currentHeight, nil
+}
+
 func (monitor *SideChainAccountMonitorImpl) needSyncBlocks(genesisBlockAddress string, config *config.RpcConfig) (uint32, uint32, bool) {
 
 	chainHeight, err := GetCurrentHeight(config)
@@ -0,0 +1,566 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+	"github.com/elastos/Elastos.ELA.Arbiter/store"
+	"github.com/elastos/Elastos.ELA.Arbiter/wallet"
+)
+
+const (
+	// Version is the version of the backup archive format
+	Version = 1
+
+	manifestName = "manifest.json"
+	databasesDir = "databases"
+	spvDir       = "spv"
+	keystoresDir = "keystores"
+
+	maxManifestSize = 16 * 1024 * 1024
+)
+
+// Manifest is the first entry of a backup archive, which lists the other
+// entries with their checksums.
+type Manifest struct {
+	Version        uint32
+	ArbiterVersion string
+	StoreBackend   string
+	CreatedTime    string
+	Files          []*File
+}
+
+// File is a file of the backup archive. Files under databases and spv are
+// restored to the same place under the data directory, and keystores are
+// restored to Path.
+type File struct {
+	Name   string
+	Path   string `json:",omitempty"`
+	Size   int64
+	SHA256 string
+}
+
+var mux sync.Mutex
+
+// PauseSPV stops the SPV service of the running arbiter and returns the
+// function resuming it, so the SPV data is copied while nobody writes it. It
+// is nil if the arbiter is not running.
+var PauseSPV func() (resume func() error, err error)
+
+// DefaultPath returns the path of a new backup archive under BackupPath.
+func DefaultPath() string {
+	backupPath := config.Parameters.BackupPath
+	if backupPath == "" {
+		backupPath = filepath.Join(config.DataPath, "backups")
+	}
+	return filepath.Join(backupPath, "arbiter_backup_"+time.Now().Format("20060102150405")+".tar.gz")
+}
+
+func storeBackend() string {
+	if config.Parameters.StoreBackend == "" {
+		return store.SQLiteBackend
+	}
+	return config.Parameters.StoreBackend
+}
+
+func spvPath() string {
+	return filepath.Join(config.DataPath, config.DataDir, config.SpvDir)
+}
+
+// keystoreFiles returns the keystore files of the main account and the side
+// chains configured.
+func keystoreFiles() []string {
+	files := []string{wallet.DefaultKeystoreFile}
+	added := map[string]bool{wallet.DefaultKeystoreFile: true}
+	for _, side := range config.Parameters.SideNodeList {
+		if side.KeystoreFile != "" && !added[side.KeystoreFile] {
+			added[side.KeystoreFile] = true
+			files = append(files, side.KeystoreFile)
+		}
+	}
+	return files
+}
+
+// Create writes a backup archive of the databases, the SPV data and the
+// keystore files to path. The databases are copied from a consistent snapshot,
+// the SPV data is copied while the SPV service is paused. Out of the arbiter it
+// locks the data directory and fails if the arbiter is running, the running
+// arbiter is backed up by the createbackup JSON-RPC instead.
+func Create(archivePath string) (*Manifest, error) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	if PauseSPV == nil {
+		unlock, err := store.LockDataDir()
+		if err != nil {
+			return nil, fmt.Errorf("%s, use the createbackup JSON-RPC to back up the running arbiter", err)
+		}
+		defer unlock()
+	}
+
+	if exist, err := store.PathExists(archivePath); err != nil {
+		return nil, err
+	} else if exist {
+		return nil, errors.New("backup file " + archivePath + " already exists")
+	}
+	if err := os.MkdirAll(config.DataPath, os.ModePerm); err != nil {
+		return nil, err
+	}
+	staging, err := ioutil.TempDir(config.DataPath, "backup_")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	if err := store.Snapshot(filepath.Join(staging, databasesDir)); err != nil {
+		return nil, fmt.Errorf("snapshot databases failed: %s", err)
+	}
+	if exist, err := store.PathExists(spvPath()); err != nil {
+		return nil, err
+	} else if exist {
+		if err := copySPVData(filepath.Join(staging, spvDir)); err != nil {
+			return nil, fmt.Errorf("copy spv data failed: %s", err)
+		}
+	}
+	keystorePaths := make(map[string]string)
+	for i, keystore := range keystoreFiles() {
+		if exist, err := store.PathExists(keystore); err != nil {
+			return nil, err
+		} else if !exist {
+			continue
+		}
+		name := path.Join(keystoresDir, strconv.Itoa(i), filepath.Base(keystore))
+		if err := copyFile(keystore, filepath.Join(staging, filepath.FromSlash(name))); err != nil {
+			return nil, fmt.Errorf("copy keystore %s failed: %s", keystore, err)
+		}
+		keystorePaths[name] = keystore
+	}
+
+	manifest := &Manifest{
+		Version:        Version,
+		ArbiterVersion: config.Version,
+		StoreBackend:   storeBackend(),
+		CreatedTime:    time.Now().Format("2006-01-02 15:04:05"),
+	}
+	err = filepath.Walk(staging, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(staging, filePath)
+		if err != nil {
+			return err
+		}
+		size, checksum, err := fileChecksum(filePath)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		manifest.Files = append(manifest.Files, &File{Name: name, Path: keystorePaths[name], Size: size,
+			SHA256: checksum})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(archivePath), os.ModePerm); err != nil {
+		return nil, err
+	}
+	tempPath := archivePath + ".tmp"
+	if err := writeArchive(tempPath, staging, manifest); err != nil {
+		os.Remove(tempPath)
+		return nil, err
+	}
+	if err := os.Rename(tempPath, archivePath); err != nil {
+		os.Remove(tempPath)
+		return nil, err
+	}
+
+	log.Info("[Backup] Backup", len(manifest.Files), "files to", archivePath)
+	return manifest, nil
+}
+
+// copySPVData copies the SPV data to dst, pausing the SPV service if the
+// arbiter is running, otherwise the data directory is locked by Create.
+func copySPVData(dst string) (err error) {
+	if PauseSPV != nil {
+		resume, pauseErr := PauseSPV()
+		if pauseErr != nil {
+			return pauseErr
+		}
+		defer func() {
+			if resumeErr := resume(); resumeErr != nil {
+				log.Error("[Backup] Resume spv service failed:", resumeErr)
+				if err == nil {
+					err = resumeErr
+				}
+			}
+		}()
+	}
+	return copyDir(spvPath(), dst)
+}
+
+// writeArchive writes the manifest and then the files of it under staging to
+// a gzipped tar file at archivePath.
+func writeArchive(archivePath, staging string, manifest *Manifest) error {
+	file, err := os.OpenFile(archivePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+	manifestBytes, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return err
+	}
+	modTime := time.Now()
+	err = tarWriter.WriteHeader(&tar.Header{Name: manifestName, Mode: 0600, Size: int64(len(manifestBytes)),
+		ModTime: modTime, Typeflag: tar.TypeReg})
+	if err != nil {
+		return err
+	}
+	if _, err := tarWriter.Write(manifestBytes); err != nil {
+		return err
+	}
+
+	for _, f := range manifest.Files {
+		err := tarWriter.WriteHeader(&tar.Header{Name: f.Name, Mode: 0600, Size: f.Size, ModTime: modTime,
+			Typeflag: tar.TypeReg})
+		if err != nil {
+			return err
+		}
+		src, err := os.Open(filepath.Join(staging, filepath.FromSlash(f.Name)))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tarWriter, src)
+		src.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Restore validates the backup archive at archivePath and then replaces the
+// databases, the SPV data and the keystore files with the ones of it, the data
+// replaced is kept next to it. It locks the data directory and fails while the
+// arbiter is running, and moves the replaced data back if it fails halfway.
+func Restore(archivePath string) (manifest *Manifest, err error) {
+	mux.Lock()
+	defer mux.Unlock()
+
+	unlock, err := store.LockDataDir()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	manifest, staging, err := extract(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	suffix := ".before_restore_" + time.Now().Format("20060102150405")
+	var replaced []string
+	defer func() {
+		if err != nil {
+			rollback(replaced, suffix)
+		}
+	}()
+
+	dirs := map[string]string{databasesDir: store.DBDocumentNAME, spvDir: spvPath()}
+	for _, dir := range []string{databasesDir, spvDir} {
+		if !hasDir(manifest, dir) {
+			continue
+		}
+		if err := replace(filepath.Join(staging, dir), dirs[dir], suffix); err != nil {
+			return nil, err
+		}
+		replaced = append(replaced, dirs[dir])
+	}
+	for _, f := range manifest.Files {
+		if f.Path == "" {
+			continue
+		}
+		if err := replace(filepath.Join(staging, filepath.FromSlash(f.Name)), f.Path, suffix); err != nil {
+			return nil, err
+		}
+		replaced = append(replaced, f.Path)
+	}
+
+	log.Info("[Restore] Restored", len(manifest.Files), "files of backup created at", manifest.CreatedTime)
+	return manifest, nil
+}
+
+// replace moves the file or directory at dst aside with suffix if it exists,
+// and then moves src to dst. dst is moved back if src can not be moved.
+func replace(src, dst, suffix string) error {
+	exist, err := store.PathExists(dst)
+	if err != nil {
+		return err
+	}
+	if exist {
+		if err := os.Rename(dst, dst+suffix); err != nil {
+			return err
+		}
+		log.Info("[Restore] Moved", dst, "to", dst+suffix)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err != nil {
+		if exist {
+			if err := os.Rename(dst+suffix, dst); err != nil {
+				log.Error("[Restore] Move", dst+suffix, "back failed:", err)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// rollback removes the restored files or directories at paths, and moves the
+// ones replaced by them back in reverse order.
+func rollback(paths []string, suffix string) {
+	for i := len(paths) - 1; i >= 0; i-- {
+		dst := paths[i]
+		if err := os.RemoveAll(dst); err != nil {
+			log.Error("[Restore] Remove", dst, "failed:", err)
+			continue
+		}
+		if exist, err := store.PathExists(dst + suffix); err != nil || !exist {
+			continue
+		}
+		if err := os.Rename(dst+suffix, dst); err != nil {
+			log.Error("[Restore] Move", dst+suffix, "back failed:", err)
+			continue
+		}
+		log.Info("[Restore] Moved", dst+suffix, "back to", dst)
+	}
+}
+
+func hasDir(manifest *Manifest, dir string) bool {
+	for _, f := range manifest.Files {
+		if strings.HasPrefix(f.Name, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// extract validates the backup archive while extracting it to a staging
+// directory, which is removed if the archive is invalid.
+func extract(archivePath string) (*Manifest, string, error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid backup archive: %s", err)
+	}
+	tarReader := tar.NewReader(gzipReader)
+
+	header, err := tarReader.Next()
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid backup archive: %s", err)
+	}
+	if header.Name != manifestName {
+		return nil, "", errors.New("invalid backup archive: manifest not found")
+	}
+	var manifest Manifest
+	if err := json.NewDecoder(io.LimitReader(tarReader, maxManifestSize)).Decode(&manifest); err != nil {
+		return nil, "", fmt.Errorf("invalid backup manifest: %s", err)
+	}
+	if err := validateManifest(&manifest); err != nil {
+		return nil, "", err
+	}
+
+	if err := os.MkdirAll(config.DataPath, os.ModePerm); err != nil {
+		return nil, "", err
+	}
+	staging, err := ioutil.TempDir(config.DataPath, "restore_")
+	if err != nil {
+		return nil, "", err
+	}
+	if err := extractFiles(tarReader, &manifest, staging); err != nil {
+		os.RemoveAll(staging)
+		return nil, "", err
+	}
+	return &manifest, staging, nil
+}
+
+func validateManifest(manifest *Manifest) error {
+	if manifest.Version == 0 || manifest.Version > Version {
+		return fmt.Errorf("unsupported backup version %d, supported version is %d", manifest.Version, Version)
+	}
+	if manifest.StoreBackend != storeBackend() {
+		return fmt.Errorf("backup of store backend %s can not be restored to store backend %s",
+			manifest.StoreBackend, storeBackend())
+	}
+
+	keystores := make(map[string]bool)
+	for _, keystore := range keystoreFiles() {
+		keystores[keystore] = true
+	}
+	names := make(map[string]bool)
+	for _, f := range manifest.Files {
+		if names[f.Name] {
+			return errors.New("duplicated file " + f.Name + " in backup manifest")
+		}
+		names[f.Name] = true
+		if f.Name == manifestName || path.IsAbs(f.Name) || path.Clean(f.Name) != f.Name ||
+			strings.HasPrefix(f.Name, "../") {
+			return errors.New("invalid file name " + f.Name + " in backup manifest")
+		}
+		switch strings.SplitN(f.Name, "/", 2)[0] {
+		case databasesDir, spvDir:
+			if f.Path != "" {
+				return errors.New("invalid path of file " + f.Name + " in backup manifest")
+			}
+		case keystoresDir:
+			if !keystores[f.Path] {
+				return errors.New("keystore " + f.Path + " in backup manifest is not configured")
+			}
+		default:
+			return errors.New("unknown file " + f.Name + " in backup manifest")
+		}
+	}
+	return nil
+}
+
+// extractFiles writes the files of the archive to staging, the files must be
+// exactly the ones of the manifest with the same sizes and checksums.
+func extractFiles(tarReader *tar.Reader, manifest *Manifest, staging string) error {
+	files := make(map[string]*File)
+	for _, f := range manifest.Files {
+		files[f.Name] = f
+	}
+	extracted := make(map[string]bool)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("invalid backup archive: %s", err)
+		}
+		f, ok := files[header.Name]
+		if !ok || header.Typeflag != tar.TypeReg {
+			return errors.New("unexpected file " + header.Name + " in backup archive")
+		}
+		if extracted[f.Name] {
+			return errors.New("duplicated file " + f.Name + " in backup archive")
+		}
+		extracted[f.Name] = true
+
+		dst := filepath.Join(staging, filepath.FromSlash(f.Name))
+		if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+			return err
+		}
+		size, checksum, err := writeFile(dst, tarReader)
+		if err != nil {
+			return err
+		}
+		if size != f.Size || checksum != f.SHA256 {
+			return errors.New("checksum of file " + f.Name + " in backup archive mismatched")
+		}
+	}
+	if len(extracted) != len(files) {
+		return errors.New("backup archive is incomplete")
+	}
+	return nil
+}
+
+// writeFile writes r to a new file at dst and returns the size and the sha256
+// checksum of it.
+func writeFile(dst string, r io.Reader) (int64, string, error) {
+	file, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return 0, "", err
+	}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), r)
+	if err != nil {
+		file.Close()
+		return 0, "", err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), file.Close()
+}
+
+func copyFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, _, err = writeFile(dst, file)
+	return err
+}
+
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(src, filePath)
+		if err != nil {
+			return err
+		}
+		return copyFile(filePath, filepath.Join(dst, rel))
+	})
+}
+
+func fileChecksum(filePath string) (int64, string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,272 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/store"
+)
+
+func TestMain(m *testing.M) {
+	config.InitMockConfig()
+	os.Exit(m.Run())
+}
+
+// setupDataDir changes working directory to a new directory with a side chain
+// database, the SPV data and a keystore file.
+func setupDataDir(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "arbiter_backup")
+	if err != nil {
+		t.Fatal("Create data directory error.")
+	}
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal("Change working directory error.")
+	}
+
+	sideChain, err := store.OpenSideChainDataStore()
+	if err != nil {
+		t.Fatal("Open side chain database error.")
+	}
+	if err := sideChain.AddSideChainTx(&base.SideChainTransaction{"testHash", "testAddress", []byte{1}, 10}); err != nil {
+		t.Fatal("Add side chain transaction error.")
+	}
+	if err := os.MkdirAll(spvPath(), os.ModePerm); err != nil {
+		t.Fatal("Create spv directory error.")
+	}
+	if err := ioutil.WriteFile(filepath.Join(spvPath(), "headers"), []byte("headers"), 0600); err != nil {
+		t.Fatal("Write spv data error.")
+	}
+	if err := ioutil.WriteFile("keystore.dat", []byte("keystore"), 0600); err != nil {
+		t.Fatal("Write keystore error.")
+	}
+
+	return func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestCreateAndRestore(t *testing.T) {
+	defer setupDataDir(t)()
+
+	// The spv service must not write its data while being copied
+	var paused, resumed bool
+	PauseSPV = func() (func() error, error) {
+		paused = true
+		return func() error {
+			resumed = true
+			return nil
+		}, nil
+	}
+	defer func() { PauseSPV = nil }()
+
+	manifest, err := Create("backup.tar.gz")
+	if err != nil {
+		t.Fatal("Create backup error:", err)
+	}
+	if !paused || !resumed {
+		t.Error("SPV service should be paused while copying the spv data.")
+	}
+	files := make(map[string]*File)
+	for _, f := range manifest.Files {
+		files[f.Name] = f
+	}
+	if _, ok := files["databases/sideChainCache.db"]; !ok {
+		t.Error("Backup should contain the side chain database.")
+	}
+	if _, ok := files["spv/headers"]; !ok {
+		t.Error("Backup should contain the spv data.")
+	}
+	if f, ok := files["keystores/0/keystore.dat"]; !ok || f.Path != "keystore.dat" {
+		t.Error("Backup should contain the keystore.")
+	}
+
+	ioutil.WriteFile("keystore.dat", []byte("changed"), 0600)
+	ioutil.WriteFile(filepath.Join(spvPath(), "headers"), []byte("changed"), 0600)
+	if _, err := Restore("backup.tar.gz"); err != nil {
+		t.Fatal("Restore backup error:", err)
+	}
+	if data, _ := ioutil.ReadFile("keystore.dat"); string(data) != "keystore" {
+		t.Error("Keystore should be restored.")
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(spvPath(), "headers")); string(data) != "headers" {
+		t.Error("SPV data should be restored.")
+	}
+	if exist, _ := store.PathExists(store.DBNameSideChain); !exist {
+		t.Error("Side chain database should be restored.")
+	}
+	if replaced, _ := filepath.Glob("keystore.dat.before_restore_*"); len(replaced) != 1 {
+		t.Error("Replaced keystore should be kept.")
+	}
+}
+
+func TestCreate_ArbiterRunning(t *testing.T) {
+	defer setupDataDir(t)()
+
+	// The running arbiter holds the lock of the data directory
+	unlock, err := store.LockDataDir()
+	if err != nil {
+		t.Fatal("Lock data directory error:", err)
+	}
+	if _, err := Create("backup.tar.gz"); err == nil {
+		t.Error("Backup should fail while the arbiter is running.")
+	}
+	if exist, _ := store.PathExists("backup.tar.gz"); exist {
+		t.Error("Backup file should not be written while the arbiter is running.")
+	}
+
+	unlock()
+	if _, err := Create("backup.tar.gz"); err != nil {
+		t.Error("Create backup error:", err)
+	}
+}
+
+func TestRestore_Rollback(t *testing.T) {
+	defer setupDataDir(t)()
+
+	sideNodes := config.Parameters.SideNodeList
+	config.Parameters.SideNodeList = []*config.SideNodeConfig{{KeystoreFile: filepath.Join("side", "keystore.dat")}}
+	defer func() { config.Parameters.SideNodeList = sideNodes }()
+	os.MkdirAll("side", os.ModePerm)
+	ioutil.WriteFile(filepath.Join("side", "keystore.dat"), []byte("side"), 0600)
+
+	if _, err := Create("backup.tar.gz"); err != nil {
+		t.Fatal("Create backup error:", err)
+	}
+
+	// The side chain keystore can not be restored after the others are
+	ioutil.WriteFile("keystore.dat", []byte("changed"), 0600)
+	ioutil.WriteFile(filepath.Join(spvPath(), "headers"), []byte("changed"), 0600)
+	os.RemoveAll("side")
+	ioutil.WriteFile("side", []byte("file"), 0600)
+	if _, err := Restore("backup.tar.gz"); err == nil {
+		t.Fatal("Restore should fail if a keystore can not be restored.")
+	}
+
+	if data, _ := ioutil.ReadFile("keystore.dat"); string(data) != "changed" {
+		t.Error("Replaced keystore should be moved back.")
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(spvPath(), "headers")); string(data) != "changed" {
+		t.Error("Replaced spv data should be moved back.")
+	}
+	if exist, _ := store.PathExists(store.DBNameSideChain); !exist {
+		t.Error("Replaced side chain database should be moved back.")
+	}
+	if replaced, _ := filepath.Glob("keystore.dat.before_restore_*"); len(replaced) != 0 {
+		t.Error("Replaced keystore should not be kept aside.")
+	}
+}
+
+func TestRestore_ArbiterRunning(t *testing.T) {
+	defer setupDataDir(t)()
+
+	if _, err := Create("backup.tar.gz"); err != nil {
+		t.Fatal("Create backup error:", err)
+	}
+	unlock, err := store.LockDataDir()
+	if err != nil {
+		t.Fatal("Lock data directory error:", err)
+	}
+	defer unlock()
+
+	ioutil.WriteFile("keystore.dat", []byte("current"), 0600)
+	if _, err := Restore("backup.tar.gz"); err == nil {
+		t.Error("Restore should fail while the arbiter is running.")
+	}
+	if data, _ := ioutil.ReadFile("keystore.dat"); string(data) != "current" {
+		t.Error("Keystore should not be replaced while the arbiter is running.")
+	}
+}
+
+// rewriteArchive writes the archive at src to dst with the manifest and the
+// file contents changed by modify.
+func rewriteArchive(t *testing.T, src, dst string, modify func(manifest *Manifest, contents map[string][]byte)) {
+	var manifest Manifest
+	contents := make(map[string][]byte)
+
+	file, err := os.Open(src)
+	if err != nil {
+		t.Fatal("Open backup error.")
+	}
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal("Read backup error.")
+	}
+	tarReader := tar.NewReader(gzipReader)
+	for header, err := tarReader.Next(); err == nil; header, err = tarReader.Next() {
+		data, _ := ioutil.ReadAll(tarReader)
+		if header.Name == manifestName {
+			json.Unmarshal(data, &manifest)
+		} else {
+			contents[header.Name] = data
+		}
+	}
+	file.Close()
+
+	modify(&manifest, contents)
+
+	out, err := os.Create(dst)
+	if err != nil {
+		t.Fatal("Create backup error.")
+	}
+	defer out.Close()
+	gzipWriter := gzip.NewWriter(out)
+	tarWriter := tar.NewWriter(gzipWriter)
+	manifestBytes, _ := json.Marshal(&manifest)
+	tarWriter.WriteHeader(&tar.Header{Name: manifestName, Mode: 0600, Size: int64(len(manifestBytes))})
+	tarWriter.Write(manifestBytes)
+	for _, f := range manifest.Files {
+		tarWriter.WriteHeader(&tar.Header{Name: f.Name, Mode: 0600, Size: int64(len(contents[f.Name]))})
+		tarWriter.Write(contents[f.Name])
+	}
+	tarWriter.Close()
+	gzipWriter.Close()
+}
+
+func TestRestore_InvalidArchive(t *testing.T) {
+	defer setupDataDir(t)()
+
+	if _, err := Create("backup.tar.gz"); err != nil {
+		t.Fatal("Create backup error:", err)
+	}
+	ioutil.WriteFile("keystore.dat", []byte("current"), 0600)
+
+	rewriteArchive(t, "backup.tar.gz", "tampered.tar.gz", func(manifest *Manifest, contents map[string][]byte) {
+		contents["keystores/0/keystore.dat"] = []byte("tampered")
+		for _, f := range manifest.Files {
+			if f.Name == "keystores/0/keystore.dat" {
+				f.Size = int64(len("tampered"))
+			}
+		}
+	})
+	if _, err := Restore("tampered.tar.gz"); err == nil {
+		t.Error("Restore should fail with checksum mismatched.")
+	}
+
+	rewriteArchive(t, "backup.tar.gz", "escaped.tar.gz", func(manifest *Manifest, contents map[string][]byte) {
+		contents["spv/../../escaped"] = []byte("escaped")
+		manifest.Files = append(manifest.Files, &File{Name: "spv/../../escaped", Size: 7})
+	})
+	if _, err := Restore("escaped.tar.gz"); err == nil {
+		t.Error("Restore should fail with invalid file name.")
+	}
+
+	rewriteArchive(t, "backup.tar.gz", "newer.tar.gz", func(manifest *Manifest, contents map[string][]byte) {
+		manifest.Version = Version + 1
+	})
+	if _, err := Restore("newer.tar.gz"); err == nil {
+		t.Error("Restore should fail with unsupported version.")
+	}
+
+	if data, _ := ioutil.ReadFile("keystore.dat"); string(data) != "current" {
+		t.Error("Keystore should not be replaced by invalid backups.")
+	}
+}
@@ -15,6 +15,14 @@ import (
 
 const (
 	DefaultConfigFilename = "./config.json"
+
+	// DefaultConfirmationDepth is the number of blocks a side chain block must
+	// be buried under before its withdraw transactions are processed
+	DefaultConfirmationDepth = 6
+
+	// DefaultUTXOSelector is the strategy used to select the inputs of
+	// withdraw transactions when a side chain does not specify one
+	DefaultUTXOSelector = "smallestfirst"
 )
 
 var (
@@ -33,6 +41,9 @@ type Configuration struct {
 	SeedList []string `json:"SeedList"`
 	NodePort uint16   `json:"NodePort"`
 
+	ArbiterPeers           []*ArbiterPeerConfig `json:"ArbiterPeers"`
+	ArbiterConnectInterval time.Duration        `json:"ArbiterConnectInterval"`
+
 	MainNode     *MainNodeConfig   `json:"MainNode"`
 	SideNodeList []*SideNodeConfig `json:"SideNodeList"`
 
@@ -54,6 +65,35 @@ type Configuration struct {
 	SideAuxPowFee                int           `json:"SideAuxPowFee"`
 	MinThreshold                 int           `json:"MinThreshold"`
 	DepositAmount                int           `json:"DepositAmount"`
+	ProposalExpiryBlocks         uint32        `json:"ProposalExpiryBlocks"`
+	ProposalTimeout              time.Duration `json:"ProposalTimeout"`
+	ProposalMaxRebroadcasts      uint32        `json:"ProposalMaxRebroadcasts"`
+	WithdrawBatchMaxTxs          int           `json:"WithdrawBatchMaxTxs"`
+	WithdrawBatchMaxOutputs      int           `json:"WithdrawBatchMaxOutputs"`
+	WithdrawBatchMaxSize         int           `json:"WithdrawBatchMaxSize"`
+	WithdrawFeeRate              int64         `json:"WithdrawFeeRate"`
+	ConsolidateInterval          time.Duration `json:"ConsolidateInterval"`
+	ConsolidateDustThreshold     int64         `json:"ConsolidateDustThreshold"`
+	ConsolidateMinUTXOs          int           `json:"ConsolidateMinUTXOs"`
+	ConsolidateMaxUTXOs          int           `json:"ConsolidateMaxUTXOs"`
+	MaxMisbehaviorScore          int           `json:"MaxMisbehaviorScore"`
+	BanDuration                  time.Duration `json:"BanDuration"`
+	MessageCacheSize             int           `json:"MessageCacheSize"`
+	MessageCacheExpiration       time.Duration `json:"MessageCacheExpiration"`
+	MigrationDryRun              bool          `json:"MigrationDryRun"`
+	MigrationBackup              bool          `json:"MigrationBackup"`
+	StoreBackend                 string        `json:"StoreBackend"`
+	FinishedTxsPruneInterval     time.Duration `json:"FinishedTxsPruneInterval"`
+	FinishedTxsRetentionAge      time.Duration `json:"FinishedTxsRetentionAge"`
+	FinishedTxsRetentionCount    int           `json:"FinishedTxsRetentionCount"`
+	FinishedTxsKeepFailedOnly    bool          `json:"FinishedTxsKeepFailedOnly"`
+	FinishedTxsArchivePath       string        `json:"FinishedTxsArchivePath"`
+	BackupPath                   string        `json:"BackupPath"`
+	VerifyOnStartup              bool          `json:"VerifyOnStartup"`
+	VerifyRepair                 bool          `json:"VerifyRepair"`
+	RpcTimeout                   time.Duration `json:"RpcTimeout"`
+	RpcMaxRetries                int           `json:"RpcMaxRetries"`
+	RpcRetryInterval             time.Duration `json:"RpcRetryInterval"`
 }
 
 type RpcConfig struct {
@@ -61,6 +101,11 @@ type RpcConfig struct {
 	HttpJsonPort int    `json:"HttpJsonPort"`
 }
 
+type ArbiterPeerConfig struct {
+	PublicKey string `json:"PublicKey"`
+	Address   string `json:"Address"`
+}
+
 type MainNodeConfig struct {
 	Rpc               *RpcConfig `json:"Rpc"`
 	SpvSeedList       []string   `json:"SpvSeedList""`
@@ -80,6 +125,8 @@ type SideNodeConfig struct {
 	KeystoreFile        string  `json:"KeystoreFile"`
 	PayToAddr           string  `json:"PayToAddr"`
 	PowChain            bool    `json:"PowChain"`
+	ConfirmationDepth   uint32  `json:"ConfirmationDepth"`
+	UTXOSelector        string  `json:"UTXOSelector"`
 }
 
 type ConfigFile struct {
@@ -114,6 +161,7 @@ func init() {
 			Magic:                        0,
 			Version:                      0,
 			NodePort:                     20538,
+			ArbiterConnectInterval:       10000,
 			HttpJsonPort:                 20536,
 			HttpRestPort:                 20534,
 			PrintLevel:                   1,
@@ -127,6 +175,35 @@ func init() {
 			SideAuxPowFee:                50000,
 			MinThreshold:                 10000000,
 			DepositAmount:                10000000,
+			ProposalExpiryBlocks:         30,
+			ProposalTimeout:              60000,
+			ProposalMaxRebroadcasts:      3,
+			WithdrawBatchMaxTxs:          100,
+			WithdrawBatchMaxOutputs:      1000,
+			WithdrawBatchMaxSize:         100000,
+			WithdrawFeeRate:              100,
+			ConsolidateInterval:          3600000,
+			ConsolidateDustThreshold:     100000,
+			ConsolidateMinUTXOs:          50,
+			ConsolidateMaxUTXOs:          100,
+			MaxMisbehaviorScore:          100,
+			BanDuration:                  86400000,
+			MessageCacheSize:             10000,
+			MessageCacheExpiration:       600000,
+			MigrationDryRun:              false,
+			MigrationBackup:              true,
+			StoreBackend:                 "sqlite",
+			FinishedTxsPruneInterval:     3600000,
+			FinishedTxsRetentionAge:      0,
+			FinishedTxsRetentionCount:    0,
+			FinishedTxsKeepFailedOnly:    false,
+			FinishedTxsArchivePath:       "",
+			BackupPath:                   "",
+			VerifyOnStartup:              true,
+			VerifyRepair:                 false,
+			RpcTimeout:                   30000,
+			RpcMaxRetries:                3,
+			RpcRetryInterval:             1000,
 		},
 	}
 	e = json.Unmarshal(file, &config)
@@ -137,6 +214,12 @@ func init() {
 
 	for _, side := range config.ConfigFile.SideNodeList {
 		side.PowChain = true
+		if side.ConfirmationDepth == 0 {
+			side.ConfirmationDepth = DefaultConfirmationDepth
+		}
+		if side.UTXOSelector == "" {
+			side.UTXOSelector = DefaultUTXOSelector
+		}
 	}
 
 	e = json.Unmarshal(file, &config)
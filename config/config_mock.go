@@ -74,5 +74,7 @@ func InitMockConfig() {
 		}
 		node.GenesisBlockAddress = address
 		node.GenesisBlock = reversedGenesisStr
+		node.ConfirmationDepth = DefaultConfirmationDepth
+		node.UTXOSelector = DefaultUTXOSelector
 	}
 }
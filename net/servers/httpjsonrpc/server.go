@@ -29,8 +29,17 @@ func StartRPCServer() {
 	mainMux["getsidechainblockheight"] = GetSideChainBlockHeight
 	mainMux["getfinisheddeposittxs"] = GetFinishedDepositTxs
 	mainMux["getfinishedwithdrawtxs"] = GetFinishedWithdrawTxs
+	mainMux["gettransfers"] = GetTransfers
+	mainMux["getdatabaseinfo"] = GetDatabaseInfo
+	mainMux["createbackup"] = CreateBackup
+	mainMux["verify"] = Verify
 	mainMux["getgitversion"] = GetGitVersion
 	mainMux["getspvheight"] = GetSPVHeight
+	mainMux["getproposals"] = GetProposals
+	mainMux["getproposalstatus"] = GetProposalStatus
+	mainMux["getpeerinfo"] = GetPeerInfo
+	mainMux["banpeer"] = BanPeer
+	mainMux["unbanpeer"] = UnbanPeer
 
 	err := http.ListenAndServe(":"+strconv.Itoa(config.Parameters.HttpJsonPort), nil)
 	if err != nil {
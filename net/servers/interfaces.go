@@ -6,11 +6,14 @@ import (
 	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/arbitrator"
 	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
 	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/complain"
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/cs"
+	"github.com/elastos/Elastos.ELA.Arbiter/backup"
 	"github.com/elastos/Elastos.ELA.Arbiter/config"
 	. "github.com/elastos/Elastos.ELA.Arbiter/errors"
 	"github.com/elastos/Elastos.ELA.Arbiter/sideauxpow"
 	. "github.com/elastos/Elastos.ELA.Arbiter/store"
 
+	spv "github.com/elastos/Elastos.ELA.SPV/interface"
 	. "github.com/elastos/Elastos.ELA/common"
 )
 
@@ -210,23 +213,386 @@ func GetFinishedWithdrawTxs(param Params) map[string]interface{} {
 	if err != nil {
 		return ResponsePack(InvalidParams, "get withdraw transactions from finished dbcache failed")
 	}
-	withdrawTxs := struct{ Transactions []string }{}
+	withdrawTxs := struct {
+		Transactions  []string
+		FailedReasons map[string]string `json:",omitempty"`
+	}{}
 
 	for _, hash := range txHashes {
 		withdrawTxs.Transactions = append(withdrawTxs.Transactions, hash)
 	}
 
+	if !succeed {
+		failedHashes, reasons, err := FinishedTxsDbCache.GetFailedWithdrawTxReasons()
+		if err != nil {
+			return ResponsePack(InternalError, "get failed withdraw reasons from finished dbcache failed")
+		}
+		withdrawTxs.FailedReasons = make(map[string]string)
+		for i, hash := range failedHashes {
+			withdrawTxs.FailedReasons[hash] = reasons[i]
+		}
+	}
+
 	return ResponsePack(Success, &withdrawTxs)
 }
 
+// GetTransfers returns a page of the finished cross chain transfers from the
+// latest, filtered by the optional parameters.
+func GetTransfers(param Params) map[string]interface{} {
+	filter := new(TransferFilter)
+	if transferType, ok := param.String("type"); ok {
+		var t TransferType
+		switch transferType {
+		case DepositTransfer.String():
+			t = DepositTransfer
+		case WithdrawTransfer.String():
+			t = WithdrawTransfer
+		default:
+			return ResponsePack(InvalidParams, "type should be deposit or withdraw")
+		}
+		filter.Type = &t
+	}
+	filter.GenesisBlockAddress, _ = param.String("genesisblockaddress")
+	filter.TargetAddress, _ = param.String("targetaddress")
+	filter.TransactionHash, _ = param.String("transactionhash")
+	if _, ok := param["succeed"]; ok {
+		succeed, ok := param.Bool("succeed")
+		if !ok {
+			return ResponsePack(InvalidParams, "succeed should be a bool")
+		}
+		filter.Succeed = &succeed
+	}
+
+	for key, value := range map[string]*int64{"starttime": &filter.StartTime, "endtime": &filter.EndTime} {
+		if _, ok := param[key]; !ok {
+			continue
+		}
+		time, ok := param.Int(key)
+		if !ok || time < 0 {
+			return ResponsePack(InvalidParams, key+" should be unix seconds")
+		}
+		*value = time
+	}
+	for key, value := range map[string]*Fixed64{"minamount": &filter.MinAmount, "maxamount": &filter.MaxAmount} {
+		if _, ok := param[key]; !ok {
+			continue
+		}
+		amountStr, ok := param.String(key)
+		if !ok {
+			return ResponsePack(InvalidParams, key+" should be a string of amount")
+		}
+		amount, err := StringToFixed64(amountStr)
+		if err != nil || *amount < 0 {
+			return ResponsePack(InvalidParams, "invalid "+key)
+		}
+		*value = *amount
+	}
+	if _, ok := param["cursor"]; ok {
+		cursor, ok := param.Int("cursor")
+		if !ok || cursor < 0 {
+			return ResponsePack(InvalidParams, "invalid cursor")
+		}
+		filter.Cursor = uint64(cursor)
+	}
+	if _, ok := param["limit"]; ok {
+		limit, ok := param.Int("limit")
+		if !ok || limit <= 0 || limit > MaxTransfersPageSize {
+			return ResponsePack(InvalidParams, "limit should be between 1 and 500")
+		}
+		filter.Limit = int(limit)
+	}
+
+	transfers, nextCursor, err := FinishedTxsDbCache.QueryTransfers(filter)
+	if err != nil {
+		return ResponsePack(InternalError, "query transfers from finished dbcache failed")
+	}
+
+	type transferInfo struct {
+		Type                string
+		TransactionHash     string
+		GenesisBlockAddress string
+		OutputIndex         uint32
+		MainChainTxHash     string
+		SideChainTxHash     string
+		TargetAddress       string
+		Amount              string
+		BlockHeight         uint32
+		Succeed             bool
+		FailedReason        string `json:",omitempty"`
+		RecordTime          int64
+	}
+	result := struct {
+		Transfers  []transferInfo
+		NextCursor uint64
+	}{NextCursor: nextCursor}
+
+	for _, t := range transfers {
+		result.Transfers = append(result.Transfers, transferInfo{
+			Type:                t.Type.String(),
+			TransactionHash:     t.TransactionHash,
+			GenesisBlockAddress: t.GenesisBlockAddress,
+			OutputIndex:         t.OutputIndex,
+			MainChainTxHash:     t.MainChainTxHash,
+			SideChainTxHash:     t.SideChainTxHash,
+			TargetAddress:       t.TargetAddress,
+			Amount:              t.Amount.String(),
+			BlockHeight:         t.BlockHeight,
+			Succeed:             t.Succeed,
+			FailedReason:        t.FailedReason,
+			RecordTime:          t.RecordTime,
+		})
+	}
+
+	return ResponsePack(Success, &result)
+}
+
+// GetDatabaseInfo returns the sizes of the databases, the retention policy of
+// finished transactions and the result of the last prune run.
+func GetDatabaseInfo(param Params) map[string]interface{} {
+	sizes, err := DatabaseSizes()
+	if err != nil {
+		return ResponsePack(InternalError, "get database sizes failed")
+	}
+
+	type databaseInfo struct {
+		Name string
+		Size int64
+	}
+	type retentionPolicyInfo struct {
+		MaxAge         int64
+		MaxCount       int
+		KeepFailedOnly bool
+	}
+	type pruneRunInfo struct {
+		StartTime    string
+		Duration     int64
+		DepositTxs   int
+		WithdrawTxs  int
+		SideChainTxs int
+		Transfers    int
+		ArchiveFile  string
+		Error        string `json:",omitempty"`
+	}
+	result := struct {
+		StoreBackend    string
+		Databases       []databaseInfo
+		RetentionPolicy *retentionPolicyInfo
+		LastPruneRun    *pruneRunInfo
+	}{StoreBackend: config.Parameters.StoreBackend}
+
+	for _, size := range sizes {
+		result.Databases = append(result.Databases, databaseInfo{Name: size.Name, Size: size.Size})
+	}
+	if FinishedTxsPruner != nil {
+		policy := FinishedTxsPruner.Policy()
+		result.RetentionPolicy = &retentionPolicyInfo{
+			MaxAge:         int64(policy.MaxAge / time.Millisecond),
+			MaxCount:       policy.MaxCount,
+			KeepFailedOnly: policy.KeepFailedOnly,
+		}
+		if run := FinishedTxsPruner.LastRun(); run != nil {
+			result.LastPruneRun = &pruneRunInfo{
+				StartTime:    run.StartTime.Format("2006-01-02 15:04:05"),
+				Duration:     int64(run.Duration / time.Millisecond),
+				DepositTxs:   run.DepositTxs,
+				WithdrawTxs:  run.WithdrawTxs,
+				SideChainTxs: run.SideChainTxs,
+				Transfers:    run.Transfers,
+				ArchiveFile:  run.ArchiveFile,
+				Error:        run.Error,
+			}
+		}
+	}
+
+	return ResponsePack(Success, &result)
+}
+
+// CreateBackup writes a backup archive of the databases, the SPV data and the
+// keystore files under BackupPath while the arbiter is running.
+func CreateBackup(param Params) map[string]interface{} {
+	path := backup.DefaultPath()
+	manifest, err := backup.Create(path)
+	if err != nil {
+		return ResponsePack(InternalError, "create backup failed: "+err.Error())
+	}
+
+	result := struct {
+		File        string
+		Version     uint32
+		CreatedTime string
+		Files       []*backup.File
+	}{
+		File:        path,
+		Version:     manifest.Version,
+		CreatedTime: manifest.CreatedTime,
+		Files:       manifest.Files,
+	}
+	return ResponsePack(Success, &result)
+}
+
+// Verify cross checks the cached cross chain state against the main node and
+// the side nodes, the discrepancies are repaired if repair is true.
+func Verify(param Params) map[string]interface{} {
+	repair := false
+	if _, ok := param["repair"]; ok {
+		if repair, ok = param.Bool("repair"); !ok {
+			return ResponsePack(InvalidParams, "repair should be a bool")
+		}
+	}
+
+	report, err := arbitrator.ArbitratorGroupSingleton.GetCurrentArbitrator().Verify(repair)
+	if err != nil {
+		return ResponsePack(InternalError, "verify failed: "+err.Error())
+	}
+
+	result := struct {
+		StartTime   string
+		Duration    int64
+		Consistent  bool
+		Repair      bool
+		Repaired    bool
+		UTXOs       []*arbitrator.UTXODiscrepancy
+		DepositTxs  []*arbitrator.TxDiscrepancy
+		WithdrawTxs []*arbitrator.TxDiscrepancy
+		Skipped     []string
+	}{
+		StartTime:   report.StartTime.Format("2006-01-02 15:04:05"),
+		Duration:    int64(report.Duration / time.Millisecond),
+		Consistent:  report.Consistent(),
+		Repair:      report.Repair,
+		Repaired:    report.Repaired,
+		UTXOs:       report.UTXOs,
+		DepositTxs:  report.DepositTxs,
+		WithdrawTxs: report.WithdrawTxs,
+		Skipped:     report.Skipped,
+	}
+	return ResponsePack(Success, &result)
+}
+
 func GetGitVersion(param Params) map[string]interface{} {
 	return ResponsePack(Success, config.Version)
 }
 
 func GetSPVHeight(param Params) map[string]interface{} {
-	bestHeader, err := arbitrator.SpvService.HeaderStore().GetBest()
+	var height uint32
+	err := arbitrator.UseSpvService(func(service spv.SPVService) error {
+		bestHeader, err := service.HeaderStore().GetBest()
+		if err != nil {
+			return err
+		}
+		height = bestHeader.Height
+		return nil
+	})
 	if err != nil {
 		return ResponsePack(InternalError, "get spv best header failed")
 	}
-	return ResponsePack(Success, bestHeader.Height)
+	return ResponsePack(Success, height)
+}
+
+func GetProposals(param Params) map[string]interface{} {
+	mc := arbitrator.ArbitratorGroupSingleton.GetCurrentArbitrator().GetMainChain()
+	if mc == nil {
+		return ResponsePack(InternalError, "main chain is not initialized")
+	}
+	proposals := struct {
+		Metrics   base.ProposalMetrics
+		Proposals []*base.ProposalInfo
+	}{
+		Metrics:   mc.GetProposalMetrics(),
+		Proposals: mc.GetProposals(),
+	}
+	return ResponsePack(Success, &proposals)
+}
+
+func GetProposalStatus(param Params) map[string]interface{} {
+	if !checkParam(param, "transactionhash") {
+		return ResponsePack(InvalidParams, "need a string parameter named transactionhash")
+	}
+	txHash, err := parseTransactionHash(param["transactionhash"].(string))
+	if err != nil {
+		return ResponsePack(InvalidParams, "invalid transaction hash")
+	}
+
+	currentArbitrator := arbitrator.ArbitratorGroupSingleton.GetCurrentArbitrator()
+	mc := currentArbitrator.GetMainChain()
+	if mc == nil {
+		return ResponsePack(InternalError, "main chain is not initialized")
+	}
+	status, ok := mc.GetProposalStatus(*txHash)
+	if !ok {
+		status = &base.ProposalStatus{TransactionHash: txHash.String()}
+	}
+
+	// Proposals refused by current arbiter are recorded by the client side
+	if client := currentArbitrator.GetMainChainClient(); client != nil {
+		if rejection, rejected := client.GetProposalRejection(*txHash); rejected {
+			ok = true
+			status.Rejected = append(status.Rejected, rejection)
+		}
+	}
+	if !ok {
+		return ResponsePack(UnknownTransaction, "proposal not found")
+	}
+
+	return ResponsePack(Success, status)
+}
+
+// parseTransactionHash parses the transaction hash in the reversed byte order
+// of Uint256.String, which is the order returned by getproposals.
+func parseTransactionHash(transactionHash string) (*Uint256, error) {
+	txHashBytes, err := HexStringToBytes(transactionHash)
+	if err != nil {
+		return nil, err
+	}
+	txHashBytes = BytesReverse(txHashBytes)
+	return Uint256FromBytes(txHashBytes)
+}
+
+func GetPeerInfo(param Params) map[string]interface{} {
+	if cs.P2PClientSingleton == nil {
+		return ResponsePack(InternalError, "p2p client is not initialized")
+	}
+	peers := struct {
+		Peers        []*base.PeerInfo
+		Arbiters     []*base.ArbiterConnection
+		Banned       []*base.BannedPeer
+		MessageCache *base.MessageCacheInfo
+	}{
+		Peers:        cs.P2PClientSingleton.GetPeerInfo(),
+		Arbiters:     cs.P2PClientSingleton.GetArbiterConnections(),
+		Banned:       cs.P2PClientSingleton.GetBannedPeers(),
+		MessageCache: cs.P2PClientSingleton.GetMessageCacheInfo(),
+	}
+	return ResponsePack(Success, &peers)
+}
+
+func BanPeer(param Params) map[string]interface{} {
+	host, ok := param.String("host")
+	if !ok || host == "" {
+		return ResponsePack(InvalidParams, "need a string parameter named host")
+	}
+	duration := time.Millisecond * config.Parameters.BanDuration
+	if _, ok := param["duration"]; ok {
+		seconds, ok := param.Uint("duration")
+		if !ok {
+			return ResponsePack(InvalidParams, "duration should be seconds in uint")
+		}
+		duration = time.Duration(seconds) * time.Second
+	}
+	if cs.P2PClientSingleton == nil {
+		return ResponsePack(InternalError, "p2p client is not initialized")
+	}
+	cs.P2PClientSingleton.BanPeer(host, duration)
+	return ResponsePack(Success, true)
+}
+
+func UnbanPeer(param Params) map[string]interface{} {
+	host, ok := param.String("host")
+	if !ok || host == "" {
+		return ResponsePack(InvalidParams, "need a string parameter named host")
+	}
+	if cs.P2PClientSingleton == nil {
+		return ResponsePack(InternalError, "p2p client is not initialized")
+	}
+	return ResponsePack(Success, cs.P2PClientSingleton.UnbanPeer(host))
 }
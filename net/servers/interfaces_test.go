@@ -0,0 +1,37 @@
+package servers
+
+import (
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/cs"
+
+	"github.com/elastos/Elastos.ELA/common"
+	. "github.com/elastos/Elastos.ELA/core/types"
+	"github.com/elastos/Elastos.ELA/core/types/payload"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTransactionHash(t *testing.T) {
+	dns := &cs.DistributedNodeServer{}
+	proposal := &Transaction{
+		TxType: WithdrawFromSideChain,
+		Payload: &payload.PayloadWithdrawFromSideChain{
+			GenesisBlockAddress:        "XQd1DCi6H62NQdWZQhJCRnrPn7sF9CTjaU",
+			SideChainTransactionHashes: []common.Uint256{{1}},
+		},
+	}
+	dns.GetProposals()
+	dns.UnsolvedTransactions()[proposal.Hash()] = proposal
+
+	// The hash returned by getproposals is accepted by getproposalstatus
+	proposals := dns.GetProposals()
+	if !assert.Equal(t, 1, len(proposals)) {
+		return
+	}
+	txHash, err := parseTransactionHash(proposals[0].TransactionHash)
+	assert.NoError(t, err)
+	assert.Equal(t, proposal.Hash(), *txHash)
+
+	_, err = parseTransactionHash("invalid")
+	assert.Error(t, err)
+}
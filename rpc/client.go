@@ -0,0 +1,213 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+)
+
+// transport is shared by all clients, so the connections to the nodes are kept
+// alive and reused between requests.
+var transport = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	DialContext: (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	MaxIdleConns:        100,
+	MaxIdleConnsPerHost: 10,
+	IdleConnTimeout:     90 * time.Second,
+}
+
+var (
+	clientsMux sync.Mutex
+	clients    = make(map[string]*Client)
+
+	requestID int64
+)
+
+type Response struct {
+	ID      int64       `json:"id"`
+	Version string      `json:"jsonrpc"`
+	Result  interface{} `json:"result"`
+	*Error  `json:"error"`
+}
+
+// Error is the error code and message responded by a node, the request has
+// been handled by the node.
+type Error struct {
+	Code    int64  `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// TransportError is an error of sending a request or receiving the response,
+// the request may not have been handled by the node.
+type TransportError struct {
+	Method string
+	URL    string
+	// StatusCode is the http status of the response, 0 if no response
+	StatusCode int
+	Err        error
+}
+
+func (e *TransportError) Error() string {
+	message := "[rpc] " + e.Method + " to " + e.URL + " failed"
+	if e.StatusCode != 0 {
+		message += ", status " + strconv.Itoa(e.StatusCode)
+	}
+	if e.Err != nil {
+		message += ": " + e.Err.Error()
+	}
+	return message
+}
+
+// Temporary returns whether the request may succeed if sent again.
+func (e *TransportError) Temporary() bool {
+	return e.StatusCode == 0 || e.StatusCode >= http.StatusInternalServerError
+}
+
+// Client sends JSON-RPC 2.0 requests to a node.
+type Client struct {
+	url           string
+	httpClient    *http.Client
+	maxRetries    int
+	retryInterval time.Duration
+}
+
+// NewClient returns a client of the node at rpcConfig, with the timeout and
+// retries of the configuration.
+func NewClient(rpcConfig *config.RpcConfig) *Client {
+	return &Client{
+		url: "http://" + rpcConfig.IpAddress + ":" + strconv.Itoa(rpcConfig.HttpJsonPort),
+		httpClient: &http.Client{
+			Transport: transport,
+			Timeout:   time.Millisecond * config.Parameters.RpcTimeout,
+		},
+		maxRetries:    config.Parameters.RpcMaxRetries,
+		retryInterval: time.Millisecond * config.Parameters.RpcRetryInterval,
+	}
+}
+
+// GetClient returns the client of the node at rpcConfig, which is created once
+// for each node.
+func GetClient(rpcConfig *config.RpcConfig) *Client {
+	url := "http://" + rpcConfig.IpAddress + ":" + strconv.Itoa(rpcConfig.HttpJsonPort)
+
+	clientsMux.Lock()
+	defer clientsMux.Unlock()
+
+	client, ok := clients[url]
+	if !ok {
+		client = NewClient(rpcConfig)
+		clients[url] = client
+	}
+	return client
+}
+
+// Call sends an idempotent request and returns the result, the request is
+// sent again with exponential backoff on temporary transport errors.
+func (c *Client) Call(method string, params interface{}) (interface{}, error) {
+	resp, err := c.CallResponse(method, params)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+	return resp.Result, nil
+}
+
+// CallResponse is the same as Call, except that the error responded by the
+// node is returned in the response.
+func (c *Client) CallResponse(method string, params interface{}) (Response, error) {
+	interval := c.retryInterval
+	for retries := 0; ; retries++ {
+		resp, err := c.send(method, params)
+		if err == nil {
+			return resp, nil
+		}
+		transportErr, ok := err.(*TransportError)
+		if !ok || !transportErr.Temporary() || retries >= c.maxRetries {
+			return Response{}, err
+		}
+		log.Debug("[rpc] retry", method, "in", interval, "err:", err)
+		time.Sleep(interval)
+		interval *= 2
+	}
+}
+
+// Send sends a request which should not be sent twice, such as sending a
+// transaction, and returns the result.
+func (c *Client) Send(method string, params interface{}) (interface{}, error) {
+	resp, err := c.SendResponse(method, params)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+	return resp.Result, nil
+}
+
+// SendResponse is the same as Send, except that the error responded by the
+// node is returned in the response.
+func (c *Client) SendResponse(method string, params interface{}) (Response, error) {
+	return c.send(method, params)
+}
+
+func (c *Client) send(method string, params interface{}) (Response, error) {
+	id := atomic.AddInt64(&requestID, 1)
+	data, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return Response{}, err
+	}
+
+	httpResp, err := c.httpClient.Post(c.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return Response{}, &TransportError{Method: method, URL: c.url, Err: err}
+	}
+	// The body is read to the end and closed, so the connection is reused
+	body, err := ioutil.ReadAll(httpResp.Body)
+	httpResp.Body.Close()
+	if err != nil {
+		return Response{}, &TransportError{Method: method, URL: c.url, StatusCode: httpResp.StatusCode, Err: err}
+	}
+
+	resp := Response{}
+	if httpResp.StatusCode < http.StatusOK || httpResp.StatusCode >= http.StatusMultipleChoices {
+		// Some nodes respond their errors with http error status
+		if err := json.Unmarshal(body, &resp); err == nil && resp.Error != nil {
+			return resp, nil
+		}
+		return Response{}, &TransportError{Method: method, URL: c.url, StatusCode: httpResp.StatusCode}
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return Response{}, &TransportError{Method: method, URL: c.url, StatusCode: httpResp.StatusCode,
+			Err: errors.New("invalid response: " + err.Error())}
+	}
+	// Nodes not following JSON-RPC 2.0 respond without id
+	if resp.ID != 0 && resp.ID != id {
+		return Response{}, &TransportError{Method: method, URL: c.url, StatusCode: httpResp.StatusCode,
+			Err: errors.New("response id " + strconv.FormatInt(resp.ID, 10) + " mismatched")}
+	}
+	return resp, nil
+}
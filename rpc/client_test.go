@@ -0,0 +1,122 @@
+package rpc
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+)
+
+func TestMain(m *testing.M) {
+	config.InitMockConfig()
+	config.Parameters.RpcTimeout = 1000
+	config.Parameters.RpcMaxRetries = 2
+	config.Parameters.RpcRetryInterval = 1
+	os.Exit(m.Run())
+}
+
+// newTestClient returns a client of a node which responds with handler, and
+// the number of requests received by the node.
+func newTestClient(t *testing.T, handler func(w http.ResponseWriter, request map[string]interface{})) (*Client, *int32, func()) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		var request map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Error("Decode request error.")
+		}
+		handler(w, request)
+	}))
+
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	httpJsonPort, _ := strconv.Atoi(port)
+	client := NewClient(&config.RpcConfig{IpAddress: host, HttpJsonPort: httpJsonPort})
+	return client, &requests, server.Close
+}
+
+func TestClient_Call(t *testing.T) {
+	client, requests, closeServer := newTestClient(t, func(w http.ResponseWriter, request map[string]interface{}) {
+		if request["jsonrpc"] != "2.0" || request["method"] != "getblockcount" {
+			t.Error("Request should be JSON-RPC 2.0.")
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      request["id"],
+			"result":  100,
+		})
+	})
+	defer closeServer()
+
+	result, err := client.Call("getblockcount", nil)
+	if err != nil || result != float64(100) {
+		t.Error("Call error:", err)
+	}
+	if _, err := client.Call("getblockcount", nil); err != nil || atomic.LoadInt32(requests) != 2 {
+		t.Error("Request ids should be unique.")
+	}
+}
+
+func TestClient_Retry(t *testing.T) {
+	client, requests, closeServer := newTestClient(t, func(w http.ResponseWriter, request map[string]interface{}) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer closeServer()
+
+	_, err := client.Call("getblockcount", nil)
+	if transportErr, ok := err.(*TransportError); !ok || transportErr.StatusCode != http.StatusServiceUnavailable {
+		t.Error("Call should fail with transport error.")
+	}
+	if atomic.LoadInt32(requests) != 3 {
+		t.Error("Idempotent request should be retried.")
+	}
+
+	atomic.StoreInt32(requests, 0)
+	if _, err := client.Send("sendrawtransaction", Param("data", "00")); err == nil {
+		t.Error("Send should fail with transport error.")
+	}
+	if atomic.LoadInt32(requests) != 1 {
+		t.Error("Send should not be retried.")
+	}
+}
+
+func TestClient_NodeError(t *testing.T) {
+	client, requests, closeServer := newTestClient(t, func(w http.ResponseWriter, request map[string]interface{}) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      request["id"],
+			"error":   map[string]interface{}{"code": 45013, "message": "duplicate transaction"},
+		})
+	})
+	defer closeServer()
+
+	_, err := client.Call("sendrechargetransaction", Param("txid", "00"))
+	if nodeErr, ok := err.(*Error); !ok || nodeErr.Code != 45013 {
+		t.Error("Call should fail with node error.")
+	}
+	if atomic.LoadInt32(requests) != 1 {
+		t.Error("Node error should not be retried.")
+	}
+
+	resp, err := client.SendResponse("sendrechargetransaction", Param("txid", "00"))
+	if err != nil || resp.Error == nil || resp.Code != 45013 {
+		t.Error("Node error should be returned in response.")
+	}
+}
+
+func TestClient_InvalidResponse(t *testing.T) {
+	client, _, closeServer := newTestClient(t, func(w http.ResponseWriter, request map[string]interface{}) {
+		w.Write([]byte("not json"))
+	})
+	defer closeServer()
+
+	result, err := client.Call("getblockcount", nil)
+	if _, ok := err.(*TransportError); !ok || result != nil {
+		t.Error("Call should fail with invalid response.")
+	}
+}
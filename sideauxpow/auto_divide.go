@@ -105,7 +105,7 @@ func divideTransfer(name string, passwd []byte, outputs []*walt.Transfer) error
 	content := BytesToHexString(buf.Bytes())
 
 	// send transaction
-	result, err := rpc.CallAndUnmarshal("sendrawtransaction", rpc.Param("data", content), config.Parameters.MainNode.Rpc)
+	result, err := rpc.GetClient(config.Parameters.MainNode.Rpc).Send("sendrawtransaction", rpc.Param("data", content))
 	if err != nil {
 		return err
 	}
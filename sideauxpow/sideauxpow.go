@@ -111,7 +111,7 @@ func sideChainPowTransfer(name string, passwd []byte, sideNode *config.SideNodeC
 	if depositAddress == "" {
 		return errors.New("[sideChainPowTransfer] has no side aux pow paytoaddr")
 	}
-	resp, err := rpc.CallAndUnmarshal("createauxblock", rpc.Param("paytoaddress", depositAddress), sideNode.Rpc)
+	resp, err := rpc.GetClient(sideNode.Rpc).Call("createauxblock", rpc.Param("paytoaddress", depositAddress))
 	if err != nil {
 		log.Errorf("[sideChainPowTransfer] create aux block failed: %s", err)
 		return err
@@ -199,7 +199,7 @@ func sideChainPowTransfer(name string, passwd []byte, sideNode *config.SideNodeC
 	// log.Debug("Raw Sidemining transaction: ", content)
 
 	// send transaction
-	result, err := rpc.CallAndUnmarshal("sendrawtransaction", rpc.Param("data", content), config.Parameters.MainNode.Rpc)
+	result, err := rpc.GetClient(config.Parameters.MainNode.Rpc).Send("sendrawtransaction", rpc.Param("data", content))
 	if err != nil {
 		return errors.New("[SendSideChainMining] sendrawtransaction failed: " + err.Error())
 	}
@@ -26,7 +26,7 @@ func SubmitAuxpow(genesishash string, blockhash string, submitauxpow string) err
 	params["sideauxpow"] = submitauxpow
 
 	log.Info("[SubmitAuxpow] Submit auxblock sideNode.Rpc：", sideNode.Rpc.IpAddress, ":", sideNode.Rpc.HttpJsonPort)
-	resp, err := rpc.CallAndUnmarshal("submitsideauxblock", params, sideNode.Rpc)
+	resp, err := rpc.GetClient(sideNode.Rpc).Send("submitsideauxblock", params)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,109 @@
+package store
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+)
+
+const (
+	SQLiteBackend  = "sqlite"
+	LevelDBBackend = "leveldb"
+)
+
+// Backend opens the data stores of one storage engine, the engine used is
+// selected by StoreBackend in config.
+type Backend interface {
+	OpenUTXOStore() (DataStoreUTXO, error)
+	OpenMainChainStore() (DataStoreMainChain, error)
+	OpenSideChainStore() (DataStoreSideChain, error)
+	OpenFinishedTxsStore() (FinishedTransactionsDataStore, error)
+	OpenTxsFinisher() (TxsFinisher, error)
+
+	// Snapshot writes a consistent copy of the databases to dir while they
+	// are in use.
+	Snapshot(dir string) error
+}
+
+var (
+	backendsLock sync.Mutex
+	backends     = make(map[string]Backend)
+)
+
+// RegisterBackend makes a storage backend available by name, it panics if a
+// backend is registered twice with the same name.
+func RegisterBackend(name string, backend Backend) {
+	backendsLock.Lock()
+	defer backendsLock.Unlock()
+
+	if backend == nil {
+		panic("store: register backend is nil")
+	}
+	if _, ok := backends[name]; ok {
+		panic("store: register backend twice for " + name)
+	}
+	backends[name] = backend
+}
+
+// Backends returns the sorted names of the registered backends.
+func Backends() []string {
+	backendsLock.Lock()
+	defer backendsLock.Unlock()
+
+	var names []string
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetBackend returns the backend registered by name.
+func GetBackend(name string) (Backend, error) {
+	backendsLock.Lock()
+	defer backendsLock.Unlock()
+
+	backend, ok := backends[name]
+	if !ok {
+		return nil, errors.New("unknown store backend " + name)
+	}
+	return backend, nil
+}
+
+// currentBackend returns the backend configured, sqlite if not configured.
+func currentBackend() (Backend, error) {
+	name := config.Parameters.StoreBackend
+	if name == "" {
+		name = SQLiteBackend
+	}
+	return GetBackend(name)
+}
+
+// sqliteBackend keeps each data store in its own sqlite database file.
+type sqliteBackend struct{}
+
+func init() {
+	RegisterBackend(SQLiteBackend, sqliteBackend{})
+}
+
+func (sqliteBackend) OpenUTXOStore() (DataStoreUTXO, error) {
+	return openSQLiteUTXODataStore()
+}
+
+func (sqliteBackend) OpenMainChainStore() (DataStoreMainChain, error) {
+	return openSQLiteMainChainDataStore()
+}
+
+func (sqliteBackend) OpenSideChainStore() (DataStoreSideChain, error) {
+	return openSQLiteSideChainDataStore()
+}
+
+func (sqliteBackend) OpenFinishedTxsStore() (FinishedTransactionsDataStore, error) {
+	return openSQLiteFinishedTxsDataStore()
+}
+
+func (sqliteBackend) OpenTxsFinisher() (TxsFinisher, error) {
+	return openSQLiteTxsFinisher()
+}
@@ -0,0 +1,80 @@
+package store
+
+import (
+	"errors"
+	"io"
+
+	. "github.com/elastos/Elastos.ELA/common"
+	. "github.com/elastos/Elastos.ELA/core/types"
+)
+
+// blockUndo records the UTXO changes of one main chain block, so they can be
+// reverted when the block is orphaned by a main chain reorganization.
+type blockUndo struct {
+	Added []*Input
+	Spent []*AddressUTXO
+}
+
+func (undo *blockUndo) Serialize(w io.Writer) error {
+	if err := WriteVarUint(w, uint64(len(undo.Added))); err != nil {
+		return errors.New("[Serialize] write len added utxos failed")
+	}
+	for _, input := range undo.Added {
+		if err := input.Serialize(w); err != nil {
+			return errors.New("[Serialize] write added utxo failed")
+		}
+	}
+
+	if err := WriteVarUint(w, uint64(len(undo.Spent))); err != nil {
+		return errors.New("[Serialize] write len spent utxos failed")
+	}
+	for _, utxo := range undo.Spent {
+		if err := utxo.Input.Serialize(w); err != nil {
+			return errors.New("[Serialize] write spent utxo input failed")
+		}
+		if err := utxo.Amount.Serialize(w); err != nil {
+			return errors.New("[Serialize] write spent utxo amount failed")
+		}
+		if err := WriteVarString(w, utxo.GenesisBlockAddress); err != nil {
+			return errors.New("[Serialize] write spent utxo genesis address failed")
+		}
+	}
+
+	return nil
+}
+
+func (undo *blockUndo) Deserialize(r io.Reader) error {
+	count, err := ReadVarUint(r, 0)
+	if err != nil {
+		return errors.New("[Deserialize] read len added utxos failed")
+	}
+	undo.Added = make([]*Input, 0, count)
+	for i := uint64(0); i < count; i++ {
+		input := new(Input)
+		if err := input.Deserialize(r); err != nil {
+			return errors.New("[Deserialize] read added utxo failed")
+		}
+		undo.Added = append(undo.Added, input)
+	}
+
+	count, err = ReadVarUint(r, 0)
+	if err != nil {
+		return errors.New("[Deserialize] read len spent utxos failed")
+	}
+	undo.Spent = make([]*AddressUTXO, 0, count)
+	for i := uint64(0); i < count; i++ {
+		utxo := &AddressUTXO{Input: new(Input), Amount: new(Fixed64)}
+		if err := utxo.Input.Deserialize(r); err != nil {
+			return errors.New("[Deserialize] read spent utxo input failed")
+		}
+		if err := utxo.Amount.Deserialize(r); err != nil {
+			return errors.New("[Deserialize] read spent utxo amount failed")
+		}
+		if utxo.GenesisBlockAddress, err = ReadVarString(r); err != nil {
+			return errors.New("[Deserialize] read spent utxo genesis address failed")
+		}
+		undo.Spent = append(undo.Spent, utxo)
+	}
+
+	return nil
+}
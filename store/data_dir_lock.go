@@ -0,0 +1,29 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+
+	"github.com/syndtr/goleveldb/leveldb/storage"
+)
+
+// DataDirLockPath is the directory of the lock file of the data directory.
+var DataDirLockPath = filepath.Join(config.DataPath, config.DataDir, "lock")
+
+// LockDataDir locks the data directory, so the databases and the SPV data are
+// used by one process at a time, and returns the function releasing the lock.
+// It fails if the data directory is locked by another process, such as a
+// running arbiter.
+func LockDataDir() (func() error, error) {
+	if err := os.MkdirAll(DataDirLockPath, os.ModePerm); err != nil {
+		return nil, err
+	}
+	lock, err := storage.OpenFile(DataDirLockPath, false)
+	if err != nil {
+		return nil, fmt.Errorf("data directory is in use, is the arbiter running? %s", err)
+	}
+	return lock.Close, nil
+}
@@ -3,10 +3,12 @@ package store
 import (
 	"bytes"
 	"database/sql"
+	"errors"
 	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"sync"
 
 	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
@@ -31,6 +33,14 @@ const (
 
 	QueryHeightCode = 0
 	ResetHeightCode = math.MaxUint32
+
+	// MaxUndoBlocksCount is the number of latest main chain blocks whose UTXO
+	// changes are kept, which is the deepest reorganization that can be undone
+	MaxUndoBlocksCount = 100
+
+	// MaxSideChainBlocksCount is the number of latest processed blocks of each
+	// side chain whose hashes are kept to detect side chain reorganizations
+	MaxSideChainBlocksCount = 100
 )
 
 const (
@@ -48,6 +58,17 @@ const (
 				Amount VARCHAR,
 				GenesisBlockAddress VARCHAR(34)
 			);`
+	CreateMainChainBlocksTable = `CREATE TABLE IF NOT EXISTS MainChainBlocks (
+				Height INTEGER NOT NULL PRIMARY KEY,
+				BlockHash VARCHAR,
+				UndoData BLOB
+			);`
+	CreateSideChainBlocksTable = `CREATE TABLE IF NOT EXISTS SideChainBlocks (
+				GenesisBlockAddress VARCHAR(34) NOT NULL,
+				Height INTEGER NOT NULL,
+				BlockHash VARCHAR,
+				PRIMARY KEY (GenesisBlockAddress, Height)
+			);`
 	CreateSideChainTxsTable = `CREATE TABLE IF NOT EXISTS SideChainTxs (
 				Id INTEGER NOT NULL PRIMARY KEY,
 				TransactionHash VARCHAR UNIQUE,
@@ -61,14 +82,38 @@ const (
 				GenesisBlockAddress VARCHAR(34),
 				TransactionData BLOB,
 				MerkleProof BLOB,
+				BlockHeight INTEGER,
                 UNIQUE (TransactionHash, GenesisBlockAddress)
 			);`
+	CreateProposalsTable = `CREATE TABLE IF NOT EXISTS Proposals (
+				TransactionHash VARCHAR NOT NULL PRIMARY KEY,
+				GenesisBlockAddress VARCHAR(34),
+				TransactionData BLOB,
+				RedeemScript BLOB,
+				Signatures BLOB,
+				CreationHeight INTEGER
+			);`
 )
 
 var (
 	DbCache DataStoreImpl
 )
 
+var (
+	utxoMigrations = []*Migration{
+		{1, "create utxo tables", createTables(CreateInfoTable, CreateHeightInfoTable,
+			CreateUTXOsTable, CreateMainChainBlocksTable)},
+	}
+	mainChainMigrations = []*Migration{
+		{1, "create main chain tables", createTables(CreateMainChainTxsTable, CreateProposalsTable)},
+		{2, "add BlockHeight to MainChainTxs", addColumn("MainChainTxs", "BlockHeight", "INTEGER")},
+	}
+	sideChainMigrations = []*Migration{
+		{1, "create side chain tables", createTables(CreateHeightInfoTable,
+			CreateSideChainTxsTable, CreateSideChainBlocksTable)},
+	}
+)
+
 type AddressUTXO struct {
 	Input               *Input
 	Amount              *Fixed64
@@ -87,6 +132,10 @@ type DataStoreUTXO interface {
 	AddAddressUTXOs(utxos []*AddressUTXO) error
 	DeleteUTXOs(inputs []*Input) error
 	GetAddressUTXOsFromGenesisBlockAddress(genesisBlockAddress string) ([]*AddressUTXO, error)
+
+	GetBlockHash(height uint32) (string, error)
+	ApplyBlock(height uint32, blockHash string, utxos []*AddressUTXO, inputs []*Input) error
+	RollbackBlock(height uint32) error
 }
 
 type DataStoreMainChain interface {
@@ -100,6 +149,13 @@ type DataStoreMainChain interface {
 	GetAllMainChainTxHashes() ([]string, []string, error)
 	GetAllMainChainTxs() ([]*base.MainChainTransaction, error)
 	GetMainChainTxsFromHashes(transactionHashes []string, genesisBlockAddresses string) ([]*base.SpvTransaction, error)
+	RemoveMainChainTxsAboveHeight(genesisBlockAddress string, height uint32) ([]string, error)
+
+	AddProposal(proposal *base.WithdrawProposal) error
+	UpdateProposalSignatures(transactionHash string, transaction, signatures []byte) error
+	RemoveProposal(transactionHash string) error
+	GetAllProposals() ([]*base.WithdrawProposal, error)
+	RemoveProposalsBelowHeight(height uint32) ([]string, error)
 }
 
 type DataStoreSideChain interface {
@@ -114,6 +170,10 @@ type DataStoreSideChain interface {
 	GetAllSideChainTxHashesAndHeights(genesisBlockAddress string) ([]string, []uint32, error)
 	GetSideChainTxsFromHashes(transactionHashes []string) ([]*base.WithdrawTx, error)
 	GetSideChainTxsFromHashesAndGenesisAddress(transactionHashes []string, genesisBlockAddress string) ([]*base.WithdrawTx, error)
+
+	AddSideChainBlock(genesisBlockAddress string, height uint32, blockHash string) error
+	GetSideChainBlockHash(genesisBlockAddress string, height uint32) (string, error)
+	RollbackSideChain(genesisBlockAddress string, forkHeight, currentHeight uint32) ([]string, error)
 }
 
 type DataStoreImpl struct {
@@ -141,32 +201,52 @@ type DataStoreSideChainImpl struct {
 }
 
 func OpenDataStore() (*DataStoreImpl, error) {
-	dbUTXO, err := initUTXODB()
+	utxoStore, err := OpenUTXODataStore()
 	if err != nil {
 		return nil, err
 	}
-	dbMainChain, err := initMainChainDB()
+	mainChainStore, err := OpenMainChainDataStore()
 	if err != nil {
 		return nil, err
 	}
-	dbSideChain, err := initSideChainDB()
+	sideChainStore, err := OpenSideChainDataStore()
 	if err != nil {
 		return nil, err
 	}
-	dataStore := &DataStoreImpl{
-		UTXOStore:      &DataStoreUTXOImpl{mux: new(sync.Mutex), DB: dbUTXO},
-		MainChainStore: &DataStoreMainChainImpl{mux: new(sync.Mutex), DB: dbMainChain},
-		SideChainStore: &DataStoreSideChainImpl{mux: new(sync.Mutex), DB: dbSideChain}}
+	return &DataStoreImpl{
+		UTXOStore:      utxoStore,
+		MainChainStore: mainChainStore,
+		SideChainStore: sideChainStore}, nil
+}
 
-	// Handle system interrupt signals
-	dataStore.UTXOStore.catchSystemSignals()
-	dataStore.MainChainStore.catchSystemSignals()
-	dataStore.SideChainStore.catchSystemSignals()
+// OpenUTXODataStore opens the UTXO store of the backend configured.
+func OpenUTXODataStore() (DataStoreUTXO, error) {
+	backend, err := currentBackend()
+	if err != nil {
+		return nil, err
+	}
+	return backend.OpenUTXOStore()
+}
 
-	return dataStore, nil
+// OpenMainChainDataStore opens the main chain store of the backend configured.
+func OpenMainChainDataStore() (DataStoreMainChain, error) {
+	backend, err := currentBackend()
+	if err != nil {
+		return nil, err
+	}
+	return backend.OpenMainChainStore()
 }
 
-func OpenUTXODataStore() (*DataStoreUTXOImpl, error) {
+// OpenSideChainDataStore opens the side chain store of the backend configured.
+func OpenSideChainDataStore() (DataStoreSideChain, error) {
+	backend, err := currentBackend()
+	if err != nil {
+		return nil, err
+	}
+	return backend.OpenSideChainStore()
+}
+
+func openSQLiteUTXODataStore() (DataStoreUTXO, error) {
 	dbUTXO, err := initUTXODB()
 	if err != nil {
 		return nil, err
@@ -179,7 +259,7 @@ func OpenUTXODataStore() (*DataStoreUTXOImpl, error) {
 	return dataStore, nil
 }
 
-func OpenMainChainDataStore() (*DataStoreMainChainImpl, error) {
+func openSQLiteMainChainDataStore() (DataStoreMainChain, error) {
 	dbMainChain, err := initMainChainDB()
 	if err != nil {
 		return nil, err
@@ -192,7 +272,7 @@ func OpenMainChainDataStore() (*DataStoreMainChainImpl, error) {
 	return dataStore, nil
 }
 
-func OpenSideChainDataStore() (*DataStoreSideChainImpl, error) {
+func openSQLiteSideChainDataStore() (DataStoreSideChain, error) {
 	dbSideChain, err := initSideChainDB()
 	if err != nil {
 		return nil, err
@@ -219,19 +299,9 @@ func initUTXODB() (*sql.DB, error) {
 		log.Error("Open data db error:", err)
 		return nil, err
 	}
-	// Create info table
-	_, err = db.Exec(CreateInfoTable)
-	if err != nil {
-		return nil, err
-	}
-	// Create SideHeightInfo table
-	_, err = db.Exec(CreateHeightInfoTable)
-	if err != nil {
-		return nil, err
-	}
-	// Create UTXOs table
-	_, err = db.Exec(CreateUTXOsTable)
+	err = migrate(db, DBNameUTXO, utxoMigrations, defaultMigrationOptions())
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
 	stmt, err := db.Prepare("INSERT INTO Info(Name, Value) values(?,?)")
@@ -253,9 +323,9 @@ func initMainChainDB() (*sql.DB, error) {
 		log.Error("Open data db error:", err)
 		return nil, err
 	}
-	// Create MainChainTxs table
-	_, err = db.Exec(CreateMainChainTxsTable)
+	err = migrate(db, DBNameMainChain, mainChainMigrations, defaultMigrationOptions())
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
 	return db, nil
@@ -272,14 +342,9 @@ func initSideChainDB() (*sql.DB, error) {
 		log.Error("Open data db error:", err)
 		return nil, err
 	}
-	// Create SideHeightInfo table
-	_, err = db.Exec(CreateHeightInfoTable)
-	if err != nil {
-		return nil, err
-	}
-	// Create SideChainTxs table
-	_, err = db.Exec(CreateSideChainTxsTable)
+	err = migrate(db, DBNameSideChain, sideChainMigrations, defaultMigrationOptions())
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
 
@@ -440,6 +505,176 @@ func (store *DataStoreUTXOImpl) GetAddressUTXOsFromGenesisBlockAddress(genesisBl
 	return inputs, nil
 }
 
+func (store *DataStoreUTXOImpl) GetBlockHash(height uint32) (string, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	row := store.QueryRow("SELECT BlockHash FROM MainChainBlocks WHERE Height=?", height)
+	var blockHash string
+	err := row.Scan(&blockHash)
+	if err != nil {
+		return "", err
+	}
+	return blockHash, nil
+}
+
+// ApplyBlock adds and deletes the UTXOs changed by the main chain block at
+// height, records the block hash and the undo data of the block and moves
+// the stored height to height, all in one database transaction.
+func (store *DataStoreUTXOImpl) ApplyBlock(height uint32, blockHash string, utxos []*AddressUTXO, inputs []*Input) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+
+	undo := new(blockUndo)
+	for _, utxo := range utxos {
+		buf := new(bytes.Buffer)
+		utxo.Input.Serialize(buf)
+		inputBytes := buf.Bytes()
+		buf = new(bytes.Buffer)
+		utxo.Amount.Serialize(buf)
+		amountBytes := buf.Bytes()
+
+		result, err := tx.Exec("INSERT OR IGNORE INTO UTXOs(UTXOInput, Amount, GenesisBlockAddress) values(?,?,?)",
+			inputBytes, amountBytes, utxo.GenesisBlockAddress)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if count, err := result.RowsAffected(); err == nil && count > 0 {
+			undo.Added = append(undo.Added, utxo.Input)
+		}
+	}
+
+	for _, input := range inputs {
+		buf := new(bytes.Buffer)
+		input.Serialize(buf)
+		inputBytes := buf.Bytes()
+
+		var amountBytes []byte
+		var genesisBlockAddress string
+		row := tx.QueryRow("SELECT Amount, GenesisBlockAddress FROM UTXOs WHERE UTXOInput=?", inputBytes)
+		if err := row.Scan(&amountBytes, &genesisBlockAddress); err != nil {
+			if err == sql.ErrNoRows {
+				continue
+			}
+			tx.Rollback()
+			return err
+		}
+
+		var amount Fixed64
+		amount.Deserialize(bytes.NewReader(amountBytes))
+		undo.Spent = append(undo.Spent, &AddressUTXO{input, &amount, genesisBlockAddress})
+
+		if _, err := tx.Exec("DELETE FROM UTXOs WHERE UTXOInput=?", inputBytes); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := undo.Serialize(buf); err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("INSERT OR REPLACE INTO MainChainBlocks(Height, BlockHash, UndoData) values(?,?,?)",
+		height, blockHash, buf.Bytes())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Only keep undo data of the latest blocks
+	if height > MaxUndoBlocksCount {
+		_, err = tx.Exec("DELETE FROM MainChainBlocks WHERE Height<?", height-MaxUndoBlocksCount)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	_, err = tx.Exec("UPDATE Info SET Value=? WHERE Name=?", height, "Height")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RollbackBlock reverts the UTXO changes of the main chain block at height
+// by its undo data, and moves the stored height back to the previous block.
+func (store *DataStoreUTXOImpl) RollbackBlock(height uint32) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	row := store.QueryRow("SELECT UndoData FROM MainChainBlocks WHERE Height=?", height)
+	var undoBytes []byte
+	if err := row.Scan(&undoBytes); err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("no undo data of main chain block at height " + strconv.FormatUint(uint64(height), 10))
+		}
+		return err
+	}
+
+	undo := new(blockUndo)
+	if err := undo.Deserialize(bytes.NewReader(undoBytes)); err != nil {
+		return err
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+
+	// Restore spent UTXOs before deleting added ones, so an output created
+	// and spent in the same block does not come back
+	for _, utxo := range undo.Spent {
+		buf := new(bytes.Buffer)
+		utxo.Input.Serialize(buf)
+		inputBytes := buf.Bytes()
+		buf = new(bytes.Buffer)
+		utxo.Amount.Serialize(buf)
+		amountBytes := buf.Bytes()
+
+		_, err := tx.Exec("INSERT OR IGNORE INTO UTXOs(UTXOInput, Amount, GenesisBlockAddress) values(?,?,?)",
+			inputBytes, amountBytes, utxo.GenesisBlockAddress)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	for _, input := range undo.Added {
+		buf := new(bytes.Buffer)
+		input.Serialize(buf)
+		if _, err := tx.Exec("DELETE FROM UTXOs WHERE UTXOInput=?", buf.Bytes()); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM MainChainBlocks WHERE Height>=?", height); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	var previousHeight uint32
+	if height > 0 {
+		previousHeight = height - 1
+	}
+	if _, err := tx.Exec("UPDATE Info SET Value=? WHERE Name=?", previousHeight, "Height"); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
 func (store *DataStoreSideChainImpl) ResetDataStore() error {
 	store.DB.Close()
 	os.Remove(DBNameSideChain)
@@ -557,18 +792,25 @@ func (store *DataStoreSideChainImpl) RemoveSideChainTxs(transactionHashes []stri
 	if err != nil {
 		return err
 	}
-	defer tx.Commit()
+	if err := deleteSideChainTxs(tx, "main", transactionHashes); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
 
-	stmt, err := tx.Prepare("DELETE FROM SideChainTxs WHERE TransactionHash=?")
+func deleteSideChainTxs(tx *sql.Tx, schema string, transactionHashes []string) error {
+	stmt, err := tx.Prepare("DELETE FROM " + schema + ".SideChainTxs WHERE TransactionHash=?")
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
 	for _, txHash := range transactionHashes {
-		stmt.Exec(txHash)
+		if _, err := stmt.Exec(txHash); err != nil {
+			return err
+		}
 	}
-
 	return nil
 }
 
@@ -692,6 +934,104 @@ func (store *DataStoreSideChainImpl) GetSideChainTxsFromHashesAndGenesisAddress(
 	return txs, nil
 }
 
+// AddSideChainBlock records the hash of the processed side chain block at
+// height, and prunes records older than MaxSideChainBlocksCount blocks.
+func (store *DataStoreSideChainImpl) AddSideChainBlock(genesisBlockAddress string, height uint32, blockHash string) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT OR REPLACE INTO SideChainBlocks(GenesisBlockAddress, Height, BlockHash) values(?,?,?)",
+		genesisBlockAddress, height, blockHash)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if height > MaxSideChainBlocksCount {
+		_, err = tx.Exec("DELETE FROM SideChainBlocks WHERE GenesisBlockAddress=? AND Height<?",
+			genesisBlockAddress, height-MaxSideChainBlocksCount)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (store *DataStoreSideChainImpl) GetSideChainBlockHash(genesisBlockAddress string, height uint32) (string, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	row := store.QueryRow("SELECT BlockHash FROM SideChainBlocks WHERE GenesisBlockAddress=? AND Height=?",
+		genesisBlockAddress, height)
+	var blockHash string
+	err := row.Scan(&blockHash)
+	if err != nil {
+		return "", err
+	}
+	return blockHash, nil
+}
+
+// RollbackSideChain removes the block records and the withdraw transactions
+// of the side chain above forkHeight, and moves the side height back to
+// currentHeight. The hashes of the removed transactions are returned.
+func (store *DataStoreSideChainImpl) RollbackSideChain(genesisBlockAddress string, forkHeight, currentHeight uint32) ([]string, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(`SELECT TransactionHash FROM SideChainTxs WHERE GenesisBlockAddress=? AND BlockHeight>?`,
+		genesisBlockAddress, forkHeight)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	var txHashes []string
+	for rows.Next() {
+		var txHash string
+		if err := rows.Scan(&txHash); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return nil, err
+		}
+		txHashes = append(txHashes, txHash)
+	}
+	rows.Close()
+
+	_, err = tx.Exec("DELETE FROM SideChainTxs WHERE GenesisBlockAddress=? AND BlockHeight>?",
+		genesisBlockAddress, forkHeight)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	_, err = tx.Exec("DELETE FROM SideChainBlocks WHERE GenesisBlockAddress=? AND Height>?",
+		genesisBlockAddress, forkHeight)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	_, err = tx.Exec("UPDATE SideHeightInfo SET Height=? WHERE GenesisBlockAddress=?",
+		currentHeight, genesisBlockAddress)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return txHashes, tx.Commit()
+}
+
 func (store *DataStoreMainChainImpl) ResetDataStore() error {
 	store.DB.Close()
 	os.Remove(DBNameMainChain)
@@ -718,7 +1058,7 @@ func (store *DataStoreMainChainImpl) AddMainChainTx(tx *base.MainChainTransactio
 	defer store.mux.Unlock()
 
 	// Prepare sql statement
-	stmt, err := store.Prepare("INSERT INTO MainChainTxs(TransactionHash, GenesisBlockAddress, TransactionData, MerkleProof) values(?,?,?,?)")
+	stmt, err := store.Prepare("INSERT INTO MainChainTxs(TransactionHash, GenesisBlockAddress, TransactionData, MerkleProof, BlockHeight) values(?,?,?,?,?)")
 	if err != nil {
 		return err
 	}
@@ -735,7 +1075,7 @@ func (store *DataStoreMainChainImpl) AddMainChainTx(tx *base.MainChainTransactio
 	merkleProofBytes := buf.Bytes()
 
 	// Do insert
-	_, err = stmt.Exec(tx.TransactionHash, tx.GenesisBlockAddress, transactionBytes, merkleProofBytes)
+	_, err = stmt.Exec(tx.TransactionHash, tx.GenesisBlockAddress, transactionBytes, merkleProofBytes, tx.Proof.Height)
 	if err != nil {
 		return err
 	}
@@ -753,7 +1093,7 @@ func (store *DataStoreMainChainImpl) AddMainChainTxs(txs []*base.MainChainTransa
 	defer tx.Commit()
 
 	// Prepare sql statement
-	stmt, err := tx.Prepare("INSERT INTO MainChainTxs(TransactionHash, GenesisBlockAddress, TransactionData, MerkleProof) values(?,?,?,?)")
+	stmt, err := tx.Prepare("INSERT INTO MainChainTxs(TransactionHash, GenesisBlockAddress, TransactionData, MerkleProof, BlockHeight) values(?,?,?,?,?)")
 	if err != nil {
 		return nil, err
 	}
@@ -772,7 +1112,7 @@ func (store *DataStoreMainChainImpl) AddMainChainTxs(txs []*base.MainChainTransa
 		merkleProofBytes := buf.Bytes()
 
 		// Do insert
-		_, err = stmt.Exec(tx.TransactionHash, tx.GenesisBlockAddress, transactionBytes, merkleProofBytes)
+		_, err = stmt.Exec(tx.TransactionHash, tx.GenesisBlockAddress, transactionBytes, merkleProofBytes, tx.Proof.Height)
 		if err != nil {
 			result = append(result, false)
 		} else {
@@ -823,9 +1163,15 @@ func (store *DataStoreMainChainImpl) RemoveMainChainTxs(transactionHashes, genes
 	if err != nil {
 		return err
 	}
-	defer tx.Commit()
+	if err := deleteMainChainTxs(tx, "main", transactionHashes, genesisBlockAddress); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
 
-	stmt, err := tx.Prepare("DELETE FROM MainChainTxs WHERE TransactionHash=? AND GenesisBlockAddress=?")
+func deleteMainChainTxs(tx *sql.Tx, schema string, transactionHashes, genesisBlockAddress []string) error {
+	stmt, err := tx.Prepare("DELETE FROM " + schema + ".MainChainTxs WHERE TransactionHash=? AND GenesisBlockAddress=?")
 	if err != nil {
 		return err
 	}
@@ -834,10 +1180,9 @@ func (store *DataStoreMainChainImpl) RemoveMainChainTxs(transactionHashes, genes
 	for i := 0; i < len(transactionHashes); i++ {
 		_, err = stmt.Exec(transactionHashes[i], genesisBlockAddress[i])
 		if err != nil {
-			continue
+			return err
 		}
 	}
-
 	return nil
 }
 
@@ -941,6 +1286,124 @@ func (store *DataStoreMainChainImpl) GetMainChainTxsFromHashes(transactionHashes
 	return spvTxs, nil
 }
 
+func (store *DataStoreMainChainImpl) RemoveMainChainTxsAboveHeight(genesisBlockAddress string, height uint32) ([]string, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	rows, err := store.Query(`SELECT TransactionHash FROM MainChainTxs WHERE GenesisBlockAddress=? AND BlockHeight>?`,
+		genesisBlockAddress, height)
+	if err != nil {
+		return nil, err
+	}
+
+	var txHashes []string
+	for rows.Next() {
+		var txHash string
+		err = rows.Scan(&txHash)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		txHashes = append(txHashes, txHash)
+	}
+	rows.Close()
+
+	if len(txHashes) == 0 {
+		return nil, nil
+	}
+
+	_, err = store.Exec("DELETE FROM MainChainTxs WHERE GenesisBlockAddress=? AND BlockHeight>?",
+		genesisBlockAddress, height)
+	if err != nil {
+		return nil, err
+	}
+
+	return txHashes, nil
+}
+
+func (store *DataStoreMainChainImpl) AddProposal(proposal *base.WithdrawProposal) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	stmt, err := store.Prepare("INSERT INTO Proposals(TransactionHash, GenesisBlockAddress, TransactionData, RedeemScript, Signatures, CreationHeight) values(?,?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(proposal.TransactionHash, proposal.GenesisBlockAddress, proposal.Transaction,
+		proposal.RedeemScript, proposal.Signatures, proposal.CreationHeight)
+	return err
+}
+
+func (store *DataStoreMainChainImpl) UpdateProposalSignatures(transactionHash string, transaction, signatures []byte) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	_, err := store.Exec("UPDATE Proposals SET TransactionData=?, Signatures=? WHERE TransactionHash=?",
+		transaction, signatures, transactionHash)
+	return err
+}
+
+func (store *DataStoreMainChainImpl) RemoveProposal(transactionHash string) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	_, err := store.Exec("DELETE FROM Proposals WHERE TransactionHash=?", transactionHash)
+	return err
+}
+
+func (store *DataStoreMainChainImpl) GetAllProposals() ([]*base.WithdrawProposal, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	rows, err := store.Query(`SELECT TransactionHash, GenesisBlockAddress, TransactionData, RedeemScript, Signatures, CreationHeight FROM Proposals`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var proposals []*base.WithdrawProposal
+	for rows.Next() {
+		proposal := new(base.WithdrawProposal)
+		err = rows.Scan(&proposal.TransactionHash, &proposal.GenesisBlockAddress, &proposal.Transaction,
+			&proposal.RedeemScript, &proposal.Signatures, &proposal.CreationHeight)
+		if err != nil {
+			return nil, err
+		}
+		proposals = append(proposals, proposal)
+	}
+	return proposals, nil
+}
+
+// RemoveProposalsBelowHeight removes the proposals created before height and
+// returns their transaction hashes.
+func (store *DataStoreMainChainImpl) RemoveProposalsBelowHeight(height uint32) ([]string, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	rows, err := store.Query(`SELECT TransactionHash FROM Proposals WHERE CreationHeight<?`, height)
+	if err != nil {
+		return nil, err
+	}
+	var txHashes []string
+	for rows.Next() {
+		var txHash string
+		if err := rows.Scan(&txHash); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		txHashes = append(txHashes, txHash)
+	}
+	rows.Close()
+
+	_, err = store.Exec("DELETE FROM Proposals WHERE CreationHeight<?", height)
+	if err != nil {
+		return nil, err
+	}
+	return txHashes, nil
+}
+
 func CheckAndCreateDocument(path string) error {
 	exist, err := PathExists(path)
 	if err != nil {
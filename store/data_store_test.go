@@ -9,12 +9,22 @@ import (
 	"github.com/elastos/Elastos.ELA.Arbiter/config"
 
 	"github.com/elastos/Elastos.ELA.SPV/bloom"
+	"github.com/elastos/Elastos.ELA/common"
 	. "github.com/elastos/Elastos.ELA/core/types"
 )
 
 func TestMain(m *testing.M) {
 	setup()
-	os.Exit(m.Run())
+
+	// Run the same tests against each backend
+	code := 0
+	for _, backend := range Backends() {
+		config.Parameters.StoreBackend = backend
+		if result := m.Run(); result != 0 {
+			code = result
+		}
+	}
+	os.Exit(code)
 }
 
 func setup() {
@@ -498,3 +508,179 @@ func TestDataStoreImpl_GetAllMainChainTxHashes(t *testing.T) {
 
 	datastore.ResetDataStore()
 }
+
+func TestDataStoreImpl_RemoveMainChainTxsAboveHeight(t *testing.T) {
+	datastore, err := OpenMainChainDataStore()
+	if err != nil {
+		t.Error("Open database error.")
+	}
+
+	txHash1 := "testHash1"
+	txHash2 := "testHash2"
+	genesisAddress := "genesis"
+
+	tx := &Transaction{TxType: WithdrawFromSideChain, Payload: new(PayloadWithdrawFromSideChain)}
+
+	mp1 := &bloom.MerkleProof{Height: 10}
+	mp2 := &bloom.MerkleProof{Height: 20}
+	datastore.AddMainChainTx(&base.MainChainTransaction{txHash1, genesisAddress, tx, mp1})
+	datastore.AddMainChainTx(&base.MainChainTransaction{txHash2, genesisAddress, tx, mp2})
+
+	removedTxs, err := datastore.RemoveMainChainTxsAboveHeight(genesisAddress, 15)
+	if err != nil {
+		t.Error("Remove main chain txs above height error.")
+	}
+	if len(removedTxs) != 1 || removedTxs[0] != txHash2 {
+		t.Error("Remove main chain txs above height error.")
+	}
+
+	ok, err := datastore.HasMainChainTx(txHash1, genesisAddress)
+	if err != nil || !ok {
+		t.Error("Main chain tx below rollback height should be kept.")
+	}
+	ok, err = datastore.HasMainChainTx(txHash2, genesisAddress)
+	if err != nil || ok {
+		t.Error("Main chain tx above rollback height should be removed.")
+	}
+
+	datastore.ResetDataStore()
+}
+
+func TestDataStoreImpl_ApplyAndRollbackBlock(t *testing.T) {
+	datastore, err := OpenUTXODataStore()
+	if err != nil {
+		t.Error("Open database error.")
+	}
+
+	genesisAddress := "genesis"
+	amount := common.Fixed64(100)
+	input1 := &Input{Previous: OutPoint{TxID: common.Uint256{1}, Index: 0}}
+	input2 := &Input{Previous: OutPoint{TxID: common.Uint256{2}, Index: 0}}
+
+	if err := datastore.ApplyBlock(1, "blockHash1", []*AddressUTXO{
+		{input1, &amount, genesisAddress}}, nil); err != nil {
+		t.Error("Apply block error.")
+	}
+	if err := datastore.ApplyBlock(2, "blockHash2", []*AddressUTXO{
+		{input2, &amount, genesisAddress}}, []*Input{input1}); err != nil {
+		t.Error("Apply block error.")
+	}
+
+	hash, err := datastore.GetBlockHash(2)
+	if err != nil || hash != "blockHash2" {
+		t.Error("Get block hash error.")
+	}
+	utxos, err := datastore.GetAddressUTXOsFromGenesisBlockAddress(genesisAddress)
+	if err != nil || len(utxos) != 1 || !utxos[0].Input.IsEqual(*input2) {
+		t.Error("Utxos after applying blocks mismatch.")
+	}
+
+	if err := datastore.RollbackBlock(2); err != nil {
+		t.Error("Rollback block error.")
+	}
+	if datastore.CurrentHeight(QueryHeightCode) != 1 {
+		t.Error("Current height after rollback should be 1.")
+	}
+	if _, err := datastore.GetBlockHash(2); err == nil {
+		t.Error("Rolled back block hash should be removed.")
+	}
+	utxos, err = datastore.GetAddressUTXOsFromGenesisBlockAddress(genesisAddress)
+	if err != nil || len(utxos) != 1 || !utxos[0].Input.IsEqual(*input1) {
+		t.Error("Spent utxo should be restored after rollback.")
+	}
+
+	datastore.ResetDataStore()
+}
+
+func TestDataStoreImpl_RollbackSideChain(t *testing.T) {
+	datastore, err := OpenSideChainDataStore()
+	if err != nil {
+		t.Error("Open database error.")
+	}
+
+	genesisAddress := "testAddress"
+	txHash1 := "testHash1"
+	txHash2 := "testHash2"
+
+	tx := &Transaction{Payload: new(PayloadWithdrawFromSideChain)}
+	buf := new(bytes.Buffer)
+	tx.Serialize(buf)
+	datastore.AddSideChainTxs([]*base.SideChainTransaction{
+		{txHash1, genesisAddress, buf.Bytes(), 10},
+		{txHash2, genesisAddress, buf.Bytes(), 20},
+	})
+	datastore.AddSideChainBlock(genesisAddress, 10, "blockHash10")
+	datastore.AddSideChainBlock(genesisAddress, 20, "blockHash20")
+
+	hash, err := datastore.GetSideChainBlockHash(genesisAddress, 20)
+	if err != nil || hash != "blockHash20" {
+		t.Error("Get side chain block hash error.")
+	}
+
+	removedTxs, err := datastore.RollbackSideChain(genesisAddress, 15, 21)
+	if err != nil {
+		t.Error("Rollback side chain error.")
+	}
+	if len(removedTxs) != 1 || removedTxs[0] != txHash2 {
+		t.Error("Rollback side chain removed wrong transactions.")
+	}
+
+	ok, err := datastore.HasSideChainTx(txHash1)
+	if err != nil || !ok {
+		t.Error("Side chain tx below fork height should be kept.")
+	}
+	ok, err = datastore.HasSideChainTx(txHash2)
+	if err != nil || ok {
+		t.Error("Side chain tx above fork height should be removed.")
+	}
+	if _, err := datastore.GetSideChainBlockHash(genesisAddress, 20); err == nil {
+		t.Error("Side chain block above fork height should be removed.")
+	}
+
+	datastore.ResetDataStore()
+}
+
+func TestDataStoreImpl_Proposals(t *testing.T) {
+	datastore, err := OpenMainChainDataStore()
+	if err != nil {
+		t.Error("Open database error.")
+	}
+
+	proposal1 := &base.WithdrawProposal{TransactionHash: "testHash1", GenesisBlockAddress: "genesis",
+		Transaction: []byte{1}, RedeemScript: []byte{2}, Signatures: []byte{3}, CreationHeight: 10}
+	proposal2 := &base.WithdrawProposal{TransactionHash: "testHash2", GenesisBlockAddress: "genesis",
+		Transaction: []byte{1}, RedeemScript: []byte{2}, Signatures: []byte{3}, CreationHeight: 20}
+	if err := datastore.AddProposal(proposal1); err != nil {
+		t.Error("Add proposal error.")
+	}
+	if err := datastore.AddProposal(proposal2); err != nil {
+		t.Error("Add proposal error.")
+	}
+	if err := datastore.UpdateProposalSignatures("testHash2", []byte{4}, []byte{5}); err != nil {
+		t.Error("Update proposal signatures error.")
+	}
+
+	proposals, err := datastore.GetAllProposals()
+	if err != nil || len(proposals) != 2 {
+		t.Error("Get all proposals error.")
+	}
+	for _, p := range proposals {
+		if p.TransactionHash == "testHash2" && !bytes.Equal(p.Signatures, []byte{5}) {
+			t.Error("Proposal signatures should be updated.")
+		}
+	}
+
+	expired, err := datastore.RemoveProposalsBelowHeight(15)
+	if err != nil || len(expired) != 1 || expired[0] != "testHash1" {
+		t.Error("Remove proposals below height error.")
+	}
+	if err := datastore.RemoveProposal("testHash2"); err != nil {
+		t.Error("Remove proposal error.")
+	}
+	proposals, err = datastore.GetAllProposals()
+	if err != nil || len(proposals) != 0 {
+		t.Error("All proposals should be removed.")
+	}
+
+	datastore.ResetDataStore()
+}
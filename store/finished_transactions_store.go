@@ -25,6 +25,7 @@ const (
 				GenesisBlockAddress VARCHAR(34),
 				Succeed BOOLEAN,
 				RecordTime TEXT,
+				BlockHeight INTEGER,
 				UNIQUE (TransactionHash, GenesisBlockAddress)
 			);`
 	CreateWithdrawTransactionsTable = `CREATE TABLE IF NOT EXISTS WithdrawTransactions (
@@ -32,7 +33,8 @@ const (
 				TransactionHash VARCHAR UNIQUE,
 				SideChainTransactionId INTEGER,
 				Succeed BOOLEAN,
-				RecordTime TEXT
+				RecordTime TEXT,
+				FailedReason TEXT
 			);`
 	CreateSideChainTransactionsTable = `CREATE TABLE IF NOT EXISTS SideChainTransactions (
 				Id INTEGER NOT NULL PRIMARY KEY,
@@ -45,23 +47,39 @@ var (
 	FinishedTxsDbCache FinishedTransactionsDataStore
 )
 
+var finishedTxsMigrations = []*Migration{
+	{1, "create finished transactions tables", createTables(CreateDepositTransactionsTable,
+		CreateWithdrawTransactionsTable, CreateSideChainTransactionsTable)},
+	{2, "add BlockHeight to DepositTransactions", addColumn("DepositTransactions", "BlockHeight", "INTEGER")},
+	{3, "add FailedReason to WithdrawTransactions", addColumn("WithdrawTransactions", "FailedReason", "TEXT")},
+	{4, "create transfers table", createTables(CreateTransfersTable, CreateTransfersGenesisBlockAddressIndex,
+		CreateTransfersTargetAddressIndex, CreateTransfersMainChainTxHashIndex, CreateTransfersSideChainTxHashIndex,
+		CreateTransfersRecordTimeIndex)},
+}
+
 type FinishedTransactionsDataStore interface {
-	AddFailedDepositTxs(transactionHashes, genesisBlockAddresses []string) error
-	AddSucceedDepositTxs(transactionHashes, genesisBlockAddresses []string) error
+	AddFailedDepositTxs(transactionHashes, genesisBlockAddresses []string, blockHeights []uint32) error
+	AddSucceedDepositTxs(transactionHashes, genesisBlockAddresses []string, blockHeights []uint32) error
 	HasDepositTx(transactionHash string, genesisBlockAddress string) (bool, error)
 	GetDepositTxByHash(transactionHash string) ([]bool, []string, error)
 	GetDepositTxByHashAndGenesisAddress(transactionHash string, genesisAddress string) (bool, error)
 	GetDepositTxs(succeed bool) ([]string, []string, error)
+	RemoveDepositTxsAboveHeight(genesisBlockAddress string, height uint32) ([]string, []bool, error)
 
-	AddFailedWithdrawTxs(transactionHashes []string, transactionByte []byte) error
+	AddFailedWithdrawTxs(transactionHashes []string, transactionByte []byte, reason string) error
 	AddSucceedWithdrawTxs(transactionHashes []string) error
 	HasWithdrawTx(transactionHash string) (bool, error)
 	GetWithdrawTxByHash(transactionHash string) (bool, []byte, error)
 	GetWithdrawTxs(succeed bool) ([]string, error)
+	GetFailedWithdrawTxReasons() ([]string, []string, error)
 
 	AddSideChainTx(transactionByte []byte) error
 	GetSideChainTx(sideChainTransactionId uint64) ([]byte, error)
 
+	QueryTransfers(filter *TransferFilter) ([]*Transfer, uint64, error)
+
+	Prune(policy *RetentionPolicy, archive func(records []*PrunedRecord) error) error
+
 	ResetDataStore() error
 }
 
@@ -71,7 +89,17 @@ type FinishedTxsDataStoreImpl struct {
 	*sql.DB
 }
 
+// OpenFinishedTxsDataStore opens the finished transactions store of the
+// backend configured.
 func OpenFinishedTxsDataStore() (FinishedTransactionsDataStore, error) {
+	backend, err := currentBackend()
+	if err != nil {
+		return nil, err
+	}
+	return backend.OpenFinishedTxsStore()
+}
+
+func openSQLiteFinishedTxsDataStore() (FinishedTransactionsDataStore, error) {
 	db, err := initFinishedTxsDB()
 	if err != nil {
 		return nil, err
@@ -95,19 +123,9 @@ func initFinishedTxsDB() (*sql.DB, error) {
 		log.Error("Open data db error:", err)
 		return nil, err
 	}
-	// Create error deposit transactions table
-	_, err = db.Exec(CreateDepositTransactionsTable)
-	if err != nil {
-		return nil, err
-	}
-	// Create error withdraw transactions table
-	_, err = db.Exec(CreateWithdrawTransactionsTable)
-	if err != nil {
-		return nil, err
-	}
-	// Create error side chain transactions table
-	_, err = db.Exec(CreateSideChainTransactionsTable)
+	err = migrate(db, FinishedTxsDBName, finishedTxsMigrations, defaultMigrationOptions())
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
 
@@ -136,7 +154,7 @@ func (store *FinishedTxsDataStoreImpl) ResetDataStore() error {
 	return nil
 }
 
-func (store *FinishedTxsDataStoreImpl) AddFailedDepositTxs(transactionHashes, genesisBlockAddresses []string) error {
+func (store *FinishedTxsDataStoreImpl) AddFailedDepositTxs(transactionHashes, genesisBlockAddresses []string, blockHeights []uint32) error {
 	store.mux.Lock()
 	defer store.mux.Unlock()
 
@@ -144,26 +162,14 @@ func (store *FinishedTxsDataStoreImpl) AddFailedDepositTxs(transactionHashes, ge
 	if err != nil {
 		return err
 	}
-	defer tx.Commit()
-
-	// Prepare sql statement
-	stmt, err := tx.Prepare("INSERT INTO DepositTransactions(TransactionHash, GenesisBlockAddress, Succeed, RecordTime) values(?,?,?,?)")
-	if err != nil {
+	if err := insertDepositTxs(tx, "main", transactionHashes, genesisBlockAddresses, blockHeights, false); err != nil {
+		tx.Rollback()
 		return err
 	}
-	defer stmt.Close()
-
-	// Do insert
-	for i := 0; i < len(transactionHashes); i++ {
-		_, err = stmt.Exec(transactionHashes[i], genesisBlockAddresses[i], false, time.Now().Format("2006-01-02_15.04.05"))
-		if err != nil {
-			continue
-		}
-	}
-	return nil
+	return tx.Commit()
 }
 
-func (store *FinishedTxsDataStoreImpl) AddSucceedDepositTxs(transactionHashes, genesisBlockAddresses []string) error {
+func (store *FinishedTxsDataStoreImpl) AddSucceedDepositTxs(transactionHashes, genesisBlockAddresses []string, blockHeights []uint32) error {
 	store.mux.Lock()
 	defer store.mux.Unlock()
 
@@ -171,20 +177,28 @@ func (store *FinishedTxsDataStoreImpl) AddSucceedDepositTxs(transactionHashes, g
 	if err != nil {
 		return err
 	}
-	defer tx.Commit()
+	if err := insertDepositTxs(tx, "main", transactionHashes, genesisBlockAddresses, blockHeights, true); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
 
-	// Prepare sql statement
-	stmt, err := tx.Prepare("INSERT INTO DepositTransactions(TransactionHash, GenesisBlockAddress, Succeed, RecordTime) values(?,?,?,?)")
+// insertDepositTxs records the deposit transactions into DepositTransactions
+// table of the schema, transactions already recorded are ignored.
+func insertDepositTxs(tx *sql.Tx, schema string, transactionHashes, genesisBlockAddresses []string,
+	blockHeights []uint32, succeed bool) error {
+
+	stmt, err := tx.Prepare("INSERT OR IGNORE INTO " + schema + ".DepositTransactions(TransactionHash, GenesisBlockAddress, Succeed, RecordTime, BlockHeight) values(?,?,?,?,?)")
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	// Do insert
 	for i := 0; i < len(transactionHashes); i++ {
-		_, err = stmt.Exec(transactionHashes[i], genesisBlockAddresses[i], true, time.Now().Format("2006-01-02_15.04.05"))
+		_, err = stmt.Exec(transactionHashes[i], genesisBlockAddresses[i], succeed, time.Now().Format(recordTimeFormat), blockHeights[i])
 		if err != nil {
-			continue
+			return err
 		}
 	}
 	return nil
@@ -277,46 +291,69 @@ func (store *FinishedTxsDataStoreImpl) GetDepositTxs(succeed bool) ([]string, []
 	return txHashes, genesisAddresses, nil
 }
 
-func (store *FinishedTxsDataStoreImpl) AddFailedWithdrawTxs(transactionHashes []string, transactionByte []byte) error {
+func (store *FinishedTxsDataStoreImpl) RemoveDepositTxsAboveHeight(genesisBlockAddress string, height uint32) ([]string, []bool, error) {
 	store.mux.Lock()
 	defer store.mux.Unlock()
 
-	// Do insert
-	_, err := store.Exec("INSERT INTO SideChainTransactions(TransactionData, RecordTime) values(?,?)",
-		transactionByte, time.Now().Format("2006-01-02_15.04.05"))
+	rows, err := store.Query(`SELECT TransactionHash, Succeed FROM DepositTransactions WHERE GenesisBlockAddress=? AND BlockHeight>?`,
+		genesisBlockAddress, height)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	// Get id
-	var sideChainTransactionId int
-	row := store.QueryRow(`SELECT MAX(Id) FROM SideChainTransactions`)
-	err = row.Scan(&sideChainTransactionId)
-	if err != nil {
-		return err
+	var txHashes []string
+	var succeed []bool
+	for rows.Next() {
+		var hash string
+		var suc bool
+		err = rows.Scan(&hash, &suc)
+		if err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+
+		txHashes = append(txHashes, hash)
+		succeed = append(succeed, suc)
+	}
+	rows.Close()
+
+	if len(txHashes) == 0 {
+		return nil, nil, nil
 	}
 
 	tx, err := store.Begin()
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+	_, err = tx.Exec("DELETE FROM DepositTransactions WHERE GenesisBlockAddress=? AND BlockHeight>?",
+		genesisBlockAddress, height)
+	if err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+	_, err = tx.Exec("DELETE FROM Transfers WHERE Type=? AND GenesisBlockAddress=? AND BlockHeight>?",
+		DepositTransfer, genesisBlockAddress, height)
+	if err != nil {
+		tx.Rollback()
+		return nil, nil, err
 	}
-	defer tx.Commit()
 
-	// Prepare sql statement
-	stmt2, err := tx.Prepare("INSERT INTO WithdrawTransactions(TransactionHash, SideChainTransactionId, Succeed, RecordTime) values(?,?,?,?)")
+	return txHashes, succeed, tx.Commit()
+}
+
+func (store *FinishedTxsDataStoreImpl) AddFailedWithdrawTxs(transactionHashes []string, transactionByte []byte, reason string) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	tx, err := store.Begin()
 	if err != nil {
 		return err
 	}
-	defer stmt2.Close()
-
-	// Do insert
-	for _, txHash := range transactionHashes {
-		_, err = stmt2.Exec(txHash, sideChainTransactionId, false, time.Now().Format("2006-01-02_15.04.05"))
-		if err != nil {
-			continue
-		}
+	if err := insertWithdrawTxs(tx, "main", transactionHashes, transactionByte, false, reason); err != nil {
+		tx.Rollback()
+		return err
 	}
-	return nil
+	return tx.Commit()
 }
 
 func (store *FinishedTxsDataStoreImpl) AddSucceedWithdrawTxs(transactionHashes []string) error {
@@ -327,19 +364,55 @@ func (store *FinishedTxsDataStoreImpl) AddSucceedWithdrawTxs(transactionHashes [
 	if err != nil {
 		return err
 	}
-	defer tx.Commit()
+	if err := insertWithdrawTxs(tx, "main", transactionHashes, nil, true, ""); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
 
-	// Prepare sql statement
-	stmt, err := tx.Prepare("INSERT INTO WithdrawTransactions(TransactionHash, SideChainTransactionId, Succeed, RecordTime) values(?,?,?,?)")
+// insertWithdrawTxs records the withdraw transactions into WithdrawTransactions
+// table of the schema, the main chain transaction of failed withdraws is kept
+// in SideChainTransactions table. Transactions already recorded are ignored.
+func insertWithdrawTxs(tx *sql.Tx, schema string, transactionHashes []string, transactionByte []byte,
+	succeed bool, reason string) error {
+
+	recordTime := time.Now().Format(recordTimeFormat)
+	if succeed {
+		stmt, err := tx.Prepare("INSERT OR IGNORE INTO " + schema + ".WithdrawTransactions(TransactionHash, SideChainTransactionId, Succeed, RecordTime) values(?,?,?,?)")
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, txHash := range transactionHashes {
+			if _, err := stmt.Exec(txHash, 0, true, recordTime); err != nil {
+				log.Error("[insertWithdrawTxs] txHash:", txHash, "err:", err.Error())
+				return err
+			}
+		}
+		return nil
+	}
+
+	result, err := tx.Exec("INSERT INTO "+schema+".SideChainTransactions(TransactionData, RecordTime) values(?,?)",
+		transactionByte, recordTime)
+	if err != nil {
+		return err
+	}
+	sideChainTransactionId, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare("INSERT OR IGNORE INTO " + schema + ".WithdrawTransactions(TransactionHash, SideChainTransactionId, Succeed, RecordTime, FailedReason) values(?,?,?,?,?)")
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	// Do insert
 	for _, txHash := range transactionHashes {
-		if _, err := stmt.Exec(txHash, 0, true, time.Now().Format("2006-01-02_15.04.05")); err != nil {
-			log.Error("[AddSucceedWithdrawTxs] txHash:", txHash, "err:", err.Error())
+		if _, err := stmt.Exec(txHash, sideChainTransactionId, false, recordTime, reason); err != nil {
+			return err
 		}
 	}
 	return nil
@@ -423,6 +496,33 @@ func (store *FinishedTxsDataStoreImpl) GetWithdrawTxs(succeed bool) ([]string, e
 	return txHashes, nil
 }
 
+func (store *FinishedTxsDataStoreImpl) GetFailedWithdrawTxReasons() ([]string, []string, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	rows, err := store.Query(`SELECT TransactionHash, FailedReason FROM WithdrawTransactions WHERE Succeed=?`, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var txHashes []string
+	var reasons []string
+	for rows.Next() {
+		var hash string
+		var reason sql.NullString
+		err = rows.Scan(&hash, &reason)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		txHashes = append(txHashes, hash)
+		reasons = append(reasons, reason.String)
+	}
+
+	return txHashes, reasons, nil
+}
+
 func (store *FinishedTxsDataStoreImpl) AddSideChainTx(transactionByte []byte) error {
 	store.mux.Lock()
 	defer store.mux.Unlock()
@@ -434,7 +534,7 @@ func (store *FinishedTxsDataStoreImpl) AddSideChainTx(transactionByte []byte) er
 	}
 
 	// Do insert
-	_, err = stmt.Exec(transactionByte, time.Now().Format("2006-01-02_15.04.05"))
+	_, err = stmt.Exec(transactionByte, time.Now().Format(recordTimeFormat))
 	if err != nil {
 		return err
 	}
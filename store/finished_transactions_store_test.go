@@ -19,7 +19,8 @@ func TestFinishedTxsDataStoreImpl_AddSucceedDepositTxs(t *testing.T) {
 
 	err = datastore.AddSucceedDepositTxs(
 		[]string{txHash, txHash},
-		[]string{genesisBlockAddress1, genesisBlockAddress2})
+		[]string{genesisBlockAddress1, genesisBlockAddress2},
+		[]uint32{10, 10})
 	if err != nil {
 		t.Error("Add deposit transaction error.")
 	}
@@ -69,7 +70,8 @@ func TestFinishedTxsDataStoreImpl_AddSucceedDepositTx(t *testing.T) {
 
 	err = datastore.AddSucceedDepositTxs(
 		[]string{txHash, txHash},
-		[]string{genesisBlockAddress1, genesisBlockAddress2})
+		[]string{genesisBlockAddress1, genesisBlockAddress2},
+		[]uint32{10, 10})
 	if err != nil {
 		t.Error("Add deposit transaction error.")
 	}
@@ -106,6 +108,50 @@ func TestFinishedTxsDataStoreImpl_AddSucceedDepositTx(t *testing.T) {
 	datastore.ResetDataStore()
 }
 
+func TestFinishedTxsDataStoreImpl_RemoveDepositTxsAboveHeight(t *testing.T) {
+	datastore, err := OpenFinishedTxsDataStore()
+	if err != nil {
+		t.Error("Open database error.")
+	}
+
+	txHash1 := "testHash1"
+	txHash2 := "testHash2"
+	txHash3 := "testHash3"
+	genesisBlockAddress1 := "testAddress1"
+	genesisBlockAddress2 := "testAddress2"
+
+	err = datastore.AddSucceedDepositTxs(
+		[]string{txHash1, txHash2, txHash3},
+		[]string{genesisBlockAddress1, genesisBlockAddress1, genesisBlockAddress2},
+		[]uint32{10, 20, 20})
+	if err != nil {
+		t.Error("Add deposit transaction error.")
+	}
+
+	removedTxs, succeed, err := datastore.RemoveDepositTxsAboveHeight(genesisBlockAddress1, 15)
+	if err != nil {
+		t.Error("Remove deposit transactions above height error.")
+	}
+	if len(removedTxs) != 1 || removedTxs[0] != txHash2 || len(succeed) != 1 || !succeed[0] {
+		t.Error("Remove deposit transactions above height error.")
+	}
+
+	ok, err := datastore.HasDepositTx(txHash1, genesisBlockAddress1)
+	if err != nil || !ok {
+		t.Error("Deposit transaction below rollback height should be kept.")
+	}
+	ok, err = datastore.HasDepositTx(txHash2, genesisBlockAddress1)
+	if err != nil || ok {
+		t.Error("Deposit transaction above rollback height should be removed.")
+	}
+	ok, err = datastore.HasDepositTx(txHash3, genesisBlockAddress2)
+	if err != nil || !ok {
+		t.Error("Deposit transaction of other genesis address should be kept.")
+	}
+
+	datastore.ResetDataStore()
+}
+
 func TestFinishedTxsDataStoreImpl_GetDepositTxs(t *testing.T) {
 	datastore, err := OpenFinishedTxsDataStore()
 	if err != nil {
@@ -119,14 +165,16 @@ func TestFinishedTxsDataStoreImpl_GetDepositTxs(t *testing.T) {
 
 	err = datastore.AddFailedDepositTxs(
 		[]string{txHash1, txHash1},
-		[]string{genesisBlockAddress1, genesisBlockAddress2})
+		[]string{genesisBlockAddress1, genesisBlockAddress2},
+		[]uint32{10, 10})
 	if err != nil {
 		t.Error("Add deposit transaction error.")
 	}
 
 	err = datastore.AddSucceedDepositTxs(
 		[]string{txHash2},
-		[]string{genesisBlockAddress2})
+		[]string{genesisBlockAddress2},
+		[]uint32{10})
 	if err != nil {
 		t.Error("Add deposit transaction error.")
 	}
@@ -162,7 +210,7 @@ func TestFinishedTxsDataStoreImpl_AddWithdrawTxs(t *testing.T) {
 	buf2 := new(bytes.Buffer)
 	tx2.Serialize(buf2)
 
-	err = datastore.AddFailedWithdrawTxs([]string{txHash1, txHash2}, buf1.Bytes())
+	err = datastore.AddFailedWithdrawTxs([]string{txHash1, txHash2}, buf1.Bytes(), "test reason")
 	if err != nil {
 		t.Error("Add withdraw transaction error.")
 	}
@@ -309,7 +357,7 @@ func TestFinishedTxsDataStoreImpl_GetWithdrawTxs(t *testing.T) {
 	buf2 := new(bytes.Buffer)
 	tx2.Serialize(buf2)
 
-	err = datastore.AddFailedWithdrawTxs([]string{txHash1, txHash2}, buf1.Bytes())
+	err = datastore.AddFailedWithdrawTxs([]string{txHash1, txHash2}, buf1.Bytes(), "test reason")
 	if err != nil {
 		t.Error("Add withdraw transaction error.")
 	}
@@ -331,3 +379,42 @@ func TestFinishedTxsDataStoreImpl_GetWithdrawTxs(t *testing.T) {
 
 	datastore.ResetDataStore()
 }
+
+func TestFinishedTxsDataStoreImpl_GetFailedWithdrawTxReasons(t *testing.T) {
+	datastore, err := OpenFinishedTxsDataStore()
+	if err != nil {
+		t.Error("Open database error.")
+	}
+
+	txHash1 := "testHash1"
+	txHash2 := "testHash2"
+	txHash3 := "testHash3"
+
+	err = datastore.AddFailedWithdrawTxs([]string{txHash1}, nil, "insufficient fee")
+	if err != nil {
+		t.Error("Add withdraw transaction error.")
+	}
+
+	err = datastore.AddFailedWithdrawTxs([]string{txHash2}, nil, "send withdraw transaction failed")
+	if err != nil {
+		t.Error("Add withdraw transaction error.")
+	}
+
+	err = datastore.AddSucceedWithdrawTxs([]string{txHash3})
+	if err != nil {
+		t.Error("Add withdraw transaction error.")
+	}
+
+	txHashes, reasons, err := datastore.GetFailedWithdrawTxReasons()
+	if err != nil || len(txHashes) != 2 || len(reasons) != 2 {
+		t.Error("Get failed withdraw transaction reasons error.")
+	}
+	for i, hash := range txHashes {
+		if hash == txHash1 && reasons[i] != "insufficient fee" ||
+			hash == txHash2 && reasons[i] != "send withdraw transaction failed" {
+			t.Error("Get failed withdraw transaction reasons error.")
+		}
+	}
+
+	datastore.ResetDataStore()
+}
@@ -0,0 +1,950 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	. "github.com/elastos/Elastos.ELA/common"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+var (
+	finishedTxsPrefix         = []byte("finished/")
+	finishedTxsLastIdKey      = []byte("finished/id")
+	finishedTxsDepositPrefix  = []byte("finished/d/") // hash, genesis address -> succeed, record time, height
+	finishedTxsWithdrawPrefix = []byte("finished/w/") // hash -> succeed, side chain transaction id, record time, reason
+	finishedTxsSideTxPrefix   = []byte("finished/s/") // side chain transaction id -> transaction, record time
+
+	transfersLastIdKey     = []byte("finished/tid")
+	transfersPrefix        = []byte("finished/t/")  // id -> transfer
+	transfersUniquePrefix  = []byte("finished/tu/") // type, hash, genesis address, output index -> id
+	transfersGenesisPrefix = []byte("finished/tg/") // genesis address, id
+	transfersAddressPrefix = []byte("finished/ta/") // target address, id
+	transfersTxHashPrefix  = []byte("finished/th/") // main or side chain transaction hash, id
+)
+
+type levelDBFinishedTxsStore struct {
+	*levelDB
+}
+
+type levelDBDepositTx struct {
+	succeed     bool
+	recordTime  string
+	blockHeight uint32
+}
+
+type levelDBWithdrawTx struct {
+	succeed                bool
+	sideChainTransactionId uint64
+	recordTime             string
+	failedReason           string
+}
+
+func depositTxKey(transactionHash, genesisBlockAddress string) []byte {
+	return makeKey(finishedTxsDepositPrefix, []byte(transactionHash), []byte(genesisBlockAddress))
+}
+
+func sideChainTransactionKey(id uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], id)
+	return makeKey(finishedTxsSideTxPrefix, buf[:])
+}
+
+func writeBool(buf *bytes.Buffer, value bool) {
+	if value {
+		buf.WriteByte(1)
+	} else {
+		buf.WriteByte(0)
+	}
+}
+
+func (tx *levelDBDepositTx) serialize() []byte {
+	buf := new(bytes.Buffer)
+	writeBool(buf, tx.succeed)
+	WriteVarString(buf, tx.recordTime)
+	WriteUint32(buf, tx.blockHeight)
+	return buf.Bytes()
+}
+
+func deserializeDepositTx(value []byte) (*levelDBDepositTx, error) {
+	r := bytes.NewReader(value)
+	succeed, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	tx := &levelDBDepositTx{succeed: succeed != 0}
+	if tx.recordTime, err = ReadVarString(r); err != nil {
+		return nil, err
+	}
+	if tx.blockHeight, err = ReadUint32(r); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (tx *levelDBWithdrawTx) serialize() []byte {
+	buf := new(bytes.Buffer)
+	writeBool(buf, tx.succeed)
+	WriteUint64(buf, tx.sideChainTransactionId)
+	WriteVarString(buf, tx.recordTime)
+	WriteVarString(buf, tx.failedReason)
+	return buf.Bytes()
+}
+
+func deserializeWithdrawTxRecord(value []byte) (*levelDBWithdrawTx, error) {
+	r := bytes.NewReader(value)
+	succeed, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	tx := &levelDBWithdrawTx{succeed: succeed != 0}
+	if tx.sideChainTransactionId, err = ReadUint64(r); err != nil {
+		return nil, err
+	}
+	if tx.recordTime, err = ReadVarString(r); err != nil {
+		return nil, err
+	}
+	if tx.failedReason, err = ReadVarString(r); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (store *levelDBFinishedTxsStore) ResetDataStore() error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	return store.reset(finishedTxsPrefix)
+}
+
+func (store *levelDBFinishedTxsStore) AddFailedDepositTxs(transactionHashes, genesisBlockAddresses []string, blockHeights []uint32) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	batch := new(leveldb.Batch)
+	if err := putLevelDBDepositTxs(store.levelDB, batch, transactionHashes, genesisBlockAddresses, blockHeights, false); err != nil {
+		return err
+	}
+	return store.Write(batch, nil)
+}
+
+func (store *levelDBFinishedTxsStore) AddSucceedDepositTxs(transactionHashes, genesisBlockAddresses []string, blockHeights []uint32) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	batch := new(leveldb.Batch)
+	if err := putLevelDBDepositTxs(store.levelDB, batch, transactionHashes, genesisBlockAddresses, blockHeights, true); err != nil {
+		return err
+	}
+	return store.Write(batch, nil)
+}
+
+// putLevelDBDepositTxs adds the deposit transactions to batch, transactions
+// already recorded are ignored.
+func putLevelDBDepositTxs(db *levelDB, batch *leveldb.Batch, transactionHashes, genesisBlockAddresses []string,
+	blockHeights []uint32, succeed bool) error {
+
+	recordTime := time.Now().Format(recordTimeFormat)
+	added := make(map[string]bool)
+	for i := 0; i < len(transactionHashes); i++ {
+		key := depositTxKey(transactionHashes[i], genesisBlockAddresses[i])
+		exist, err := db.Has(key, nil)
+		if err != nil {
+			return err
+		}
+		if exist || added[string(key)] {
+			continue
+		}
+		added[string(key)] = true
+		tx := &levelDBDepositTx{succeed: succeed, recordTime: recordTime, blockHeight: blockHeights[i]}
+		batch.Put(key, tx.serialize())
+	}
+	return nil
+}
+
+func (store *levelDBFinishedTxsStore) HasDepositTx(transactionHash string, genesisBlockAddress string) (bool, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	return store.Has(depositTxKey(transactionHash, genesisBlockAddress), nil)
+}
+
+func (store *levelDBFinishedTxsStore) GetDepositTxByHash(transactionHash string) ([]bool, []string, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	var succeed []bool
+	var genesisAddresses []string
+	err := store.forEach(makeKey(finishedTxsDepositPrefix, []byte(transactionHash), nil), func(key, value []byte) error {
+		tx, err := deserializeDepositTx(value)
+		if err != nil {
+			return err
+		}
+		succeed = append(succeed, tx.succeed)
+		genesisAddresses = append(genesisAddresses, string(key))
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return succeed, genesisAddresses, nil
+}
+
+func (store *levelDBFinishedTxsStore) GetDepositTxByHashAndGenesisAddress(transactionHash string, genesisAddress string) (bool, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	value, err := store.Get(depositTxKey(transactionHash, genesisAddress), nil)
+	if err == leveldb.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	tx, err := deserializeDepositTx(value)
+	if err != nil {
+		return false, err
+	}
+	return tx.succeed, nil
+}
+
+func (store *levelDBFinishedTxsStore) GetDepositTxs(succeed bool) ([]string, []string, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	var txHashes []string
+	var genesisAddresses []string
+	err := store.forEach(finishedTxsDepositPrefix, func(key, value []byte) error {
+		tx, err := deserializeDepositTx(value)
+		if err != nil {
+			return err
+		}
+		if tx.succeed == succeed {
+			hash, address := splitKey(key)
+			txHashes = append(txHashes, hash)
+			genesisAddresses = append(genesisAddresses, string(address))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return txHashes, genesisAddresses, nil
+}
+
+func (store *levelDBFinishedTxsStore) RemoveDepositTxsAboveHeight(genesisBlockAddress string, height uint32) ([]string, []bool, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	batch := new(leveldb.Batch)
+	var txHashes []string
+	var succeed []bool
+	err := store.forEach(finishedTxsDepositPrefix, func(key, value []byte) error {
+		hash, address := splitKey(key)
+		if string(address) != genesisBlockAddress {
+			return nil
+		}
+		tx, err := deserializeDepositTx(value)
+		if err != nil {
+			return err
+		}
+		if tx.blockHeight > height {
+			txHashes = append(txHashes, hash)
+			succeed = append(succeed, tx.succeed)
+			batch.Delete(depositTxKey(hash, genesisBlockAddress))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(txHashes) == 0 {
+		return nil, nil, nil
+	}
+
+	err = store.forEach(makeKey(transfersGenesisPrefix, []byte(genesisBlockAddress), nil), func(key, value []byte) error {
+		transfer, err := store.getTransfer(binary.BigEndian.Uint64(key))
+		if err != nil {
+			return err
+		}
+		if transfer.Type == DepositTransfer && transfer.BlockHeight > height {
+			deleteLevelDBTransfer(batch, transfer)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := store.Write(batch, nil); err != nil {
+		return nil, nil, err
+	}
+	return txHashes, succeed, nil
+}
+
+func (store *levelDBFinishedTxsStore) AddFailedWithdrawTxs(transactionHashes []string, transactionByte []byte, reason string) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	batch := new(leveldb.Batch)
+	if err := putLevelDBWithdrawTxs(store.levelDB, batch, transactionHashes, transactionByte, false, reason); err != nil {
+		return err
+	}
+	return store.Write(batch, nil)
+}
+
+func (store *levelDBFinishedTxsStore) AddSucceedWithdrawTxs(transactionHashes []string) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	batch := new(leveldb.Batch)
+	if err := putLevelDBWithdrawTxs(store.levelDB, batch, transactionHashes, nil, true, ""); err != nil {
+		return err
+	}
+	return store.Write(batch, nil)
+}
+
+// putLevelDBWithdrawTxs adds the withdraw transactions to batch, the main chain
+// transaction of failed withdraws is kept as a side chain transaction record.
+// Transactions already recorded are ignored.
+func putLevelDBWithdrawTxs(db *levelDB, batch *leveldb.Batch, transactionHashes []string, transactionByte []byte,
+	succeed bool, reason string) error {
+
+	recordTime := time.Now().Format(recordTimeFormat)
+	var sideChainTransactionId uint64
+	if !succeed {
+		id, err := putLevelDBSideChainTx(db, batch, transactionByte, recordTime)
+		if err != nil {
+			return err
+		}
+		sideChainTransactionId = id
+	}
+
+	added := make(map[string]bool)
+	for _, txHash := range transactionHashes {
+		key := makeKey(finishedTxsWithdrawPrefix, []byte(txHash))
+		exist, err := db.Has(key, nil)
+		if err != nil {
+			return err
+		}
+		if exist || added[txHash] {
+			continue
+		}
+		added[txHash] = true
+		tx := &levelDBWithdrawTx{
+			succeed:                succeed,
+			sideChainTransactionId: sideChainTransactionId,
+			recordTime:             recordTime,
+			failedReason:           reason,
+		}
+		batch.Put(key, tx.serialize())
+	}
+	return nil
+}
+
+// putLevelDBSideChainTx adds the transaction to batch with the next id, ids
+// start from 1 like the sqlite store.
+func putLevelDBSideChainTx(db *levelDB, batch *leveldb.Batch, transactionByte []byte, recordTime string) (uint64, error) {
+	var lastId uint64
+	value, err := db.Get(finishedTxsLastIdKey, nil)
+	if err == nil && len(value) == 8 {
+		lastId = binary.BigEndian.Uint64(value)
+	} else if err != nil && err != leveldb.ErrNotFound {
+		return 0, err
+	}
+
+	id := lastId + 1
+	buf := new(bytes.Buffer)
+	WriteVarBytes(buf, transactionByte)
+	WriteVarString(buf, recordTime)
+	batch.Put(sideChainTransactionKey(id), buf.Bytes())
+
+	var idBytes [8]byte
+	binary.BigEndian.PutUint64(idBytes[:], id)
+	batch.Put(finishedTxsLastIdKey, idBytes[:])
+	return id, nil
+}
+
+func (store *levelDBFinishedTxsStore) getWithdrawTx(transactionHash string) (*levelDBWithdrawTx, bool, error) {
+	value, err := store.Get(makeKey(finishedTxsWithdrawPrefix, []byte(transactionHash)), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	tx, err := deserializeWithdrawTxRecord(value)
+	if err != nil {
+		return nil, false, err
+	}
+	return tx, true, nil
+}
+
+func (store *levelDBFinishedTxsStore) getSideChainTx(id uint64) ([]byte, error) {
+	value, err := store.Get(sideChainTransactionKey(id), nil)
+	if err != nil {
+		return nil, err
+	}
+	return ReadVarBytes(bytes.NewReader(value), math.MaxUint32, "transaction")
+}
+
+func (store *levelDBFinishedTxsStore) HasWithdrawTx(transactionHash string) (bool, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	return store.Has(makeKey(finishedTxsWithdrawPrefix, []byte(transactionHash)), nil)
+}
+
+func (store *levelDBFinishedTxsStore) GetWithdrawTxByHash(transactionHash string) (bool, []byte, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	tx, exist, err := store.getWithdrawTx(transactionHash)
+	if err != nil {
+		return false, nil, err
+	}
+	if !exist {
+		return false, nil, errors.New("get withdraw transaction by hash failed")
+	}
+	if tx.succeed {
+		return true, nil, nil
+	}
+
+	transactionBytes, err := store.getSideChainTx(tx.sideChainTransactionId)
+	if err == leveldb.ErrNotFound {
+		return false, nil, errors.New("get withdraw transaction by hash failed, no side chain transaction record of needed id")
+	}
+	if err != nil {
+		return false, nil, err
+	}
+	return false, transactionBytes, nil
+}
+
+func (store *levelDBFinishedTxsStore) GetWithdrawTxs(succeed bool) ([]string, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	var txHashes []string
+	err := store.forEach(finishedTxsWithdrawPrefix, func(key, value []byte) error {
+		tx, err := deserializeWithdrawTxRecord(value)
+		if err != nil {
+			return err
+		}
+		if tx.succeed == succeed {
+			txHashes = append(txHashes, string(key))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return txHashes, nil
+}
+
+func (store *levelDBFinishedTxsStore) GetFailedWithdrawTxReasons() ([]string, []string, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	var txHashes []string
+	var reasons []string
+	err := store.forEach(finishedTxsWithdrawPrefix, func(key, value []byte) error {
+		tx, err := deserializeWithdrawTxRecord(value)
+		if err != nil {
+			return err
+		}
+		if !tx.succeed {
+			txHashes = append(txHashes, string(key))
+			reasons = append(reasons, tx.failedReason)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return txHashes, reasons, nil
+}
+
+func (store *levelDBFinishedTxsStore) AddSideChainTx(transactionByte []byte) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	batch := new(leveldb.Batch)
+	recordTime := time.Now().Format(recordTimeFormat)
+	if _, err := putLevelDBSideChainTx(store.levelDB, batch, transactionByte, recordTime); err != nil {
+		return err
+	}
+	return store.Write(batch, nil)
+}
+
+func (store *levelDBFinishedTxsStore) GetSideChainTx(sideChainTransactionId uint64) ([]byte, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	return store.getSideChainTx(sideChainTransactionId)
+}
+
+// Prune deletes the records selected by the policy in one batch, archive is
+// called with the records before they are deleted, and nothing is deleted if
+// it fails. Records are ordered by record time for MaxCount, side chain
+// transactions are pruned together with the last failed withdraw referring to
+// them.
+func (store *levelDBFinishedTxsStore) Prune(policy *RetentionPolicy, archive func(records []*PrunedRecord) error) error {
+	if !policy.Enabled() {
+		return nil
+	}
+
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	expiry := time.Now().Add(-policy.MaxAge)
+	expiryTime := expiry.Format(recordTimeFormat)
+	batch := new(leveldb.Batch)
+	var records []*PrunedRecord
+
+	var deposits []*PrunedRecord
+	err := store.forEach(finishedTxsDepositPrefix, func(key, value []byte) error {
+		tx, err := deserializeDepositTx(value)
+		if err != nil {
+			return err
+		}
+		hash, address := splitKey(key)
+		deposits = append(deposits, &PrunedRecord{
+			Table:               DepositTransactionsTable,
+			TransactionHash:     hash,
+			GenesisBlockAddress: string(address),
+			Succeed:             tx.succeed,
+			BlockHeight:         tx.blockHeight,
+			RecordTime:          tx.recordTime,
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sortPrunedRecords(deposits)
+	for i, deposit := range deposits {
+		if policy.pruned(i, len(deposits), deposit.RecordTime < expiryTime, deposit.Succeed) {
+			records = append(records, deposit)
+			batch.Delete(depositTxKey(deposit.TransactionHash, deposit.GenesisBlockAddress))
+		}
+	}
+
+	var withdraws []*PrunedRecord
+	err = store.forEach(finishedTxsWithdrawPrefix, func(key, value []byte) error {
+		tx, err := deserializeWithdrawTxRecord(value)
+		if err != nil {
+			return err
+		}
+		withdraws = append(withdraws, &PrunedRecord{
+			Table:                  WithdrawTransactionsTable,
+			TransactionHash:        string(key),
+			Succeed:                tx.succeed,
+			SideChainTransactionId: tx.sideChainTransactionId,
+			FailedReason:           tx.failedReason,
+			RecordTime:             tx.recordTime,
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sortPrunedRecords(withdraws)
+	prunedSideChainTxs := make(map[uint64]bool)
+	keptSideChainTxs := make(map[uint64]bool)
+	for i, withdraw := range withdraws {
+		if policy.pruned(i, len(withdraws), withdraw.RecordTime < expiryTime, withdraw.Succeed) {
+			records = append(records, withdraw)
+			batch.Delete(makeKey(finishedTxsWithdrawPrefix, []byte(withdraw.TransactionHash)))
+			prunedSideChainTxs[withdraw.SideChainTransactionId] = true
+		} else {
+			keptSideChainTxs[withdraw.SideChainTransactionId] = true
+		}
+	}
+
+	var sideChainTxIds []uint64
+	for id := range prunedSideChainTxs {
+		if id != 0 && !keptSideChainTxs[id] {
+			sideChainTxIds = append(sideChainTxIds, id)
+		}
+	}
+	sort.Slice(sideChainTxIds, func(i, j int) bool { return sideChainTxIds[i] < sideChainTxIds[j] })
+	for _, id := range sideChainTxIds {
+		value, err := store.Get(sideChainTransactionKey(id), nil)
+		if err == leveldb.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		r := bytes.NewReader(value)
+		transactionBytes, err := ReadVarBytes(r, math.MaxUint32, "transaction")
+		if err != nil {
+			return err
+		}
+		recordTime, err := ReadVarString(r)
+		if err != nil {
+			return err
+		}
+		records = append(records, &PrunedRecord{
+			Table:           SideChainTransactionsTable,
+			Id:              id,
+			TransactionData: BytesToHexString(transactionBytes),
+			RecordTime:      recordTime,
+		})
+		batch.Delete(sideChainTransactionKey(id))
+	}
+
+	// Transfers are ordered by id, which is the order they are recorded
+	var transfers []*Transfer
+	err = store.forEach(transfersPrefix, func(key, value []byte) error {
+		transfer, err := deserializeTransfer(binary.BigEndian.Uint64(key), value)
+		if err != nil {
+			return err
+		}
+		transfers = append(transfers, transfer)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i, transfer := range transfers {
+		if policy.pruned(i, len(transfers), transfer.RecordTime < expiry.Unix(), transfer.Succeed) {
+			records = append(records, &PrunedRecord{Table: TransfersTable, Id: transfer.Id,
+				Succeed: transfer.Succeed, Transfer: transfer})
+			deleteLevelDBTransfer(batch, transfer)
+		}
+	}
+
+	if len(records) == 0 {
+		return nil
+	}
+	if err := archive(records); err != nil {
+		return err
+	}
+	return store.Write(batch, nil)
+}
+
+// sortPrunedRecords orders the records from the oldest by record time.
+func sortPrunedRecords(records []*PrunedRecord) {
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].RecordTime < records[j].RecordTime
+	})
+}
+
+// levelDBTxsFinisher finishes transactions in one batch, which LevelDB
+// writes atomically, since all data stores share the database.
+type levelDBTxsFinisher struct {
+	*levelDB
+}
+
+// FinishDepositTxs removes the deposit transactions from the main chain store
+// and records them as succeed or failed in the finished transactions store,
+// together with the transfers of their cross chain outputs.
+func (store *levelDBTxsFinisher) FinishDepositTxs(succeed bool, transactionHashes,
+	genesisBlockAddresses []string, blockHeights []uint32, sideChainTxHashes []string) error {
+
+	return store.update(func(batch *leveldb.Batch) error {
+		var transfers []*Transfer
+		for i := 0; i < len(transactionHashes); i++ {
+			value, err := store.Get(mainChainTxKey(transactionHashes[i], genesisBlockAddresses[i]), nil)
+			if err == leveldb.ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			tx, _, _, err := deserializeMainChainTx(value)
+			if err != nil {
+				continue
+			}
+			var sideChainTxHash string
+			if i < len(sideChainTxHashes) {
+				sideChainTxHash = sideChainTxHashes[i]
+			}
+			transfers = append(transfers, depositTransfers(tx, transactionHashes[i], genesisBlockAddresses[i],
+				blockHeights[i], succeed, sideChainTxHash)...)
+		}
+
+		deleteLevelDBMainChainTxs(batch, transactionHashes, genesisBlockAddresses)
+		if err := injectFailure("deleteMainChainTxs"); err != nil {
+			return err
+		}
+		err := putLevelDBDepositTxs(store.levelDB, batch, transactionHashes, genesisBlockAddresses,
+			blockHeights, succeed)
+		if err != nil {
+			return err
+		}
+		return putLevelDBTransfers(store.levelDB, batch, transfers)
+	})
+}
+
+// FinishWithdrawTxs removes the side chain transactions from the side chain
+// store and records them as succeed or failed withdraws in the finished
+// transactions store, together with the transfers of their withdraw assets.
+// mainChainTxHash is the withdraw transaction sent, and transactionByte is the
+// withdraw transaction failed.
+func (store *levelDBTxsFinisher) FinishWithdrawTxs(succeed bool, transactionHashes []string,
+	mainChainTxHash string, transactionByte []byte, reason string) error {
+
+	return store.update(func(batch *leveldb.Batch) error {
+		var transfers []*Transfer
+		for _, txHash := range transactionHashes {
+			value, err := store.Get(makeKey(sideChainTxPrefix, []byte(txHash)), nil)
+			if err == leveldb.ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			tx, err := deserializeSideChainTx(txHash, value)
+			if err != nil {
+				return err
+			}
+			transfers = append(transfers, withdrawTransfers(tx.Transaction, txHash, tx.GenesisBlockAddress,
+				tx.BlockHeight, succeed, mainChainTxHash, reason)...)
+		}
+
+		deleteLevelDBSideChainTxs(batch, transactionHashes)
+		if err := injectFailure("deleteSideChainTxs"); err != nil {
+			return err
+		}
+		err := putLevelDBWithdrawTxs(store.levelDB, batch, transactionHashes, transactionByte, succeed, reason)
+		if err != nil {
+			return err
+		}
+		return putLevelDBTransfers(store.levelDB, batch, transfers)
+	})
+}
+
+// Close does nothing, the shared database is still used by other data stores.
+func (store *levelDBTxsFinisher) Close() error {
+	return nil
+}
+
+func (store *levelDBTxsFinisher) update(fn func(batch *leveldb.Batch) error) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	batch := new(leveldb.Batch)
+	if err := fn(batch); err != nil {
+		return err
+	}
+	if err := injectFailure("commit"); err != nil {
+		return err
+	}
+	return store.Write(batch, nil)
+}
+
+func transferIdBytes(id uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], id)
+	return buf[:]
+}
+
+func transferUniqueKey(transfer *Transfer) []byte {
+	return makeKey(transfersUniquePrefix, []byte{byte(transfer.Type)}, []byte(transfer.TransactionHash),
+		[]byte(transfer.GenesisBlockAddress), heightBytes(transfer.OutputIndex))
+}
+
+// transferIndexKeys returns the keys indexing the transfer besides its record.
+func transferIndexKeys(transfer *Transfer) [][]byte {
+	id := transferIdBytes(transfer.Id)
+	keys := [][]byte{
+		transferUniqueKey(transfer),
+		makeKey(transfersGenesisPrefix, []byte(transfer.GenesisBlockAddress), id),
+		makeKey(transfersAddressPrefix, []byte(transfer.TargetAddress), id),
+	}
+	if transfer.MainChainTxHash != "" {
+		keys = append(keys, makeKey(transfersTxHashPrefix, []byte(transfer.MainChainTxHash), id))
+	}
+	if transfer.SideChainTxHash != "" && transfer.SideChainTxHash != transfer.MainChainTxHash {
+		keys = append(keys, makeKey(transfersTxHashPrefix, []byte(transfer.SideChainTxHash), id))
+	}
+	return keys
+}
+
+func serializeTransfer(transfer *Transfer) []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteByte(byte(transfer.Type))
+	WriteVarString(buf, transfer.TransactionHash)
+	WriteVarString(buf, transfer.GenesisBlockAddress)
+	WriteUint32(buf, transfer.OutputIndex)
+	WriteVarString(buf, transfer.MainChainTxHash)
+	WriteVarString(buf, transfer.SideChainTxHash)
+	WriteVarString(buf, transfer.TargetAddress)
+	transfer.Amount.Serialize(buf)
+	WriteUint32(buf, transfer.BlockHeight)
+	writeBool(buf, transfer.Succeed)
+	WriteVarString(buf, transfer.FailedReason)
+	WriteUint64(buf, uint64(transfer.RecordTime))
+	return buf.Bytes()
+}
+
+func deserializeTransfer(id uint64, value []byte) (*Transfer, error) {
+	r := bytes.NewReader(value)
+	transfer := &Transfer{Id: id}
+	transferType, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	transfer.Type = TransferType(transferType)
+	if transfer.TransactionHash, err = ReadVarString(r); err != nil {
+		return nil, err
+	}
+	if transfer.GenesisBlockAddress, err = ReadVarString(r); err != nil {
+		return nil, err
+	}
+	if transfer.OutputIndex, err = ReadUint32(r); err != nil {
+		return nil, err
+	}
+	if transfer.MainChainTxHash, err = ReadVarString(r); err != nil {
+		return nil, err
+	}
+	if transfer.SideChainTxHash, err = ReadVarString(r); err != nil {
+		return nil, err
+	}
+	if transfer.TargetAddress, err = ReadVarString(r); err != nil {
+		return nil, err
+	}
+	if err := transfer.Amount.Deserialize(r); err != nil {
+		return nil, err
+	}
+	if transfer.BlockHeight, err = ReadUint32(r); err != nil {
+		return nil, err
+	}
+	succeed, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	transfer.Succeed = succeed != 0
+	if transfer.FailedReason, err = ReadVarString(r); err != nil {
+		return nil, err
+	}
+	recordTime, err := ReadUint64(r)
+	if err != nil {
+		return nil, err
+	}
+	transfer.RecordTime = int64(recordTime)
+	return transfer, nil
+}
+
+// putLevelDBTransfers adds the transfers with the next ids to batch, transfers
+// already recorded are ignored.
+func putLevelDBTransfers(db *levelDB, batch *leveldb.Batch, transfers []*Transfer) error {
+	if len(transfers) == 0 {
+		return nil
+	}
+	lastId, _, err := getUint64(db, transfersLastIdKey)
+	if err != nil {
+		return err
+	}
+
+	added := make(map[string]bool)
+	for _, transfer := range transfers {
+		uniqueKey := transferUniqueKey(transfer)
+		exist, err := db.Has(uniqueKey, nil)
+		if err != nil {
+			return err
+		}
+		if exist || added[string(uniqueKey)] {
+			continue
+		}
+		added[string(uniqueKey)] = true
+
+		lastId++
+		transfer.Id = lastId
+		batch.Put(makeKey(transfersPrefix, transferIdBytes(transfer.Id)), serializeTransfer(transfer))
+		for _, key := range transferIndexKeys(transfer) {
+			batch.Put(key, transferIdBytes(transfer.Id))
+		}
+	}
+	batch.Put(transfersLastIdKey, transferIdBytes(lastId))
+	return nil
+}
+
+func deleteLevelDBTransfer(batch *leveldb.Batch, transfer *Transfer) {
+	batch.Delete(makeKey(transfersPrefix, transferIdBytes(transfer.Id)))
+	for _, key := range transferIndexKeys(transfer) {
+		batch.Delete(key)
+	}
+}
+
+func getUint64(db *levelDB, key []byte) (uint64, bool, error) {
+	value, err := db.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	if len(value) != 8 {
+		return 0, false, errors.New("invalid uint64 value of key " + string(key))
+	}
+	return binary.BigEndian.Uint64(value), true, nil
+}
+
+func (store *levelDBFinishedTxsStore) getTransfer(id uint64) (*Transfer, error) {
+	value, err := store.Get(makeKey(transfersPrefix, transferIdBytes(id)), nil)
+	if err != nil {
+		return nil, err
+	}
+	return deserializeTransfer(id, value)
+}
+
+// QueryTransfers returns a page of the transfers selected by filter from the
+// latest, and the cursor of next page, which is 0 if there is no more. The
+// transfers are scanned by the most selective index of the filter.
+func (store *levelDBFinishedTxsStore) QueryTransfers(filter *TransferFilter) ([]*Transfer, uint64, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	indexed := true
+	var prefix []byte
+	switch {
+	case filter.TransactionHash != "":
+		prefix = makeKey(transfersTxHashPrefix, []byte(filter.TransactionHash), nil)
+	case filter.TargetAddress != "":
+		prefix = makeKey(transfersAddressPrefix, []byte(filter.TargetAddress), nil)
+	case filter.GenesisBlockAddress != "":
+		prefix = makeKey(transfersGenesisPrefix, []byte(filter.GenesisBlockAddress), nil)
+	default:
+		prefix = transfersPrefix
+		indexed = false
+	}
+
+	r := util.BytesPrefix(prefix)
+	if filter.Cursor > 0 {
+		r.Limit = makeKey(prefix, transferIdBytes(filter.Cursor))
+	}
+	iter := store.NewIterator(r, nil)
+	defer iter.Release()
+
+	limit := filter.limit()
+	var transfers []*Transfer
+	for ok := iter.Last(); ok && len(transfers) < limit; ok = iter.Prev() {
+		id := binary.BigEndian.Uint64(iter.Key()[len(prefix):])
+		var transfer *Transfer
+		var err error
+		if indexed {
+			transfer, err = store.getTransfer(id)
+		} else {
+			transfer, err = deserializeTransfer(id, iter.Value())
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if filter.match(transfer) {
+			transfers = append(transfers, transfer)
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return nil, 0, err
+	}
+
+	return transfers, nextTransfersCursor(transfers, limit), nil
+}
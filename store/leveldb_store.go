@@ -0,0 +1,1212 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+
+	"github.com/elastos/Elastos.ELA.SPV/bloom"
+	. "github.com/elastos/Elastos.ELA/common"
+	. "github.com/elastos/Elastos.ELA/core/types"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+var DBNameLevelDB = filepath.Join(DBDocumentNAME, "leveldb")
+
+// The data stores share one LevelDB database, the records of each table are
+// kept under their own key prefix. Parts of a key are separated by keySeparator,
+// which does not appear in hashes and addresses.
+var (
+	utxoPrefix        = []byte("utxo/")
+	utxoHeightKey     = []byte("utxo/height")
+	utxoInputPrefix   = []byte("utxo/u/") // input -> amount, genesis address
+	utxoAddressPrefix = []byte("utxo/a/") // genesis address, input -> amount
+	utxoBlockPrefix   = []byte("utxo/b/") // height -> block hash, undo data
+
+	mainChainPrefix         = []byte("main/")
+	mainChainTxPrefix       = []byte("main/t/") // genesis address, hash -> transaction, proof, height
+	mainChainProposalPrefix = []byte("main/p/") // hash -> proposal
+
+	sideChainPrefix       = []byte("side/")
+	sideChainHeightPrefix = []byte("side/h/") // genesis address -> height
+	sideChainTxPrefix     = []byte("side/t/") // hash -> genesis address, transaction, height
+	sideChainBlockPrefix  = []byte("side/b/") // genesis address, height -> block hash
+)
+
+const keySeparator = 0
+
+var errLevelDBRecordExists = errors.New("record already exists")
+
+// makeKey joins the parts of a key after the prefix.
+func makeKey(prefix []byte, parts ...[]byte) []byte {
+	key := make([]byte, len(prefix), len(prefix)+64)
+	copy(key, prefix)
+	for i, part := range parts {
+		if i > 0 {
+			key = append(key, keySeparator)
+		}
+		key = append(key, part...)
+	}
+	return key
+}
+
+// splitKey splits the key without prefix into the first part and the rest.
+func splitKey(key []byte) (string, []byte) {
+	index := bytes.IndexByte(key, keySeparator)
+	if index < 0 {
+		return string(key), nil
+	}
+	return string(key[:index]), key[index+1:]
+}
+
+func heightBytes(height uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], height)
+	return buf[:]
+}
+
+func serializeInput(input *Input) []byte {
+	buf := new(bytes.Buffer)
+	input.Serialize(buf)
+	return buf.Bytes()
+}
+
+func serializeAmount(amount *Fixed64) []byte {
+	buf := new(bytes.Buffer)
+	amount.Serialize(buf)
+	return buf.Bytes()
+}
+
+// levelDB is the database shared by the LevelDB data stores, the mutex
+// serializes all changes, so a check before a write is not raced.
+type levelDB struct {
+	mux *sync.Mutex
+
+	*leveldb.DB
+}
+
+func (db *levelDB) getUint32(key []byte) (uint32, bool, error) {
+	value, err := db.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	if len(value) != 4 {
+		return 0, false, errors.New("invalid uint32 value of key " + string(key))
+	}
+	return binary.BigEndian.Uint32(value), true, nil
+}
+
+// forEach calls fn with the keys without prefix and the values of the records
+// under prefix, the slices are only valid during the call.
+func (db *levelDB) forEach(prefix []byte, fn func(key, value []byte) error) error {
+	iter := db.NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		if err := fn(iter.Key()[len(prefix):], iter.Value()); err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
+
+// deleteRange adds the deletions of the records in r to batch.
+func (db *levelDB) deleteRange(batch *leveldb.Batch, r *util.Range) error {
+	iter := db.NewIterator(r, nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		batch.Delete(append([]byte(nil), iter.Key()...))
+	}
+	return iter.Error()
+}
+
+// reset deletes all records under prefix.
+func (db *levelDB) reset(prefix []byte) error {
+	batch := new(leveldb.Batch)
+	if err := db.deleteRange(batch, util.BytesPrefix(prefix)); err != nil {
+		return err
+	}
+	return db.Write(batch, nil)
+}
+
+// levelDBBackend keeps all data stores in one LevelDB database, which is
+// opened by the first data store and stays open until the process exits.
+type levelDBBackend struct {
+	mux sync.Mutex
+	db  *levelDB
+}
+
+func init() {
+	RegisterBackend(LevelDBBackend, new(levelDBBackend))
+}
+
+func (b *levelDBBackend) open() (*levelDB, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if b.db != nil {
+		return b.db, nil
+	}
+	db, err := leveldb.OpenFile(DBNameLevelDB, nil)
+	if err != nil {
+		log.Error("Open leveldb error:", err)
+		return nil, err
+	}
+	b.db = &levelDB{mux: new(sync.Mutex), DB: db}
+
+	// Handle system interrupt signals
+	HandleSignal(func() {
+		b.db.mux.Lock()
+		b.db.Close()
+		os.Exit(-1)
+	})
+
+	return b.db, nil
+}
+
+func (b *levelDBBackend) OpenUTXOStore() (DataStoreUTXO, error) {
+	db, err := b.open()
+	if err != nil {
+		return nil, err
+	}
+	return &levelDBUTXOStore{db}, nil
+}
+
+func (b *levelDBBackend) OpenMainChainStore() (DataStoreMainChain, error) {
+	db, err := b.open()
+	if err != nil {
+		return nil, err
+	}
+	return &levelDBMainChainStore{db}, nil
+}
+
+func (b *levelDBBackend) OpenSideChainStore() (DataStoreSideChain, error) {
+	db, err := b.open()
+	if err != nil {
+		return nil, err
+	}
+	dataStore := &levelDBSideChainStore{db}
+	if err := dataStore.initSideHeights(); err != nil {
+		return nil, err
+	}
+	return dataStore, nil
+}
+
+func (b *levelDBBackend) OpenFinishedTxsStore() (FinishedTransactionsDataStore, error) {
+	db, err := b.open()
+	if err != nil {
+		return nil, err
+	}
+	return &levelDBFinishedTxsStore{db}, nil
+}
+
+func (b *levelDBBackend) OpenTxsFinisher() (TxsFinisher, error) {
+	db, err := b.open()
+	if err != nil {
+		return nil, err
+	}
+	return &levelDBTxsFinisher{db}, nil
+}
+
+type levelDBUTXOStore struct {
+	*levelDB
+}
+
+func (store *levelDBUTXOStore) ResetDataStore() error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	return store.reset(utxoPrefix)
+}
+
+// catchSystemSignals does nothing, the shared database is closed by the backend.
+func (store *levelDBUTXOStore) catchSystemSignals() {}
+
+func (store *levelDBUTXOStore) CurrentHeight(height uint32) uint32 {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	storedHeight, _, err := store.getUint32(utxoHeightKey)
+	if err != nil {
+		return uint32(0)
+	}
+
+	if height > storedHeight {
+		// Received reset height code
+		if height == ResetHeightCode {
+			height = 0
+		}
+		if err := store.Put(utxoHeightKey, heightBytes(height), nil); err != nil {
+			return uint32(0)
+		}
+		return height
+	}
+	return storedHeight
+}
+
+// getUTXO returns the amount and the genesis block address of the UTXO.
+func (store *levelDBUTXOStore) getUTXO(inputBytes []byte) (*AddressUTXO, bool, error) {
+	value, err := store.Get(makeKey(utxoInputPrefix, inputBytes), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	r := bytes.NewReader(value)
+	utxo := &AddressUTXO{Input: new(Input), Amount: new(Fixed64)}
+	if err := utxo.Amount.Deserialize(r); err != nil {
+		return nil, false, err
+	}
+	if utxo.GenesisBlockAddress, err = ReadVarString(r); err != nil {
+		return nil, false, err
+	}
+	if err := utxo.Input.Deserialize(bytes.NewReader(inputBytes)); err != nil {
+		return nil, false, err
+	}
+	return utxo, true, nil
+}
+
+func putUTXO(batch *leveldb.Batch, inputBytes []byte, utxo *AddressUTXO) {
+	amountBytes := serializeAmount(utxo.Amount)
+	buf := bytes.NewBuffer(append([]byte(nil), amountBytes...))
+	WriteVarString(buf, utxo.GenesisBlockAddress)
+
+	batch.Put(makeKey(utxoInputPrefix, inputBytes), buf.Bytes())
+	batch.Put(makeKey(utxoAddressPrefix, []byte(utxo.GenesisBlockAddress), inputBytes), amountBytes)
+}
+
+func deleteUTXO(batch *leveldb.Batch, inputBytes []byte, genesisBlockAddress string) {
+	batch.Delete(makeKey(utxoInputPrefix, inputBytes))
+	batch.Delete(makeKey(utxoAddressPrefix, []byte(genesisBlockAddress), inputBytes))
+}
+
+func (store *levelDBUTXOStore) AddAddressUTXOs(utxos []*AddressUTXO) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	// UTXOs before an existing one are added, the same as the sqlite store
+	var err error
+	batch := new(leveldb.Batch)
+	added := make(map[string]bool)
+	for _, utxo := range utxos {
+		inputBytes := serializeInput(utxo.Input)
+		_, exist, e := store.getUTXO(inputBytes)
+		if e != nil {
+			err = e
+			break
+		}
+		if exist || added[string(inputBytes)] {
+			err = errLevelDBRecordExists
+			break
+		}
+		added[string(inputBytes)] = true
+		putUTXO(batch, inputBytes, utxo)
+	}
+	if e := store.Write(batch, nil); e != nil {
+		return e
+	}
+	return err
+}
+
+func (store *levelDBUTXOStore) DeleteUTXOs(inputs []*Input) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	batch := new(leveldb.Batch)
+	for _, input := range inputs {
+		inputBytes := serializeInput(input)
+		utxo, exist, err := store.getUTXO(inputBytes)
+		if err != nil {
+			return err
+		}
+		if exist {
+			deleteUTXO(batch, inputBytes, utxo.GenesisBlockAddress)
+		}
+	}
+	return store.Write(batch, nil)
+}
+
+func (store *levelDBUTXOStore) GetAddressUTXOsFromGenesisBlockAddress(genesisBlockAddress string) ([]*AddressUTXO, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	var inputs []*AddressUTXO
+	prefix := makeKey(utxoAddressPrefix, []byte(genesisBlockAddress), nil)
+	err := store.forEach(prefix, func(key, value []byte) error {
+		var input Input
+		if err := input.Deserialize(bytes.NewReader(key)); err != nil {
+			return err
+		}
+		var amount Fixed64
+		if err := amount.Deserialize(bytes.NewReader(value)); err != nil {
+			return err
+		}
+		inputs = append(inputs, &AddressUTXO{&input, &amount, genesisBlockAddress})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inputs, nil
+}
+
+func (store *levelDBUTXOStore) getBlock(height uint32) (string, []byte, error) {
+	value, err := store.Get(makeKey(utxoBlockPrefix, heightBytes(height)), nil)
+	if err != nil {
+		return "", nil, err
+	}
+	r := bytes.NewReader(value)
+	blockHash, err := ReadVarString(r)
+	if err != nil {
+		return "", nil, err
+	}
+	return blockHash, value[len(value)-r.Len():], nil
+}
+
+func (store *levelDBUTXOStore) GetBlockHash(height uint32) (string, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	blockHash, _, err := store.getBlock(height)
+	return blockHash, err
+}
+
+// ApplyBlock adds and deletes the UTXOs changed by the main chain block at
+// height, records the block hash and the undo data of the block and moves
+// the stored height to height, all in one batch.
+func (store *levelDBUTXOStore) ApplyBlock(height uint32, blockHash string, utxos []*AddressUTXO, inputs []*Input) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	// The batch is not visible before written, so the UTXOs added by the
+	// block are tracked to be spent by the same block
+	batch := new(leveldb.Batch)
+	added := make(map[string]*AddressUTXO)
+	undo := new(blockUndo)
+	for _, utxo := range utxos {
+		inputBytes := serializeInput(utxo.Input)
+		_, exist, err := store.getUTXO(inputBytes)
+		if err != nil {
+			return err
+		}
+		if exist || added[string(inputBytes)] != nil {
+			continue
+		}
+		added[string(inputBytes)] = utxo
+		putUTXO(batch, inputBytes, utxo)
+		undo.Added = append(undo.Added, utxo.Input)
+	}
+
+	spent := make(map[string]bool)
+	for _, input := range inputs {
+		inputBytes := serializeInput(input)
+		if spent[string(inputBytes)] {
+			continue
+		}
+		utxo, ok := added[string(inputBytes)]
+		if !ok {
+			stored, exist, err := store.getUTXO(inputBytes)
+			if err != nil {
+				return err
+			}
+			if !exist {
+				continue
+			}
+			utxo = stored
+		}
+		spent[string(inputBytes)] = true
+		undo.Spent = append(undo.Spent, &AddressUTXO{input, utxo.Amount, utxo.GenesisBlockAddress})
+		deleteUTXO(batch, inputBytes, utxo.GenesisBlockAddress)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := WriteVarString(buf, blockHash); err != nil {
+		return err
+	}
+	if err := undo.Serialize(buf); err != nil {
+		return err
+	}
+	batch.Put(makeKey(utxoBlockPrefix, heightBytes(height)), buf.Bytes())
+
+	// Only keep undo data of the latest blocks
+	if height > MaxUndoBlocksCount {
+		err := store.deleteRange(batch, &util.Range{
+			Start: makeKey(utxoBlockPrefix, heightBytes(0)),
+			Limit: makeKey(utxoBlockPrefix, heightBytes(height-MaxUndoBlocksCount)),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	batch.Put(utxoHeightKey, heightBytes(height))
+	return store.Write(batch, nil)
+}
+
+// RollbackBlock reverts the UTXO changes of the main chain block at height
+// by its undo data, and moves the stored height back to the previous block.
+func (store *levelDBUTXOStore) RollbackBlock(height uint32) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	_, undoBytes, err := store.getBlock(height)
+	if err != nil {
+		if err == leveldb.ErrNotFound {
+			return errors.New("no undo data of main chain block at height " + strconv.FormatUint(uint64(height), 10))
+		}
+		return err
+	}
+
+	undo := new(blockUndo)
+	if err := undo.Deserialize(bytes.NewReader(undoBytes)); err != nil {
+		return err
+	}
+
+	// Restore spent UTXOs before deleting added ones, so an output created
+	// and spent in the same block does not come back
+	batch := new(leveldb.Batch)
+	restored := make(map[string]string)
+	for _, utxo := range undo.Spent {
+		inputBytes := serializeInput(utxo.Input)
+		_, exist, err := store.getUTXO(inputBytes)
+		if err != nil {
+			return err
+		}
+		if exist {
+			continue
+		}
+		restored[string(inputBytes)] = utxo.GenesisBlockAddress
+		putUTXO(batch, inputBytes, utxo)
+	}
+
+	for _, input := range undo.Added {
+		inputBytes := serializeInput(input)
+		if genesisBlockAddress, ok := restored[string(inputBytes)]; ok {
+			deleteUTXO(batch, inputBytes, genesisBlockAddress)
+			continue
+		}
+		utxo, exist, err := store.getUTXO(inputBytes)
+		if err != nil {
+			return err
+		}
+		if exist {
+			deleteUTXO(batch, inputBytes, utxo.GenesisBlockAddress)
+		}
+	}
+
+	err = store.deleteRange(batch, &util.Range{
+		Start: makeKey(utxoBlockPrefix, heightBytes(height)),
+		Limit: util.BytesPrefix(utxoBlockPrefix).Limit,
+	})
+	if err != nil {
+		return err
+	}
+
+	var previousHeight uint32
+	if height > 0 {
+		previousHeight = height - 1
+	}
+	batch.Put(utxoHeightKey, heightBytes(previousHeight))
+
+	return store.Write(batch, nil)
+}
+
+type levelDBMainChainStore struct {
+	*levelDB
+}
+
+func (store *levelDBMainChainStore) ResetDataStore() error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	return store.reset(mainChainPrefix)
+}
+
+// catchSystemSignals does nothing, the shared database is closed by the backend.
+func (store *levelDBMainChainStore) catchSystemSignals() {}
+
+func mainChainTxKey(transactionHash, genesisBlockAddress string) []byte {
+	return makeKey(mainChainTxPrefix, []byte(genesisBlockAddress), []byte(transactionHash))
+}
+
+func serializeMainChainTx(tx *base.MainChainTransaction) ([]byte, error) {
+	txBuf := new(bytes.Buffer)
+	if err := tx.Transaction.Serialize(txBuf); err != nil {
+		return nil, err
+	}
+	proofBuf := new(bytes.Buffer)
+	if err := tx.Proof.Serialize(proofBuf); err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	if err := WriteVarBytes(buf, txBuf.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := WriteVarBytes(buf, proofBuf.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := WriteUint32(buf, tx.Proof.Height); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// deserializeMainChainTx returns the transaction, the merkle proof and the
+// block height of a main chain transaction record.
+func deserializeMainChainTx(value []byte) (*Transaction, *bloom.MerkleProof, uint32, error) {
+	r := bytes.NewReader(value)
+	txBytes, err := ReadVarBytes(r, math.MaxUint32, "transaction")
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	proofBytes, err := ReadVarBytes(r, math.MaxUint32, "merkle proof")
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	height, err := ReadUint32(r)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	var tx Transaction
+	tx.Deserialize(bytes.NewReader(txBytes))
+	var mp bloom.MerkleProof
+	mp.Deserialize(bytes.NewReader(proofBytes))
+	return &tx, &mp, height, nil
+}
+
+func (store *levelDBMainChainStore) AddMainChainTx(tx *base.MainChainTransaction) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	key := mainChainTxKey(tx.TransactionHash, tx.GenesisBlockAddress)
+	exist, err := store.Has(key, nil)
+	if err != nil {
+		return err
+	}
+	if exist {
+		return errLevelDBRecordExists
+	}
+	value, err := serializeMainChainTx(tx)
+	if err != nil {
+		return err
+	}
+	return store.Put(key, value, nil)
+}
+
+func (store *levelDBMainChainStore) AddMainChainTxs(txs []*base.MainChainTransaction) ([]bool, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	batch := new(leveldb.Batch)
+	added := make(map[string]bool)
+	var result []bool
+	for _, tx := range txs {
+		key := mainChainTxKey(tx.TransactionHash, tx.GenesisBlockAddress)
+		exist, err := store.Has(key, nil)
+		if err != nil || exist || added[string(key)] {
+			result = append(result, false)
+			continue
+		}
+		value, err := serializeMainChainTx(tx)
+		if err != nil {
+			result = append(result, false)
+			continue
+		}
+		added[string(key)] = true
+		batch.Put(key, value)
+		result = append(result, true)
+	}
+
+	return result, store.Write(batch, nil)
+}
+
+func (store *levelDBMainChainStore) HasMainChainTx(transactionHash, genesisBlockAddress string) (bool, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	return store.Has(mainChainTxKey(transactionHash, genesisBlockAddress), nil)
+}
+
+func (store *levelDBMainChainStore) RemoveMainChainTx(transactionHash, genesisBlockAddress string) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	return store.Delete(mainChainTxKey(transactionHash, genesisBlockAddress), nil)
+}
+
+func (store *levelDBMainChainStore) RemoveMainChainTxs(transactionHashes, genesisBlockAddress []string) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	batch := new(leveldb.Batch)
+	deleteLevelDBMainChainTxs(batch, transactionHashes, genesisBlockAddress)
+	return store.Write(batch, nil)
+}
+
+func deleteLevelDBMainChainTxs(batch *leveldb.Batch, transactionHashes, genesisBlockAddress []string) {
+	for i := 0; i < len(transactionHashes); i++ {
+		batch.Delete(mainChainTxKey(transactionHashes[i], genesisBlockAddress[i]))
+	}
+}
+
+func (store *levelDBMainChainStore) GetAllMainChainTxHashes() ([]string, []string, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	var txHashes []string
+	var genesisAddresses []string
+	err := store.forEach(mainChainTxPrefix, func(key, value []byte) error {
+		genesisAddress, txHash := splitKey(key)
+		txHashes = append(txHashes, string(txHash))
+		genesisAddresses = append(genesisAddresses, genesisAddress)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return txHashes, genesisAddresses, nil
+}
+
+func (store *levelDBMainChainStore) GetAllMainChainTxs() ([]*base.MainChainTransaction, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	var txs []*base.MainChainTransaction
+	err := store.forEach(mainChainTxPrefix, func(key, value []byte) error {
+		genesisAddress, txHash := splitKey(key)
+		tx, mp, _, err := deserializeMainChainTx(value)
+		if err != nil {
+			return err
+		}
+		txs = append(txs, &base.MainChainTransaction{string(txHash), genesisAddress, tx, mp})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return txs, nil
+}
+
+func (store *levelDBMainChainStore) GetMainChainTxsFromHashes(transactionHashes []string,
+	genesisBlockAddresses string) ([]*base.SpvTransaction, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	var spvTxs []*base.SpvTransaction
+	for _, txHash := range transactionHashes {
+		value, err := store.Get(mainChainTxKey(txHash, genesisBlockAddresses), nil)
+		if err == leveldb.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		tx, mp, _, err := deserializeMainChainTx(value)
+		if err != nil {
+			return nil, err
+		}
+		spvTxs = append(spvTxs, &base.SpvTransaction{MainChainTransaction: tx, Proof: mp})
+	}
+	return spvTxs, nil
+}
+
+func (store *levelDBMainChainStore) RemoveMainChainTxsAboveHeight(genesisBlockAddress string, height uint32) ([]string, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	batch := new(leveldb.Batch)
+	var txHashes []string
+	prefix := makeKey(mainChainTxPrefix, []byte(genesisBlockAddress), nil)
+	err := store.forEach(prefix, func(key, value []byte) error {
+		_, _, blockHeight, err := deserializeMainChainTx(value)
+		if err != nil {
+			return err
+		}
+		if blockHeight > height {
+			txHashes = append(txHashes, string(key))
+			batch.Delete(makeKey(prefix, key))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(txHashes) == 0 {
+		return nil, nil
+	}
+	if err := store.Write(batch, nil); err != nil {
+		return nil, err
+	}
+	return txHashes, nil
+}
+
+func serializeProposal(proposal *base.WithdrawProposal) []byte {
+	buf := new(bytes.Buffer)
+	WriteVarString(buf, proposal.GenesisBlockAddress)
+	WriteVarBytes(buf, proposal.Transaction)
+	WriteVarBytes(buf, proposal.RedeemScript)
+	WriteVarBytes(buf, proposal.Signatures)
+	WriteUint32(buf, proposal.CreationHeight)
+	return buf.Bytes()
+}
+
+func deserializeProposal(transactionHash string, value []byte) (*base.WithdrawProposal, error) {
+	r := bytes.NewReader(value)
+	proposal := &base.WithdrawProposal{TransactionHash: transactionHash}
+	var err error
+	if proposal.GenesisBlockAddress, err = ReadVarString(r); err != nil {
+		return nil, err
+	}
+	if proposal.Transaction, err = ReadVarBytes(r, math.MaxUint32, "transaction"); err != nil {
+		return nil, err
+	}
+	if proposal.RedeemScript, err = ReadVarBytes(r, math.MaxUint32, "redeem script"); err != nil {
+		return nil, err
+	}
+	if proposal.Signatures, err = ReadVarBytes(r, math.MaxUint32, "signatures"); err != nil {
+		return nil, err
+	}
+	if proposal.CreationHeight, err = ReadUint32(r); err != nil {
+		return nil, err
+	}
+	return proposal, nil
+}
+
+func (store *levelDBMainChainStore) AddProposal(proposal *base.WithdrawProposal) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	key := makeKey(mainChainProposalPrefix, []byte(proposal.TransactionHash))
+	exist, err := store.Has(key, nil)
+	if err != nil {
+		return err
+	}
+	if exist {
+		return errLevelDBRecordExists
+	}
+	return store.Put(key, serializeProposal(proposal), nil)
+}
+
+func (store *levelDBMainChainStore) UpdateProposalSignatures(transactionHash string, transaction, signatures []byte) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	key := makeKey(mainChainProposalPrefix, []byte(transactionHash))
+	value, err := store.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	proposal, err := deserializeProposal(transactionHash, value)
+	if err != nil {
+		return err
+	}
+	proposal.Transaction = transaction
+	proposal.Signatures = signatures
+	return store.Put(key, serializeProposal(proposal), nil)
+}
+
+func (store *levelDBMainChainStore) RemoveProposal(transactionHash string) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	return store.Delete(makeKey(mainChainProposalPrefix, []byte(transactionHash)), nil)
+}
+
+func (store *levelDBMainChainStore) GetAllProposals() ([]*base.WithdrawProposal, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	var proposals []*base.WithdrawProposal
+	err := store.forEach(mainChainProposalPrefix, func(key, value []byte) error {
+		proposal, err := deserializeProposal(string(key), value)
+		if err != nil {
+			return err
+		}
+		proposals = append(proposals, proposal)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return proposals, nil
+}
+
+// RemoveProposalsBelowHeight removes the proposals created before height and
+// returns their transaction hashes.
+func (store *levelDBMainChainStore) RemoveProposalsBelowHeight(height uint32) ([]string, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	batch := new(leveldb.Batch)
+	var txHashes []string
+	err := store.forEach(mainChainProposalPrefix, func(key, value []byte) error {
+		proposal, err := deserializeProposal(string(key), value)
+		if err != nil {
+			return err
+		}
+		if proposal.CreationHeight < height {
+			txHashes = append(txHashes, proposal.TransactionHash)
+			batch.Delete(makeKey(mainChainProposalPrefix, key))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := store.Write(batch, nil); err != nil {
+		return nil, err
+	}
+	return txHashes, nil
+}
+
+type levelDBSideChainStore struct {
+	*levelDB
+}
+
+// initSideHeights records height 0 for the side chains configured without
+// height.
+func (store *levelDBSideChainStore) initSideHeights() error {
+	for _, node := range config.Parameters.SideNodeList {
+		key := makeKey(sideChainHeightPrefix, []byte(node.GenesisBlockAddress))
+		exist, err := store.Has(key, nil)
+		if err != nil {
+			return err
+		}
+		if exist {
+			continue
+		}
+		if err := store.Put(key, heightBytes(0), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *levelDBSideChainStore) ResetDataStore() error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	if err := store.reset(sideChainPrefix); err != nil {
+		return err
+	}
+	return store.initSideHeights()
+}
+
+// catchSystemSignals does nothing, the shared database is closed by the backend.
+func (store *levelDBSideChainStore) catchSystemSignals() {}
+
+func (store *levelDBSideChainStore) CurrentSideHeight(genesisBlockAddress string, height uint32) uint32 {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	key := makeKey(sideChainHeightPrefix, []byte(genesisBlockAddress))
+	storedHeight, exist, err := store.getUint32(key)
+	if err != nil {
+		return uint32(0)
+	}
+
+	if height > storedHeight {
+		// Received reset height code
+		if height == ResetHeightCode {
+			height = 0
+		}
+		// Only the heights of side chains configured are recorded
+		if exist {
+			if err := store.Put(key, heightBytes(height), nil); err != nil {
+				return uint32(0)
+			}
+		}
+		return height
+	}
+	return storedHeight
+}
+
+func serializeSideChainTx(tx *base.SideChainTransaction) []byte {
+	buf := new(bytes.Buffer)
+	WriteVarString(buf, tx.GenesisBlockAddress)
+	WriteVarBytes(buf, tx.Transaction)
+	WriteUint32(buf, tx.BlockHeight)
+	return buf.Bytes()
+}
+
+func deserializeSideChainTx(transactionHash string, value []byte) (*base.SideChainTransaction, error) {
+	r := bytes.NewReader(value)
+	tx := &base.SideChainTransaction{TransactionHash: transactionHash}
+	var err error
+	if tx.GenesisBlockAddress, err = ReadVarString(r); err != nil {
+		return nil, err
+	}
+	if tx.Transaction, err = ReadVarBytes(r, math.MaxUint32, "transaction"); err != nil {
+		return nil, err
+	}
+	if tx.BlockHeight, err = ReadUint32(r); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+func (store *levelDBSideChainStore) getSideChainTx(transactionHash string) (*base.SideChainTransaction, bool, error) {
+	value, err := store.Get(makeKey(sideChainTxPrefix, []byte(transactionHash)), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	tx, err := deserializeSideChainTx(transactionHash, value)
+	if err != nil {
+		return nil, false, err
+	}
+	return tx, true, nil
+}
+
+func deserializeWithdrawTx(transactionBytes []byte) *base.WithdrawTx {
+	tx := new(base.WithdrawTx)
+	tx.Deserialize(bytes.NewReader(transactionBytes))
+	return tx
+}
+
+func (store *levelDBSideChainStore) AddSideChainTxs(txs []*base.SideChainTransaction) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	batch := new(leveldb.Batch)
+	added := make(map[string]bool)
+	for _, tx := range txs {
+		key := makeKey(sideChainTxPrefix, []byte(tx.TransactionHash))
+		exist, err := store.Has(key, nil)
+		if err != nil || exist || added[tx.TransactionHash] {
+			log.Error("[AddSideChainTxs] err")
+			continue
+		}
+		added[tx.TransactionHash] = true
+		batch.Put(key, serializeSideChainTx(tx))
+	}
+
+	return store.Write(batch, nil)
+}
+
+func (store *levelDBSideChainStore) AddSideChainTx(tx *base.SideChainTransaction) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	key := makeKey(sideChainTxPrefix, []byte(tx.TransactionHash))
+	exist, err := store.Has(key, nil)
+	if err != nil {
+		return err
+	}
+	if exist {
+		return errLevelDBRecordExists
+	}
+	return store.Put(key, serializeSideChainTx(tx), nil)
+}
+
+func (store *levelDBSideChainStore) HasSideChainTx(transactionHash string) (bool, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	return store.Has(makeKey(sideChainTxPrefix, []byte(transactionHash)), nil)
+}
+
+func (store *levelDBSideChainStore) RemoveSideChainTxs(transactionHashes []string) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	batch := new(leveldb.Batch)
+	deleteLevelDBSideChainTxs(batch, transactionHashes)
+	return store.Write(batch, nil)
+}
+
+func deleteLevelDBSideChainTxs(batch *leveldb.Batch, transactionHashes []string) {
+	for _, txHash := range transactionHashes {
+		batch.Delete(makeKey(sideChainTxPrefix, []byte(txHash)))
+	}
+}
+
+func (store *levelDBSideChainStore) GetAllSideChainTxHashes() ([]string, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	var txHashes []string
+	err := store.forEach(sideChainTxPrefix, func(key, value []byte) error {
+		txHashes = append(txHashes, string(key))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return txHashes, nil
+}
+
+func (store *levelDBSideChainStore) GetAllSideChainTxHashesAndHeights(genesisBlockAddress string) ([]string, []uint32, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	var txHashes []string
+	var blockHeights []uint32
+	err := store.forEach(sideChainTxPrefix, func(key, value []byte) error {
+		tx, err := deserializeSideChainTx(string(key), value)
+		if err != nil {
+			return err
+		}
+		if tx.GenesisBlockAddress == genesisBlockAddress {
+			txHashes = append(txHashes, tx.TransactionHash)
+			blockHeights = append(blockHeights, tx.BlockHeight)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return txHashes, blockHeights, nil
+}
+
+func (store *levelDBSideChainStore) GetSideChainTxsFromHashes(transactionHashes []string) ([]*base.WithdrawTx, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	// Transactions are returned once each and ordered by hash, the same as
+	// the sqlite store
+	hashes := make(map[string]bool)
+	var sortedHashes []string
+	for _, txHash := range transactionHashes {
+		if !hashes[txHash] {
+			hashes[txHash] = true
+			sortedHashes = append(sortedHashes, txHash)
+		}
+	}
+	sort.Strings(sortedHashes)
+
+	var txs []*base.WithdrawTx
+	for _, txHash := range sortedHashes {
+		tx, exist, err := store.getSideChainTx(txHash)
+		if err != nil {
+			return nil, err
+		}
+		if exist {
+			txs = append(txs, deserializeWithdrawTx(tx.Transaction))
+		}
+	}
+	return txs, nil
+}
+
+func (store *levelDBSideChainStore) GetSideChainTxsFromHashesAndGenesisAddress(transactionHashes []string, genesisBlockAddress string) ([]*base.WithdrawTx, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	var txs []*base.WithdrawTx
+	for _, txHash := range transactionHashes {
+		tx, exist, err := store.getSideChainTx(txHash)
+		if err != nil {
+			return nil, err
+		}
+		if exist && tx.GenesisBlockAddress == genesisBlockAddress {
+			txs = append(txs, deserializeWithdrawTx(tx.Transaction))
+		}
+	}
+	return txs, nil
+}
+
+func sideChainBlockKey(genesisBlockAddress string, height uint32) []byte {
+	return makeKey(sideChainBlockPrefix, []byte(genesisBlockAddress), heightBytes(height))
+}
+
+// AddSideChainBlock records the hash of the processed side chain block at
+// height, and prunes records older than MaxSideChainBlocksCount blocks.
+func (store *levelDBSideChainStore) AddSideChainBlock(genesisBlockAddress string, height uint32, blockHash string) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	batch := new(leveldb.Batch)
+	batch.Put(sideChainBlockKey(genesisBlockAddress, height), []byte(blockHash))
+	if height > MaxSideChainBlocksCount {
+		err := store.deleteRange(batch, &util.Range{
+			Start: sideChainBlockKey(genesisBlockAddress, 0),
+			Limit: sideChainBlockKey(genesisBlockAddress, height-MaxSideChainBlocksCount),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return store.Write(batch, nil)
+}
+
+func (store *levelDBSideChainStore) GetSideChainBlockHash(genesisBlockAddress string, height uint32) (string, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	blockHash, err := store.Get(sideChainBlockKey(genesisBlockAddress, height), nil)
+	if err != nil {
+		return "", err
+	}
+	return string(blockHash), nil
+}
+
+// RollbackSideChain removes the block records and the withdraw transactions
+// of the side chain above forkHeight, and moves the side height back to
+// currentHeight. The hashes of the removed transactions are returned.
+func (store *levelDBSideChainStore) RollbackSideChain(genesisBlockAddress string, forkHeight, currentHeight uint32) ([]string, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	batch := new(leveldb.Batch)
+	var txHashes []string
+	err := store.forEach(sideChainTxPrefix, func(key, value []byte) error {
+		tx, err := deserializeSideChainTx(string(key), value)
+		if err != nil {
+			return err
+		}
+		if tx.GenesisBlockAddress == genesisBlockAddress && tx.BlockHeight > forkHeight {
+			txHashes = append(txHashes, tx.TransactionHash)
+			batch.Delete(makeKey(sideChainTxPrefix, key))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if forkHeight < math.MaxUint32 {
+		err = store.deleteRange(batch, &util.Range{
+			Start: sideChainBlockKey(genesisBlockAddress, forkHeight+1),
+			Limit: util.BytesPrefix(makeKey(sideChainBlockPrefix, []byte(genesisBlockAddress), nil)).Limit,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	heightKey := makeKey(sideChainHeightPrefix, []byte(genesisBlockAddress))
+	exist, err := store.Has(heightKey, nil)
+	if err != nil {
+		return nil, err
+	}
+	if exist {
+		batch.Put(heightKey, heightBytes(currentHeight))
+	}
+
+	return txHashes, store.Write(batch, nil)
+}
@@ -0,0 +1,233 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+)
+
+const schemaVersionKey = "SchemaVersion"
+
+// ErrMigrationDryRun is returned when migrations are pending in dry run mode,
+// the migrations are checked and rolled back, so the database is unchanged.
+var ErrMigrationDryRun = errors.New("database migration dry run finished, migrations are not applied")
+
+// Migration upgrades the schema of a database from Version-1 to Version.
+type Migration struct {
+	Version     uint32
+	Description string
+	Up          func(tx *sql.Tx) error
+}
+
+type migrationOptions struct {
+	DryRun bool
+	Backup bool
+}
+
+func defaultMigrationOptions() migrationOptions {
+	return migrationOptions{
+		DryRun: config.Parameters.MigrationDryRun,
+		Backup: config.Parameters.MigrationBackup,
+	}
+}
+
+// sqlExecutor is implemented by both sql.DB and sql.Tx.
+type sqlExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// createTables returns a migration step creating the tables.
+func createTables(statements ...string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, statement := range statements {
+			if _, err := tx.Exec(statement); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// addColumn returns a migration step adding the column to the table, the
+// column may already exist in the databases created before migrations.
+func addColumn(table, column, definition string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		return addColumnIfNotExists(tx, table, column, definition)
+	}
+}
+
+// migrate brings the schema of the database at path up to the latest version
+// of the migrations, each migration is applied in its own transaction together
+// with the schema version in Info table.
+func migrate(db *sql.DB, path string, migrations []*Migration, options migrationOptions) error {
+	if err := checkMigrations(migrations); err != nil {
+		return err
+	}
+	if _, err := db.Exec(CreateInfoTable); err != nil {
+		return err
+	}
+
+	current, err := GetSchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	latest := uint32(len(migrations))
+	if current > latest {
+		return fmt.Errorf("schema version %d of %s is newer than supported version %d",
+			current, path, latest)
+	}
+	pending := migrations[current:]
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if options.DryRun {
+		for _, migration := range pending {
+			if err := applyMigration(db, migration, true); err != nil {
+				return err
+			}
+		}
+		log.Info("[migrate]", len(pending), "migrations of", path, "from version", current, "to", latest, "passed dry run")
+		return ErrMigrationDryRun
+	}
+
+	if options.Backup {
+		hasData, err := hasTables(db)
+		if err != nil {
+			return err
+		}
+		if hasData {
+			backupPath, err := backupDatabase(path, current)
+			if err != nil {
+				return err
+			}
+			log.Info("[migrate] Backup", path, "to", backupPath)
+		}
+	}
+
+	for _, migration := range pending {
+		if err := applyMigration(db, migration, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkMigrations(migrations []*Migration) error {
+	for i, migration := range migrations {
+		if migration.Version != uint32(i+1) {
+			return fmt.Errorf("migration %q has version %d, expect %d",
+				migration.Description, migration.Version, i+1)
+		}
+	}
+	return nil
+}
+
+func applyMigration(db *sql.DB, migration *Migration, dryRun bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := migration.Up(tx); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("migration %d %q failed: %s", migration.Version, migration.Description, err)
+	}
+	if err := setSchemaVersion(tx, migration.Version); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if dryRun {
+		log.Info("[applyMigration] Dry run migration", migration.Version, migration.Description)
+		return tx.Rollback()
+	}
+	log.Info("[applyMigration] Applied migration", migration.Version, migration.Description)
+	return tx.Commit()
+}
+
+// GetSchemaVersion returns the schema version of the database, databases
+// created before migrations are of version 0.
+func GetSchemaVersion(db *sql.DB) (uint32, error) {
+	var version uint32
+	err := db.QueryRow("SELECT Value FROM Info WHERE Name=?", schemaVersionKey).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return version, err
+}
+
+func setSchemaVersion(tx *sql.Tx, version uint32) error {
+	_, err := tx.Exec("INSERT OR REPLACE INTO Info(Name, Value) VALUES(?,?)", schemaVersionKey, version)
+	return err
+}
+
+// hasTables returns if there is any table other than Info in the database.
+func hasTables(db *sql.DB) (bool, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name!='Info'").Scan(&count)
+	return count > 0, err
+}
+
+// backupDatabase copies the database file next to it before migration, named
+// with the schema version and the time of backup.
+func backupDatabase(path string, version uint32) (string, error) {
+	backupPath := fmt.Sprintf("%s.v%d.%s.bak", path, version, time.Now().Format("20060102150405"))
+
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(backupPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(backupPath)
+		return "", err
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		return "", err
+	}
+	return backupPath, dst.Close()
+}
+
+// addColumnIfNotExists adds the column to the table if the table has no such
+// column.
+func addColumnIfNotExists(db sqlExecutor, table, column, definition string) error {
+	rows, err := db.Query("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		var cid int
+		var name string
+		var columnType string
+		var notNull bool
+		var defaultValue interface{}
+		var primaryKey int
+		err = rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &primaryKey)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		if name == column {
+			rows.Close()
+			return nil
+		}
+	}
+	rows.Close()
+
+	_, err = db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
+	return err
+}
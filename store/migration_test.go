@@ -0,0 +1,131 @@
+package store
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const migrationTestDB = "migrationTest.db"
+
+var testMigrations = []*Migration{
+	{1, "create test table", createTables(`CREATE TABLE IF NOT EXISTS Test (
+				Id INTEGER NOT NULL PRIMARY KEY,
+				Name VARCHAR
+			);`)},
+	{2, "add Value to Test", addColumn("Test", "Value", "INTEGER")},
+}
+
+func openMigrationTestDB(t *testing.T) *sql.DB {
+	removeMigrationTestDB()
+	db, err := sql.Open(DriverName, migrationTestDB)
+	if err != nil {
+		t.Fatal("Open database error.")
+	}
+	return db
+}
+
+func removeMigrationTestDB() {
+	backups, _ := filepath.Glob(migrationTestDB + ".*.bak")
+	for _, backup := range backups {
+		os.Remove(backup)
+	}
+	os.Remove(migrationTestDB)
+}
+
+func checkSchemaVersion(t *testing.T, db *sql.DB, expected uint32) {
+	version, err := GetSchemaVersion(db)
+	if err != nil {
+		t.Error("Get schema version error.")
+	}
+	if version != expected {
+		t.Errorf("Schema version should be %d, got %d.", expected, version)
+	}
+}
+
+func countBackups(pattern string) int {
+	backups, _ := filepath.Glob(pattern)
+	return len(backups)
+}
+
+func TestMigrate_LegacyDatabase(t *testing.T) {
+	db := openMigrationTestDB(t)
+	defer removeMigrationTestDB()
+	defer db.Close()
+
+	// Databases created before migrations have the tables but no version
+	if _, err := db.Exec("CREATE TABLE Test (Id INTEGER NOT NULL PRIMARY KEY, Name VARCHAR)"); err != nil {
+		t.Fatal("Create legacy table error.")
+	}
+	if _, err := db.Exec("INSERT INTO Test(Name) VALUES(?)", "legacy"); err != nil {
+		t.Fatal("Insert legacy data error.")
+	}
+
+	if err := migrate(db, migrationTestDB, testMigrations, migrationOptions{Backup: true}); err != nil {
+		t.Error("Migrate database error:", err)
+	}
+	checkSchemaVersion(t, db, 2)
+	if _, err := db.Exec("UPDATE Test SET Value=? WHERE Name=?", 1, "legacy"); err != nil {
+		t.Error("Column should be added by migration.")
+	}
+	if countBackups(migrationTestDB+".v0.*.bak") != 1 {
+		t.Error("Database should be backed up before migration.")
+	}
+
+	// Migrating again changes nothing
+	if err := migrate(db, migrationTestDB, testMigrations, migrationOptions{Backup: true}); err != nil {
+		t.Error("Migrate database error:", err)
+	}
+	if countBackups(migrationTestDB+".*.bak") != 1 {
+		t.Error("Database should not be backed up without migrations.")
+	}
+}
+
+func TestMigrate_DryRun(t *testing.T) {
+	db := openMigrationTestDB(t)
+	defer removeMigrationTestDB()
+	defer db.Close()
+
+	if err := migrate(db, migrationTestDB, testMigrations[:1], migrationOptions{}); err != nil {
+		t.Error("Migrate database error:", err)
+	}
+
+	err := migrate(db, migrationTestDB, testMigrations, migrationOptions{DryRun: true, Backup: true})
+	if err != ErrMigrationDryRun {
+		t.Error("Dry run should not apply migrations.")
+	}
+	checkSchemaVersion(t, db, 1)
+	if _, err := db.Exec("UPDATE Test SET Value=?", 1); err == nil {
+		t.Error("Column should not be added by dry run.")
+	}
+	if countBackups(migrationTestDB+".*.bak") != 0 {
+		t.Error("Database should not be backed up by dry run.")
+	}
+}
+
+func TestMigrate_Invalid(t *testing.T) {
+	db := openMigrationTestDB(t)
+	defer removeMigrationTestDB()
+	defer db.Close()
+
+	// Migrations must be ordered from version 1
+	if err := migrate(db, migrationTestDB, testMigrations[1:], migrationOptions{}); err == nil {
+		t.Error("Unordered migrations should be refused.")
+	}
+
+	// Databases of newer versions are refused
+	if err := migrate(db, migrationTestDB, testMigrations, migrationOptions{}); err != nil {
+		t.Error("Migrate database error:", err)
+	}
+	if err := migrate(db, migrationTestDB, testMigrations[:1], migrationOptions{}); err == nil {
+		t.Error("Database of newer version should be refused.")
+	}
+
+	// A failed migration is rolled back
+	failed := append(testMigrations, &Migration{3, "invalid", createTables("CREATE TABLE Test (Id INTEGER)")})
+	if err := migrate(db, migrationTestDB, failed, migrationOptions{}); err == nil {
+		t.Error("Invalid migration should fail.")
+	}
+	checkSchemaVersion(t, db, 2)
+}
@@ -0,0 +1,212 @@
+package store
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+)
+
+var FinishedTxsPruner *Pruner
+
+// PruneRun is the result of one run of the pruner.
+type PruneRun struct {
+	StartTime    time.Time
+	Duration     time.Duration
+	DepositTxs   int
+	WithdrawTxs  int
+	SideChainTxs int
+	Transfers    int
+	// ArchiveFile is the compressed export of the records pruned, empty if
+	// nothing is pruned
+	ArchiveFile string
+	Error       string
+}
+
+// Pruner removes the records of the finished transactions database out of the
+// retention policy, the records pruned are exported to gzipped json lines
+// files under archive path first.
+type Pruner struct {
+	mux         sync.Mutex
+	store       FinishedTransactionsDataStore
+	policy      RetentionPolicy
+	archivePath string
+	lastRun     *PruneRun
+}
+
+// NewPruner returns a pruner of the store, the archives are written under
+// DBDocumentNAME if archivePath is empty.
+func NewPruner(store FinishedTransactionsDataStore, policy *RetentionPolicy, archivePath string) *Pruner {
+	if archivePath == "" {
+		archivePath = filepath.Join(DBDocumentNAME, "archive")
+	}
+	return &Pruner{store: store, policy: *policy, archivePath: archivePath}
+}
+
+// PruneLoop prunes the finished transactions database periodically, it
+// returns at once if pruning is disabled.
+func (p *Pruner) PruneLoop() {
+	if config.Parameters.FinishedTxsPruneInterval == 0 || !p.policy.Enabled() {
+		log.Info("Finished transactions pruning is disabled")
+		return
+	}
+	for {
+		time.Sleep(time.Millisecond * config.Parameters.FinishedTxsPruneInterval)
+		p.Prune()
+	}
+}
+
+// Prune runs the retention policy once and returns the result, which is also
+// kept as the last run.
+func (p *Pruner) Prune() *PruneRun {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	run := &PruneRun{StartTime: time.Now()}
+	err := p.store.Prune(&p.policy, func(records []*PrunedRecord) error {
+		archiveFile, err := writeArchive(p.archivePath, run.StartTime, records)
+		if err != nil {
+			return err
+		}
+		run.ArchiveFile = archiveFile
+		for _, record := range records {
+			switch record.Table {
+			case DepositTransactionsTable:
+				run.DepositTxs++
+			case WithdrawTransactionsTable:
+				run.WithdrawTxs++
+			case SideChainTransactionsTable:
+				run.SideChainTxs++
+			case TransfersTable:
+				run.Transfers++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// The records are kept, so is not the archive of them
+		if run.ArchiveFile != "" {
+			os.Remove(run.ArchiveFile)
+		}
+		run = &PruneRun{StartTime: run.StartTime, Error: err.Error()}
+		log.Warn("[Prune] Prune finished transactions failed:", err)
+	} else if run.ArchiveFile != "" {
+		log.Info("[Prune] Pruned", run.DepositTxs, "deposits,", run.WithdrawTxs, "withdraws,", run.SideChainTxs,
+			"side chain transactions and", run.Transfers, "transfers to", run.ArchiveFile)
+	}
+	run.Duration = time.Since(run.StartTime)
+	p.lastRun = run
+
+	result := *run
+	return &result
+}
+
+// LastRun returns the result of the last run, nil if the pruner never ran.
+func (p *Pruner) LastRun() *PruneRun {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if p.lastRun == nil {
+		return nil
+	}
+	result := *p.lastRun
+	return &result
+}
+
+// Policy returns the retention policy of the pruner.
+func (p *Pruner) Policy() RetentionPolicy {
+	return p.policy
+}
+
+// writeArchive writes the records as gzipped json lines to a new file under
+// path, the file is renamed to its name only after completely written.
+func writeArchive(path string, startTime time.Time, records []*PrunedRecord) (string, error) {
+	if err := os.MkdirAll(path, os.ModePerm); err != nil {
+		return "", err
+	}
+	archiveFile := filepath.Join(path, "finishedTxs_"+startTime.Format(recordTimeFormat)+".json.gz")
+	if exist, err := PathExists(archiveFile); err != nil {
+		return "", err
+	} else if exist {
+		return "", errors.New("archive file " + archiveFile + " already exists")
+	}
+
+	file, err := ioutil.TempFile(path, "finishedTxs_")
+	if err != nil {
+		return "", err
+	}
+	tempFile := file.Name()
+	if err := writeArchiveRecords(file, records); err != nil {
+		file.Close()
+		os.Remove(tempFile)
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tempFile)
+		return "", err
+	}
+	if err := os.Rename(tempFile, archiveFile); err != nil {
+		os.Remove(tempFile)
+		return "", err
+	}
+	return archiveFile, nil
+}
+
+func writeArchiveRecords(file *os.File, records []*PrunedRecord) error {
+	writer := gzip.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// DatabaseSize is the size in bytes of a database file or directory under
+// DBDocumentNAME.
+type DatabaseSize struct {
+	Name string
+	Size int64
+}
+
+// DatabaseSizes returns the size of each entry under DBDocumentNAME, the size
+// of a directory is the total size of the files in it.
+func DatabaseSizes() ([]*DatabaseSize, error) {
+	infos, err := ioutil.ReadDir(DBDocumentNAME)
+	if err != nil {
+		return nil, err
+	}
+
+	var sizes []*DatabaseSize
+	for _, info := range infos {
+		size := info.Size()
+		if info.IsDir() {
+			size = 0
+			err := filepath.Walk(filepath.Join(DBDocumentNAME, info.Name()), func(_ string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if !info.IsDir() {
+					size += info.Size()
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		sizes = append(sizes, &DatabaseSize{Name: info.Name(), Size: size})
+	}
+	return sizes, nil
+}
@@ -0,0 +1,159 @@
+package store
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestFinishedTxsDataStore_Prune(t *testing.T) {
+	datastore, err := OpenFinishedTxsDataStore()
+	if err != nil {
+		t.Fatal("Open database error.")
+	}
+	defer datastore.ResetDataStore()
+
+	if err := datastore.AddSucceedDepositTxs([]string{"depositHash1"}, []string{"testAddress"}, []uint32{10}); err != nil {
+		t.Fatal("Add deposit transaction error.")
+	}
+	if err := datastore.AddFailedDepositTxs([]string{"depositHash2"}, []string{"testAddress"}, []uint32{10}); err != nil {
+		t.Fatal("Add deposit transaction error.")
+	}
+	if err := datastore.AddSucceedWithdrawTxs([]string{"withdrawHash1"}); err != nil {
+		t.Fatal("Add withdraw transaction error.")
+	}
+	if err := datastore.AddFailedWithdrawTxs([]string{"withdrawHash2"}, []byte{1}, "failed"); err != nil {
+		t.Fatal("Add withdraw transaction error.")
+	}
+	if err := datastore.AddFailedWithdrawTxs([]string{"withdrawHash3"}, []byte{2}, "failed"); err != nil {
+		t.Fatal("Add withdraw transaction error.")
+	}
+
+	// Nothing is deleted if archive fails
+	err = datastore.Prune(&RetentionPolicy{KeepFailedOnly: true}, func(records []*PrunedRecord) error {
+		return errInjected
+	})
+	if err != errInjected {
+		t.Error("Prune should fail with archive.")
+	}
+	if ok, _ := datastore.HasDepositTx("depositHash1", "testAddress"); !ok {
+		t.Error("Deposit transaction should be kept after archive failed.")
+	}
+
+	var archived []*PrunedRecord
+	archive := func(records []*PrunedRecord) error {
+		archived = append(archived, records...)
+		return nil
+	}
+	if err := datastore.Prune(&RetentionPolicy{KeepFailedOnly: true}, archive); err != nil {
+		t.Fatal("Prune succeed transactions error.")
+	}
+	if len(archived) != 2 {
+		t.Error("Succeed deposit and withdraw transaction should be archived.")
+	}
+	if ok, _ := datastore.HasDepositTx("depositHash1", "testAddress"); ok {
+		t.Error("Succeed deposit transaction should be pruned.")
+	}
+	if ok, _ := datastore.HasWithdrawTx("withdrawHash1"); ok {
+		t.Error("Succeed withdraw transaction should be pruned.")
+	}
+	if ok, _ := datastore.HasDepositTx("depositHash2", "testAddress"); !ok {
+		t.Error("Failed deposit transaction should be kept.")
+	}
+
+	// The side chain transaction is pruned with its failed withdraw
+	archived = nil
+	if err := datastore.Prune(&RetentionPolicy{MaxCount: 1}, archive); err != nil {
+		t.Fatal("Prune by count error.")
+	}
+	var withdraws, sideChainTxs int
+	for _, record := range archived {
+		switch record.Table {
+		case WithdrawTransactionsTable:
+			withdraws++
+			if record.TransactionHash != "withdrawHash2" {
+				t.Error("The oldest withdraw transaction should be pruned.")
+			}
+		case SideChainTransactionsTable:
+			sideChainTxs++
+			if record.TransactionData != "01" {
+				t.Error("Side chain transaction of the pruned withdraw should be archived.")
+			}
+		}
+	}
+	if withdraws != 1 || sideChainTxs != 1 {
+		t.Error("One withdraw and its side chain transaction should be pruned.")
+	}
+	succeed, transactionByte, err := datastore.GetWithdrawTxByHash("withdrawHash3")
+	if err != nil || succeed || len(transactionByte) != 1 || transactionByte[0] != 2 {
+		t.Error("The latest failed withdraw transaction should be kept.")
+	}
+
+	archived = nil
+	if err := datastore.Prune(&RetentionPolicy{MaxCount: 1}, archive); err != nil || len(archived) != 0 {
+		t.Error("Nothing should be pruned again.")
+	}
+}
+
+func TestPruner_Prune(t *testing.T) {
+	datastore, err := OpenFinishedTxsDataStore()
+	if err != nil {
+		t.Fatal("Open database error.")
+	}
+	defer datastore.ResetDataStore()
+
+	archivePath, err := ioutil.TempDir("", "arbiter_archive")
+	if err != nil {
+		t.Fatal("Create archive directory error.")
+	}
+	defer os.RemoveAll(archivePath)
+
+	if err := datastore.AddSucceedDepositTxs([]string{"depositHash"}, []string{"testAddress"}, []uint32{10}); err != nil {
+		t.Fatal("Add deposit transaction error.")
+	}
+	if err := datastore.AddSucceedWithdrawTxs([]string{"withdrawHash"}); err != nil {
+		t.Fatal("Add withdraw transaction error.")
+	}
+
+	pruner := NewPruner(datastore, &RetentionPolicy{KeepFailedOnly: true}, archivePath)
+	if pruner.LastRun() != nil {
+		t.Error("Pruner should not have run.")
+	}
+	run := pruner.Prune()
+	if run.Error != "" || run.DepositTxs != 1 || run.WithdrawTxs != 1 || run.ArchiveFile == "" {
+		t.Fatal("Prune run error.")
+	}
+	if lastRun := pruner.LastRun(); lastRun == nil || lastRun.ArchiveFile != run.ArchiveFile {
+		t.Error("Last run should be kept.")
+	}
+
+	file, err := os.Open(run.ArchiveFile)
+	if err != nil {
+		t.Fatal("Open archive file error.")
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal("Read archive file error.")
+	}
+	scanner := bufio.NewScanner(reader)
+	var tables []string
+	for scanner.Scan() {
+		var record PrunedRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatal("Decode archived record error.")
+		}
+		tables = append(tables, record.Table)
+	}
+	if len(tables) != 2 || tables[0] != DepositTransactionsTable || tables[1] != WithdrawTransactionsTable {
+		t.Error("Archive should contain the pruned deposit and withdraw transactions.")
+	}
+
+	// Nothing to prune, so no archive is written
+	if run := pruner.Prune(); run.Error != "" || run.ArchiveFile != "" {
+		t.Error("Prune run without records error.")
+	}
+}
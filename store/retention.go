@@ -0,0 +1,234 @@
+package store
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/config"
+
+	. "github.com/elastos/Elastos.ELA/common"
+)
+
+// Tables of the finished transactions database, the records pruned from both
+// backends are named by them.
+const (
+	DepositTransactionsTable   = "DepositTransactions"
+	WithdrawTransactionsTable  = "WithdrawTransactions"
+	SideChainTransactionsTable = "SideChainTransactions"
+	TransfersTable             = "Transfers"
+)
+
+// recordTimeFormat is the format of the record time of finished transactions,
+// the records are pruned by comparing it as strings.
+const recordTimeFormat = "2006-01-02_15.04.05"
+
+// RetentionPolicy decides which records of the finished transactions database
+// are pruned, a record is pruned if any of the rules selects it.
+type RetentionPolicy struct {
+	// MaxAge prunes the records finished longer ago than it, 0 keeps all
+	MaxAge time.Duration
+	// MaxCount keeps only the latest records of each table, 0 keeps all
+	MaxCount int
+	// KeepFailedOnly prunes the succeed records, the failed ones are kept
+	// until they are pruned by the other rules
+	KeepFailedOnly bool
+}
+
+// RetentionPolicyFromConfig returns the retention policy configured.
+func RetentionPolicyFromConfig() *RetentionPolicy {
+	return &RetentionPolicy{
+		MaxAge:         time.Millisecond * config.Parameters.FinishedTxsRetentionAge,
+		MaxCount:       config.Parameters.FinishedTxsRetentionCount,
+		KeepFailedOnly: config.Parameters.FinishedTxsKeepFailedOnly,
+	}
+}
+
+// Enabled returns if any rule of the policy prunes records.
+func (policy *RetentionPolicy) Enabled() bool {
+	return policy.MaxAge > 0 || policy.MaxCount > 0 || policy.KeepFailedOnly
+}
+
+// pruned returns if the record at index of the count records of a table, which
+// are ordered from the oldest, is pruned by the policy.
+func (policy *RetentionPolicy) pruned(index, count int, expired, succeed bool) bool {
+	return (policy.MaxAge > 0 && expired) ||
+		(policy.MaxCount > 0 && index < count-policy.MaxCount) ||
+		(policy.KeepFailedOnly && succeed)
+}
+
+// pruneCondition returns the sql condition selecting the records of table
+// pruned by the policy, records before expiry of RecordTime are expired.
+func (policy *RetentionPolicy) pruneCondition(table string, expiry interface{}) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if policy.MaxAge > 0 {
+		conditions = append(conditions, "RecordTime<?")
+		args = append(args, expiry)
+	}
+	if policy.MaxCount > 0 {
+		conditions = append(conditions, "Id NOT IN (SELECT Id FROM "+table+" ORDER BY Id DESC LIMIT ?)")
+		args = append(args, policy.MaxCount)
+	}
+	if policy.KeepFailedOnly {
+		conditions = append(conditions, "Succeed=?")
+		args = append(args, true)
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
+
+// PrunedRecord is a record removed from the finished transactions database by
+// the retention policy, which is archived before it is deleted.
+type PrunedRecord struct {
+	Table                  string
+	Id                     uint64 `json:",omitempty"`
+	TransactionHash        string `json:",omitempty"`
+	GenesisBlockAddress    string `json:",omitempty"`
+	Succeed                bool
+	BlockHeight            uint32 `json:",omitempty"`
+	SideChainTransactionId uint64 `json:",omitempty"`
+	FailedReason           string `json:",omitempty"`
+	// TransactionData is the hex string of the failed withdraw transaction
+	TransactionData string    `json:",omitempty"`
+	RecordTime      string    `json:",omitempty"`
+	Transfer        *Transfer `json:",omitempty"`
+}
+
+// Prune deletes the records selected by the policy in one transaction, archive
+// is called with the records before they are deleted, and nothing is deleted
+// if it fails. Side chain transactions are pruned together with the last
+// failed withdraw referring to them.
+func (store *FinishedTxsDataStoreImpl) Prune(policy *RetentionPolicy, archive func(records []*PrunedRecord) error) error {
+	if !policy.Enabled() {
+		return nil
+	}
+
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	expiry := time.Now().Add(-policy.MaxAge)
+	depositCondition, depositArgs := policy.pruneCondition(DepositTransactionsTable, expiry.Format(recordTimeFormat))
+	withdrawCondition, withdrawArgs := policy.pruneCondition(WithdrawTransactionsTable, expiry.Format(recordTimeFormat))
+	transferCondition, transferArgs := policy.pruneCondition(TransfersTable, expiry.Unix())
+	sideChainCondition := "(Id IN (SELECT SideChainTransactionId FROM WithdrawTransactions WHERE " + withdrawCondition +
+		") AND Id NOT IN (SELECT SideChainTransactionId FROM WithdrawTransactions WHERE NOT " + withdrawCondition + "))"
+	sideChainArgs := append(append([]interface{}{}, withdrawArgs...), withdrawArgs...)
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+
+	var records []*PrunedRecord
+	deposits, err := selectPrunedRecords(tx, "SELECT Id, TransactionHash, GenesisBlockAddress, Succeed, BlockHeight, RecordTime FROM DepositTransactions WHERE "+depositCondition,
+		depositArgs, func(rows *sql.Rows) (*PrunedRecord, error) {
+			record := &PrunedRecord{Table: DepositTransactionsTable}
+			var blockHeight sql.NullInt64
+			var recordTime sql.NullString
+			err := rows.Scan(&record.Id, &record.TransactionHash, &record.GenesisBlockAddress, &record.Succeed,
+				&blockHeight, &recordTime)
+			record.BlockHeight = uint32(blockHeight.Int64)
+			record.RecordTime = recordTime.String
+			return record, err
+		})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	records = append(records, deposits...)
+
+	withdraws, err := selectPrunedRecords(tx, "SELECT Id, TransactionHash, SideChainTransactionId, Succeed, FailedReason, RecordTime FROM WithdrawTransactions WHERE "+withdrawCondition,
+		withdrawArgs, func(rows *sql.Rows) (*PrunedRecord, error) {
+			record := &PrunedRecord{Table: WithdrawTransactionsTable}
+			var failedReason, recordTime sql.NullString
+			err := rows.Scan(&record.Id, &record.TransactionHash, &record.SideChainTransactionId, &record.Succeed,
+				&failedReason, &recordTime)
+			record.FailedReason = failedReason.String
+			record.RecordTime = recordTime.String
+			return record, err
+		})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	records = append(records, withdraws...)
+
+	sideChainTxs, err := selectPrunedRecords(tx, "SELECT Id, TransactionData, RecordTime FROM SideChainTransactions WHERE "+sideChainCondition,
+		sideChainArgs, func(rows *sql.Rows) (*PrunedRecord, error) {
+			record := &PrunedRecord{Table: SideChainTransactionsTable}
+			var transactionData []byte
+			var recordTime sql.NullString
+			err := rows.Scan(&record.Id, &transactionData, &recordTime)
+			record.TransactionData = BytesToHexString(transactionData)
+			record.RecordTime = recordTime.String
+			return record, err
+		})
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	records = append(records, sideChainTxs...)
+
+	rows, err := tx.Query("SELECT "+transferColumns+" FROM Transfers WHERE "+transferCondition, transferArgs...)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	transfers, err := scanTransfers(rows)
+	rows.Close()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, transfer := range transfers {
+		records = append(records, &PrunedRecord{Table: TransfersTable, Id: transfer.Id, Succeed: transfer.Succeed,
+			Transfer: transfer})
+	}
+
+	if len(records) == 0 {
+		return tx.Rollback()
+	}
+	if err := archive(records); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Side chain transactions are deleted first, since they are selected by
+	// the withdraws kept
+	deletes := []struct {
+		query string
+		args  []interface{}
+	}{
+		{"DELETE FROM SideChainTransactions WHERE " + sideChainCondition, sideChainArgs},
+		{"DELETE FROM WithdrawTransactions WHERE " + withdrawCondition, withdrawArgs},
+		{"DELETE FROM DepositTransactions WHERE " + depositCondition, depositArgs},
+		{"DELETE FROM Transfers WHERE " + transferCondition, transferArgs},
+	}
+	for _, d := range deletes {
+		if _, err := tx.Exec(d.query, d.args...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func selectPrunedRecords(tx *sql.Tx, query string, args []interface{},
+	scan func(rows *sql.Rows) (*PrunedRecord, error)) ([]*PrunedRecord, error) {
+
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []*PrunedRecord
+	for rows.Next() {
+		record, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
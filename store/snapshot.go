@@ -0,0 +1,166 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+const (
+	// snapshotDriverName is the sqlite driver keeping the connections opened
+	// by Snapshot, which are needed by the online backup API.
+	snapshotDriverName = "sqlite3_snapshot"
+
+	// snapshotPagesPerStep is the number of pages copied each time the source
+	// database is locked, writers wait for one step at most.
+	snapshotPagesPerStep = 1024
+	snapshotStepInterval = 10 * time.Millisecond
+)
+
+var (
+	snapshotMux   sync.Mutex
+	snapshotConns = make(chan *sqlite3.SQLiteConn, 1)
+)
+
+func init() {
+	sql.Register(snapshotDriverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			snapshotConns <- conn
+			return nil
+		},
+	})
+}
+
+// Snapshot writes a consistent copy of the databases of the backend configured
+// to dir while the arbiter is running, the copies are named as the databases
+// under DBDocumentNAME.
+func Snapshot(dir string) error {
+	backend, err := currentBackend()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	return backend.Snapshot(dir)
+}
+
+// Snapshot copies the sqlite databases with the online backup API, which
+// copies a few pages each step and restarts if the database is changed, so
+// each copy is consistent and writers are not blocked meanwhile. The caches of
+// pending transactions are copied before the finished transactions database,
+// so a transaction finished meanwhile is pending and finished in the copies
+// instead of missing, which is reported by the verification at startup.
+func (sqliteBackend) Snapshot(dir string) error {
+	for _, path := range []string{DBNameUTXO, DBNameMainChain, DBNameSideChain, FinishedTxsDBName} {
+		exist, err := PathExists(path)
+		if err != nil {
+			return err
+		}
+		if !exist {
+			continue
+		}
+		if err := backupSQLite(path, filepath.Join(dir, filepath.Base(path))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backupSQLite copies the sqlite database at src to a new database at dst.
+func backupSQLite(src, dst string) error {
+	if exist, err := PathExists(dst); err != nil {
+		return err
+	} else if exist {
+		return errors.New("snapshot " + dst + " already exists")
+	}
+
+	// The connections are passed by the connect hook in the order opened
+	snapshotMux.Lock()
+	defer snapshotMux.Unlock()
+
+	srcDB, err := sql.Open(snapshotDriverName, src)
+	if err != nil {
+		return err
+	}
+	defer srcDB.Close()
+	srcDB.SetMaxOpenConns(1)
+	if err := srcDB.Ping(); err != nil {
+		return err
+	}
+	srcConn := <-snapshotConns
+
+	dstDB, err := sql.Open(snapshotDriverName, dst)
+	if err != nil {
+		return err
+	}
+	defer dstDB.Close()
+	dstDB.SetMaxOpenConns(1)
+	if err := dstDB.Ping(); err != nil {
+		return err
+	}
+	dstConn := <-snapshotConns
+
+	backup, err := dstConn.Backup("main", srcConn, "main")
+	if err != nil {
+		return err
+	}
+	for {
+		done, err := backup.Step(snapshotPagesPerStep)
+		if err != nil {
+			backup.Close()
+			return err
+		}
+		if done {
+			break
+		}
+		time.Sleep(snapshotStepInterval)
+	}
+	return backup.Finish()
+}
+
+// Snapshot copies the records of a LevelDB snapshot to a new database.
+func (b *levelDBBackend) Snapshot(dir string) error {
+	db, err := b.open()
+	if err != nil {
+		return err
+	}
+	snapshot, err := db.GetSnapshot()
+	if err != nil {
+		return err
+	}
+	defer snapshot.Release()
+
+	snapshotDB, err := leveldb.OpenFile(filepath.Join(dir, filepath.Base(DBNameLevelDB)), nil)
+	if err != nil {
+		return err
+	}
+	defer snapshotDB.Close()
+
+	iter := snapshot.NewIterator(nil, nil)
+	defer iter.Release()
+	batch := new(leveldb.Batch)
+	for iter.Next() {
+		// Put copies the key and value, which are reused by the iterator
+		batch.Put(iter.Key(), iter.Value())
+		if batch.Len() >= 1000 {
+			if err := snapshotDB.Write(batch, nil); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	if err := snapshotDB.Write(batch, nil); err != nil {
+		return err
+	}
+	return snapshotDB.Close()
+}
@@ -0,0 +1,395 @@
+package store
+
+import (
+	"bytes"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+
+	. "github.com/elastos/Elastos.ELA/common"
+	. "github.com/elastos/Elastos.ELA/core/types"
+)
+
+type TransferType byte
+
+const (
+	DepositTransfer TransferType = iota
+	WithdrawTransfer
+)
+
+const (
+	DefaultTransfersPageSize = 50
+	MaxTransfersPageSize     = 500
+)
+
+const (
+	CreateTransfersTable = `CREATE TABLE IF NOT EXISTS Transfers (
+				Id INTEGER NOT NULL PRIMARY KEY,
+				Type INTEGER,
+				TransactionHash VARCHAR,
+				GenesisBlockAddress VARCHAR(34),
+				OutputIndex INTEGER,
+				MainChainTxHash VARCHAR,
+				SideChainTxHash VARCHAR,
+				TargetAddress VARCHAR(34),
+				Amount INTEGER,
+				BlockHeight INTEGER,
+				Succeed BOOLEAN,
+				FailedReason TEXT,
+				RecordTime INTEGER,
+				UNIQUE (Type, TransactionHash, GenesisBlockAddress, OutputIndex)
+			);`
+	CreateTransfersGenesisBlockAddressIndex = `CREATE INDEX IF NOT EXISTS TransfersGenesisBlockAddress ON Transfers (GenesisBlockAddress, Id);`
+	CreateTransfersTargetAddressIndex       = `CREATE INDEX IF NOT EXISTS TransfersTargetAddress ON Transfers (TargetAddress, Id);`
+	CreateTransfersMainChainTxHashIndex     = `CREATE INDEX IF NOT EXISTS TransfersMainChainTxHash ON Transfers (MainChainTxHash);`
+	CreateTransfersSideChainTxHashIndex     = `CREATE INDEX IF NOT EXISTS TransfersSideChainTxHash ON Transfers (SideChainTxHash);`
+	CreateTransfersRecordTimeIndex          = `CREATE INDEX IF NOT EXISTS TransfersRecordTime ON Transfers (RecordTime, Id);`
+)
+
+const transferColumns = "Id, Type, TransactionHash, GenesisBlockAddress, OutputIndex, MainChainTxHash, SideChainTxHash, TargetAddress, Amount, BlockHeight, Succeed, FailedReason, RecordTime"
+
+func (t TransferType) String() string {
+	switch t {
+	case DepositTransfer:
+		return "deposit"
+	case WithdrawTransfer:
+		return "withdraw"
+	default:
+		return "unknown"
+	}
+}
+
+// Transfer is the transfer of one cross chain output to its target address,
+// recorded when the deposit or withdraw transaction is finished.
+type Transfer struct {
+	Id   uint64
+	Type TransferType
+	// TransactionHash is the hash recorded by the finished deposit or
+	// withdraw transaction, which is the main chain transaction of deposits
+	// and the side chain transaction of withdraws
+	TransactionHash     string
+	GenesisBlockAddress string
+	OutputIndex         uint32
+	MainChainTxHash     string
+	SideChainTxHash     string
+	TargetAddress       string
+	// Amount is the amount received by the target address
+	Amount       Fixed64
+	BlockHeight  uint32
+	Succeed      bool
+	FailedReason string
+	RecordTime   int64
+}
+
+// TransferFilter selects the transfers to query, empty fields match all
+// transfers. Transfers are returned from the latest, the next page starts
+// after Cursor, which is the Id of the last transfer of previous page.
+type TransferFilter struct {
+	Type                *TransferType
+	GenesisBlockAddress string
+	TargetAddress       string
+	// TransactionHash matches both the main chain and the side chain hash
+	TransactionHash string
+	Succeed         *bool
+	// StartTime and EndTime are unix seconds of RecordTime, EndTime is
+	// exclusive
+	StartTime int64
+	EndTime   int64
+	MinAmount Fixed64
+	MaxAmount Fixed64
+	Cursor    uint64
+	Limit     int
+}
+
+func (filter *TransferFilter) limit() int {
+	if filter.Limit <= 0 {
+		return DefaultTransfersPageSize
+	}
+	if filter.Limit > MaxTransfersPageSize {
+		return MaxTransfersPageSize
+	}
+	return filter.Limit
+}
+
+func (filter *TransferFilter) match(transfer *Transfer) bool {
+	if filter.Cursor > 0 && transfer.Id >= filter.Cursor {
+		return false
+	}
+	if filter.Type != nil && transfer.Type != *filter.Type {
+		return false
+	}
+	if filter.GenesisBlockAddress != "" && transfer.GenesisBlockAddress != filter.GenesisBlockAddress {
+		return false
+	}
+	if filter.TargetAddress != "" && transfer.TargetAddress != filter.TargetAddress {
+		return false
+	}
+	if filter.TransactionHash != "" && transfer.MainChainTxHash != filter.TransactionHash &&
+		transfer.SideChainTxHash != filter.TransactionHash {
+		return false
+	}
+	if filter.Succeed != nil && transfer.Succeed != *filter.Succeed {
+		return false
+	}
+	if filter.StartTime > 0 && transfer.RecordTime < filter.StartTime {
+		return false
+	}
+	if filter.EndTime > 0 && transfer.RecordTime >= filter.EndTime {
+		return false
+	}
+	if transfer.Amount < filter.MinAmount {
+		return false
+	}
+	if filter.MaxAmount > 0 && transfer.Amount > filter.MaxAmount {
+		return false
+	}
+	return true
+}
+
+// depositTransfers returns the transfers of the cross chain outputs of the
+// deposit transaction.
+func depositTransfers(tx *Transaction, transactionHash, genesisBlockAddress string, blockHeight uint32,
+	succeed bool, sideChainTxHash string) []*Transfer {
+
+	payload, ok := tx.Payload.(*PayloadTransferCrossChainAsset)
+	if !ok {
+		return nil
+	}
+	recordTime := time.Now().Unix()
+	var transfers []*Transfer
+	for i, address := range payload.CrossChainAddresses {
+		if i >= len(payload.OutputIndexes) || i >= len(payload.CrossChainAmounts) {
+			break
+		}
+		transfers = append(transfers, &Transfer{
+			Type:                DepositTransfer,
+			TransactionHash:     transactionHash,
+			GenesisBlockAddress: genesisBlockAddress,
+			OutputIndex:         uint32(payload.OutputIndexes[i]),
+			MainChainTxHash:     transactionHash,
+			SideChainTxHash:     sideChainTxHash,
+			TargetAddress:       address,
+			Amount:              payload.CrossChainAmounts[i],
+			BlockHeight:         blockHeight,
+			Succeed:             succeed,
+			RecordTime:          recordTime,
+		})
+	}
+	return transfers
+}
+
+// withdrawTransfers returns the transfers of the withdraw assets of the side
+// chain transaction, transactionByte is the serialized base.WithdrawTx.
+func withdrawTransfers(transactionByte []byte, transactionHash, genesisBlockAddress string, blockHeight uint32,
+	succeed bool, mainChainTxHash, reason string) []*Transfer {
+
+	withdrawTx := new(base.WithdrawTx)
+	if err := withdrawTx.Deserialize(bytes.NewReader(transactionByte)); err != nil {
+		return nil
+	}
+	recordTime := time.Now().Unix()
+	var transfers []*Transfer
+	for i, asset := range withdrawTx.WithdrawInfo.WithdrawAssets {
+		transfers = append(transfers, &Transfer{
+			Type:                WithdrawTransfer,
+			TransactionHash:     transactionHash,
+			GenesisBlockAddress: genesisBlockAddress,
+			OutputIndex:         uint32(i),
+			MainChainTxHash:     mainChainTxHash,
+			SideChainTxHash:     transactionHash,
+			TargetAddress:       asset.TargetAddress,
+			Amount:              *asset.CrossChainAmount,
+			BlockHeight:         blockHeight,
+			Succeed:             succeed,
+			FailedReason:        reason,
+			RecordTime:          recordTime,
+		})
+	}
+	return transfers
+}
+
+// selectDepositTransfers returns the transfers of the deposit transactions
+// pending in MainChainTxs table of the schema.
+func selectDepositTransfers(tx *sql.Tx, schema string, succeed bool, transactionHashes, genesisBlockAddresses []string,
+	blockHeights []uint32, sideChainTxHashes []string) ([]*Transfer, error) {
+
+	stmt, err := tx.Prepare("SELECT TransactionData FROM " + schema + ".MainChainTxs WHERE TransactionHash=? AND GenesisBlockAddress=?")
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	var transfers []*Transfer
+	for i := 0; i < len(transactionHashes); i++ {
+		var transactionBytes []byte
+		err := stmt.QueryRow(transactionHashes[i], genesisBlockAddresses[i]).Scan(&transactionBytes)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var mainChainTx Transaction
+		if err := mainChainTx.Deserialize(bytes.NewReader(transactionBytes)); err != nil {
+			continue
+		}
+		var sideChainTxHash string
+		if i < len(sideChainTxHashes) {
+			sideChainTxHash = sideChainTxHashes[i]
+		}
+		transfers = append(transfers, depositTransfers(&mainChainTx, transactionHashes[i],
+			genesisBlockAddresses[i], blockHeights[i], succeed, sideChainTxHash)...)
+	}
+	return transfers, nil
+}
+
+// selectWithdrawTransfers returns the transfers of the withdraw transactions
+// pending in SideChainTxs table of the schema.
+func selectWithdrawTransfers(tx *sql.Tx, schema string, succeed bool, transactionHashes []string,
+	mainChainTxHash, reason string) ([]*Transfer, error) {
+
+	stmt, err := tx.Prepare("SELECT GenesisBlockAddress, TransactionData, BlockHeight FROM " + schema + ".SideChainTxs WHERE TransactionHash=?")
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	var transfers []*Transfer
+	for _, txHash := range transactionHashes {
+		var genesisBlockAddress string
+		var transactionBytes []byte
+		var blockHeight sql.NullInt64
+		err := stmt.QueryRow(txHash).Scan(&genesisBlockAddress, &transactionBytes, &blockHeight)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, withdrawTransfers(transactionBytes, txHash, genesisBlockAddress,
+			uint32(blockHeight.Int64), succeed, mainChainTxHash, reason)...)
+	}
+	return transfers, nil
+}
+
+// insertTransfers records the transfers into Transfers table of the schema,
+// transfers already recorded are ignored.
+func insertTransfers(tx *sql.Tx, schema string, transfers []*Transfer) error {
+	if len(transfers) == 0 {
+		return nil
+	}
+	stmt, err := tx.Prepare("INSERT OR IGNORE INTO " + schema + ".Transfers(Type, TransactionHash, GenesisBlockAddress, OutputIndex, MainChainTxHash, SideChainTxHash, TargetAddress, Amount, BlockHeight, Succeed, FailedReason, RecordTime) values(?,?,?,?,?,?,?,?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, t := range transfers {
+		_, err := stmt.Exec(t.Type, t.TransactionHash, t.GenesisBlockAddress, t.OutputIndex, t.MainChainTxHash,
+			t.SideChainTxHash, t.TargetAddress, int64(t.Amount), t.BlockHeight, t.Succeed, t.FailedReason, t.RecordTime)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// QueryTransfers returns a page of the transfers selected by filter from the
+// latest, and the cursor of next page, which is 0 if there is no more.
+func (store *FinishedTxsDataStoreImpl) QueryTransfers(filter *TransferFilter) ([]*Transfer, uint64, error) {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	var conditions []string
+	var args []interface{}
+	if filter.Cursor > 0 {
+		conditions = append(conditions, "Id<?")
+		args = append(args, filter.Cursor)
+	}
+	if filter.Type != nil {
+		conditions = append(conditions, "Type=?")
+		args = append(args, *filter.Type)
+	}
+	if filter.GenesisBlockAddress != "" {
+		conditions = append(conditions, "GenesisBlockAddress=?")
+		args = append(args, filter.GenesisBlockAddress)
+	}
+	if filter.TargetAddress != "" {
+		conditions = append(conditions, "TargetAddress=?")
+		args = append(args, filter.TargetAddress)
+	}
+	if filter.TransactionHash != "" {
+		conditions = append(conditions, "(MainChainTxHash=? OR SideChainTxHash=?)")
+		args = append(args, filter.TransactionHash, filter.TransactionHash)
+	}
+	if filter.Succeed != nil {
+		conditions = append(conditions, "Succeed=?")
+		args = append(args, *filter.Succeed)
+	}
+	if filter.StartTime > 0 {
+		conditions = append(conditions, "RecordTime>=?")
+		args = append(args, filter.StartTime)
+	}
+	if filter.EndTime > 0 {
+		conditions = append(conditions, "RecordTime<?")
+		args = append(args, filter.EndTime)
+	}
+	if filter.MinAmount > 0 {
+		conditions = append(conditions, "Amount>=?")
+		args = append(args, int64(filter.MinAmount))
+	}
+	if filter.MaxAmount > 0 {
+		conditions = append(conditions, "Amount<=?")
+		args = append(args, int64(filter.MaxAmount))
+	}
+
+	query := "SELECT " + transferColumns + " FROM Transfers"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	limit := filter.limit()
+	query += " ORDER BY Id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := store.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	transfers, err := scanTransfers(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return transfers, nextTransfersCursor(transfers, limit), nil
+}
+
+// scanTransfers reads the transfers of rows selected by transferColumns.
+func scanTransfers(rows *sql.Rows) ([]*Transfer, error) {
+	var transfers []*Transfer
+	for rows.Next() {
+		t := new(Transfer)
+		var amount int64
+		var failedReason sql.NullString
+		err := rows.Scan(&t.Id, &t.Type, &t.TransactionHash, &t.GenesisBlockAddress, &t.OutputIndex,
+			&t.MainChainTxHash, &t.SideChainTxHash, &t.TargetAddress, &amount, &t.BlockHeight, &t.Succeed,
+			&failedReason, &t.RecordTime)
+		if err != nil {
+			return nil, err
+		}
+		t.Amount = Fixed64(amount)
+		t.FailedReason = failedReason.String
+		transfers = append(transfers, t)
+	}
+	return transfers, rows.Err()
+}
+
+func nextTransfersCursor(transfers []*Transfer, limit int) uint64 {
+	if len(transfers) < limit {
+		return 0
+	}
+	return transfers[len(transfers)-1].Id
+}
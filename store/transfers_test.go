@@ -0,0 +1,99 @@
+package store
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+
+	"github.com/elastos/Elastos.ELA.SPV/bloom"
+	. "github.com/elastos/Elastos.ELA/common"
+	. "github.com/elastos/Elastos.ELA/core/types"
+)
+
+func TestFinishedTxsDataStore_QueryTransfers(t *testing.T) {
+	stores := openFinisherTestStores(t)
+	defer stores.reset()
+
+	genesisAddress := "testAddress"
+	deposit := &Transaction{
+		TxType: TransferCrossChainAsset,
+		Payload: &PayloadTransferCrossChainAsset{
+			CrossChainAddresses: []string{"targetA", "targetB"},
+			OutputIndexes:       []uint64{0, 1},
+			CrossChainAmounts:   []Fixed64{100, 200},
+		},
+	}
+	err := stores.mainChain.AddMainChainTx(&base.MainChainTransaction{"depositHash", genesisAddress, deposit, new(bloom.MerkleProof)})
+	if err != nil {
+		t.Fatal("Add main chain transaction error.")
+	}
+
+	amount, crossChainAmount := Fixed64(310), Fixed64(300)
+	withdraw := &base.WithdrawTx{
+		Txid: new(Uint256),
+		WithdrawInfo: &base.WithdrawInfo{WithdrawAssets: []*base.WithdrawAsset{
+			{TargetAddress: "targetA", Amount: &amount, CrossChainAmount: &crossChainAmount},
+		}},
+	}
+	buf := new(bytes.Buffer)
+	if err := withdraw.Serialize(buf); err != nil {
+		t.Fatal("Serialize withdraw transaction error.")
+	}
+	if err := stores.sideChain.AddSideChainTx(&base.SideChainTransaction{"withdrawHash", genesisAddress, buf.Bytes(), 10}); err != nil {
+		t.Fatal("Add side chain transaction error.")
+	}
+
+	if err := stores.finish.FinishDepositTxs(true, []string{"depositHash"}, []string{genesisAddress}, []uint32{5}, []string{"sideHash"}); err != nil {
+		t.Fatal("Finish deposit transaction error.")
+	}
+	if err := stores.finish.FinishWithdrawTxs(false, []string{"withdrawHash"}, "", []byte{2}, "send withdraw transaction failed"); err != nil {
+		t.Fatal("Finish withdraw transaction error.")
+	}
+
+	transfers, cursor, err := stores.finishedTxs.QueryTransfers(&TransferFilter{})
+	if err != nil || len(transfers) != 3 || cursor != 0 {
+		t.Fatal("Query all transfers error.")
+	}
+	if transfers[0].Type != WithdrawTransfer || transfers[0].Amount != 300 || transfers[0].Succeed ||
+		transfers[0].FailedReason != "send withdraw transaction failed" {
+		t.Error("Latest transfer should be the failed withdraw.")
+	}
+	if transfers[1].Id <= transfers[2].Id {
+		t.Error("Transfers should be ordered from the latest.")
+	}
+
+	transfers, _, err = stores.finishedTxs.QueryTransfers(&TransferFilter{TargetAddress: "targetA"})
+	if err != nil || len(transfers) != 2 {
+		t.Error("Query transfers by target address error.")
+	}
+
+	depositType := DepositTransfer
+	transfers, _, err = stores.finishedTxs.QueryTransfers(&TransferFilter{Type: &depositType, MinAmount: 150})
+	if err != nil || len(transfers) != 1 || transfers[0].TargetAddress != "targetB" || transfers[0].SideChainTxHash != "sideHash" {
+		t.Error("Query deposit transfers by amount error.")
+	}
+
+	transfers, _, err = stores.finishedTxs.QueryTransfers(&TransferFilter{TransactionHash: "sideHash"})
+	if err != nil || len(transfers) != 2 {
+		t.Error("Query transfers by side chain transaction hash error.")
+	}
+
+	// Page through all transfers one by one
+	var paged []*Transfer
+	filter := &TransferFilter{Limit: 1}
+	for i := 0; i < 4; i++ {
+		transfers, cursor, err = stores.finishedTxs.QueryTransfers(filter)
+		if err != nil {
+			t.Fatal("Query transfers page error.")
+		}
+		paged = append(paged, transfers...)
+		if cursor == 0 {
+			break
+		}
+		filter.Cursor = cursor
+	}
+	if len(paged) != 3 || paged[0].Id <= paged[1].Id || paged[1].Id <= paged[2].Id {
+		t.Error("Paged transfers should cover all transfers once from the latest.")
+	}
+}
@@ -0,0 +1,167 @@
+package store
+
+import (
+	"database/sql"
+	"os"
+	"sync"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/log"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	mainChainSchema   = "main"
+	sideChainSchema   = "sidechain"
+	finishedTxsSchema = "finished"
+)
+
+var (
+	TxsFinisherSingleton TxsFinisher
+)
+
+// injectFailure is called between the steps of finishing transactions, tests
+// replace it to simulate a crash in the middle.
+var injectFailure = func(step string) error { return nil }
+
+// TxsFinisher moves transactions from the main chain and side chain caches to
+// the finished transactions database, each move is done in one transaction, so
+// the transactions are either pending or finished.
+type TxsFinisher interface {
+	FinishDepositTxs(succeed bool, transactionHashes, genesisBlockAddresses []string, blockHeights []uint32,
+		sideChainTxHashes []string) error
+	FinishWithdrawTxs(succeed bool, transactionHashes []string, mainChainTxHash string, transactionByte []byte,
+		reason string) error
+	Close() error
+}
+
+// TxsFinisherImpl attaches the side chain cache and the finished transactions
+// database to the main chain cache, so sqlite commits the changes of the
+// databases atomically.
+type TxsFinisherImpl struct {
+	mux *sync.Mutex
+
+	*sql.DB
+}
+
+// OpenTxsFinisher opens the transactions finisher of the backend configured.
+func OpenTxsFinisher() (TxsFinisher, error) {
+	backend, err := currentBackend()
+	if err != nil {
+		return nil, err
+	}
+	return backend.OpenTxsFinisher()
+}
+
+func openSQLiteTxsFinisher() (TxsFinisher, error) {
+	db, err := sql.Open(DriverName, DBNameMainChain)
+	if err != nil {
+		log.Error("Open data db error:", err)
+		return nil, err
+	}
+	// Attached databases belong to the connection, so only one is used
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+
+	_, err = db.Exec("ATTACH DATABASE ? AS "+sideChainSchema, DBNameSideChain)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	_, err = db.Exec("ATTACH DATABASE ? AS "+finishedTxsSchema, FinishedTxsDBName)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	dataStore := &TxsFinisherImpl{mux: new(sync.Mutex), DB: db}
+
+	// Handle system interrupt signals
+	dataStore.catchSystemSignals()
+
+	return dataStore, nil
+}
+
+func (store *TxsFinisherImpl) catchSystemSignals() {
+	HandleSignal(func() {
+		store.mux.Lock()
+		store.Close()
+		os.Exit(-1)
+	})
+}
+
+// FinishDepositTxs removes the deposit transactions from the main chain cache
+// and records them as succeed or failed in the finished transactions database,
+// together with the transfers of their cross chain outputs. The side chain
+// transactions of the deposits are recorded if sideChainTxHashes is not nil.
+func (store *TxsFinisherImpl) FinishDepositTxs(succeed bool, transactionHashes,
+	genesisBlockAddresses []string, blockHeights []uint32, sideChainTxHashes []string) error {
+
+	return store.update(func(tx *sql.Tx) error {
+		transfers, err := selectDepositTransfers(tx, mainChainSchema, succeed, transactionHashes,
+			genesisBlockAddresses, blockHeights, sideChainTxHashes)
+		if err != nil {
+			return err
+		}
+		err = deleteMainChainTxs(tx, mainChainSchema, transactionHashes, genesisBlockAddresses)
+		if err != nil {
+			return err
+		}
+		if err := injectFailure("deleteMainChainTxs"); err != nil {
+			return err
+		}
+		err = insertDepositTxs(tx, finishedTxsSchema, transactionHashes, genesisBlockAddresses,
+			blockHeights, succeed)
+		if err != nil {
+			return err
+		}
+		return insertTransfers(tx, finishedTxsSchema, transfers)
+	})
+}
+
+// FinishWithdrawTxs removes the side chain transactions from the side chain
+// cache and records them as succeed or failed withdraws in the finished
+// transactions database, together with the transfers of their withdraw assets.
+// mainChainTxHash is the withdraw transaction sent, and transactionByte is the
+// withdraw transaction failed.
+func (store *TxsFinisherImpl) FinishWithdrawTxs(succeed bool, transactionHashes []string,
+	mainChainTxHash string, transactionByte []byte, reason string) error {
+
+	return store.update(func(tx *sql.Tx) error {
+		transfers, err := selectWithdrawTransfers(tx, sideChainSchema, succeed, transactionHashes,
+			mainChainTxHash, reason)
+		if err != nil {
+			return err
+		}
+		err = deleteSideChainTxs(tx, sideChainSchema, transactionHashes)
+		if err != nil {
+			return err
+		}
+		if err := injectFailure("deleteSideChainTxs"); err != nil {
+			return err
+		}
+		err = insertWithdrawTxs(tx, finishedTxsSchema, transactionHashes, transactionByte, succeed, reason)
+		if err != nil {
+			return err
+		}
+		return insertTransfers(tx, finishedTxsSchema, transfers)
+	})
+}
+
+func (store *TxsFinisherImpl) update(fn func(tx *sql.Tx) error) error {
+	store.mux.Lock()
+	defer store.mux.Unlock()
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := injectFailure("commit"); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,136 @@
+package store
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/elastos/Elastos.ELA.Arbiter/arbitration/base"
+
+	"github.com/elastos/Elastos.ELA.SPV/bloom"
+	. "github.com/elastos/Elastos.ELA/core/types"
+)
+
+var errInjected = errors.New("injected failure")
+
+type finisherTestStores struct {
+	mainChain   DataStoreMainChain
+	sideChain   DataStoreSideChain
+	finishedTxs FinishedTransactionsDataStore
+	finisher    TxsFinisher
+}
+
+func openFinisherTestStores(t *testing.T) *finisherTestStores {
+	mainChain, err := OpenMainChainDataStore()
+	if err != nil {
+		t.Fatal("Open main chain database error.")
+	}
+	sideChain, err := OpenSideChainDataStore()
+	if err != nil {
+		t.Fatal("Open side chain database error.")
+	}
+	finishedTxs, err := OpenFinishedTxsDataStore()
+	if err != nil {
+		t.Fatal("Open finished transactions database error.")
+	}
+	finisher, err := OpenTxsFinisher()
+	if err != nil {
+		t.Fatal("Open transactions finisher error.")
+	}
+	return &finisherTestStores{mainChain, sideChain, finishedTxs, finisher}
+}
+
+func (s *finisherTestStores) reset() {
+	injectFailure = func(step string) error { return nil }
+	s.finisher.Close()
+	s.mainChain.ResetDataStore()
+	s.sideChain.ResetDataStore()
+	s.finishedTxs.ResetDataStore()
+}
+
+func failAt(failedStep string) func(step string) error {
+	return func(step string) error {
+		if step == failedStep {
+			return errInjected
+		}
+		return nil
+	}
+}
+
+func TestTxsFinisher_FinishDepositTxs(t *testing.T) {
+	stores := openFinisherTestStores(t)
+	defer stores.reset()
+
+	txHash := "testHash"
+	genesisAddress := "testAddress"
+	tx := &Transaction{TxType: WithdrawFromSideChain, Payload: new(PayloadWithdrawFromSideChain)}
+	err := stores.mainChain.AddMainChainTx(&base.MainChainTransaction{txHash, genesisAddress, tx, new(bloom.MerkleProof)})
+	if err != nil {
+		t.Fatal("Add main chain transaction error.")
+	}
+
+	// A failure at any step leaves the transaction pending
+	for _, step := range []string{"deleteMainChainTxs", "commit"} {
+		injectFailure = failAt(step)
+		err = stores.finisher.FinishDepositTxs(true, []string{txHash}, []string{genesisAddress}, []uint32{10}, nil)
+		if err != errInjected {
+			t.Error("Finish deposit transaction should fail at", step)
+		}
+		if ok, _ := stores.mainChain.HasMainChainTx(txHash, genesisAddress); !ok {
+			t.Error("Deposit transaction should still be pending after failure at", step)
+		}
+		if ok, _ := stores.finishedTxs.HasDepositTx(txHash, genesisAddress); ok {
+			t.Error("Deposit transaction should not be finished after failure at", step)
+		}
+	}
+
+	injectFailure = func(step string) error { return nil }
+	err = stores.finisher.FinishDepositTxs(true, []string{txHash}, []string{genesisAddress}, []uint32{10}, nil)
+	if err != nil {
+		t.Error("Finish deposit transaction error.")
+	}
+	if ok, _ := stores.mainChain.HasMainChainTx(txHash, genesisAddress); ok {
+		t.Error("Deposit transaction should not be pending.")
+	}
+	if ok, _ := stores.finishedTxs.GetDepositTxByHashAndGenesisAddress(txHash, genesisAddress); !ok {
+		t.Error("Deposit transaction should be finished as succeed.")
+	}
+}
+
+func TestTxsFinisher_FinishWithdrawTxs(t *testing.T) {
+	stores := openFinisherTestStores(t)
+	defer stores.reset()
+
+	txHash := "testHash"
+	genesisAddress := "testAddress"
+	if err := stores.sideChain.AddSideChainTx(&base.SideChainTransaction{txHash, genesisAddress, []byte{1}, 10}); err != nil {
+		t.Fatal("Add side chain transaction error.")
+	}
+
+	// A failure at any step leaves the transaction pending
+	for _, step := range []string{"deleteSideChainTxs", "commit"} {
+		injectFailure = failAt(step)
+		err := stores.finisher.FinishWithdrawTxs(false, []string{txHash}, "", []byte{2}, "send withdraw transaction failed")
+		if err != errInjected {
+			t.Error("Finish withdraw transaction should fail at", step)
+		}
+		if ok, _ := stores.sideChain.HasSideChainTx(txHash); !ok {
+			t.Error("Withdraw transaction should still be pending after failure at", step)
+		}
+		if ok, _ := stores.finishedTxs.HasWithdrawTx(txHash); ok {
+			t.Error("Withdraw transaction should not be finished after failure at", step)
+		}
+	}
+
+	injectFailure = func(step string) error { return nil }
+	err := stores.finisher.FinishWithdrawTxs(false, []string{txHash}, "", []byte{2}, "send withdraw transaction failed")
+	if err != nil {
+		t.Error("Finish withdraw transaction error.")
+	}
+	if ok, _ := stores.sideChain.HasSideChainTx(txHash); ok {
+		t.Error("Withdraw transaction should not be pending.")
+	}
+	succeed, transactionByte, err := stores.finishedTxs.GetWithdrawTxByHash(txHash)
+	if err != nil || succeed || len(transactionByte) != 1 || transactionByte[0] != 2 {
+		t.Error("Withdraw transaction should be finished as failed.")
+	}
+}